@@ -0,0 +1,361 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MGetRequest is a struct that represents a request to get several values from the cache.
+// It contains the keys to get and an optional custom prefix.
+type MGetRequest struct {
+	Keys   []string
+	Prefix *string
+}
+
+// MGet is a method of Cache that gets several values from the cache in one round trip.
+// It takes a context and a pointer to a MGetRequest struct,
+// and returns a map of the found keys to their values and an error.
+// Keys that do not exist are left out of the map.
+// The method uses the Redis MGET command to get the values, checking the local tier first if it is enabled.
+// With a Redis Cluster, the keys may be in different slots and one GET per key is pipelined instead.
+func (c *Cache) MGet(ctx context.Context, request *MGetRequest) (map[string]string, error) {
+	result := make(map[string]string, len(request.Keys))
+	local := c.local.Load()
+	var generation uint64
+	if local != nil {
+		generation = local.generation.Load()
+	}
+	keys := make([]string, 0, len(request.Keys))
+	names := make([]string, 0, len(request.Keys))
+	for _, name := range request.Keys {
+		key := c.prefixKey(name, request.Prefix)
+		if local != nil {
+			if value, ok := local.get(key); ok {
+				c.stats.localHits.Add(1)
+				result[name] = value
+				continue
+			}
+			c.stats.localMisses.Add(1)
+		}
+		keys = append(keys, key)
+		names = append(names, name)
+	}
+	if len(keys) == 0 {
+		return result, nil
+	}
+	values, err := c.mget(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	var found []int
+	for i, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			c.stats.redisMisses.Add(1)
+			continue
+		}
+		c.stats.redisHits.Add(1)
+		result[names[i]] = s
+		found = append(found, i)
+	}
+	if local != nil && len(found) > 0 {
+		// The local copies must not outlive the keys
+		ttls := make([]*redis.DurationCmd, len(found))
+		_, _ = c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, j := range found {
+				ttls[i] = pipe.PTTL(ctx, keys[j])
+			}
+			return nil
+		})
+		for i, j := range found {
+			if ttls[i].Err() == nil {
+				local.set(keys[j], result[names[j]], generation, ttls[i].Val())
+			}
+		}
+	}
+	return result, nil
+}
+
+// MSetItem is a struct that represents one value of a MSetRequest.
+// It contains the key to set, the value to set it to, and the expiration time in seconds.
+type MSetItem struct {
+	Key     string
+	Value   []byte
+	Seconds int64
+}
+
+// MSetRequest is a struct that represents a request to set several values in the cache.
+// It contains the items to set and an optional custom prefix.
+type MSetRequest struct {
+	Items  []MSetItem
+	Prefix *string
+}
+
+// MSet is a method of Cache that sets several values, each with its own expiration time, in one round trip.
+// It takes a context and a pointer to a MSetRequest struct,
+// and returns an error.
+// The method pipelines one Redis SET command per item.
+func (c *Cache) MSet(ctx context.Context, request *MSetRequest) error {
+	_, err := c.Pipelined(ctx, func(pipe *Pipeline) error {
+		for _, item := range request.Items {
+			pipe.Set(ctx, &SetCacheRequest{Key: item.Key, Value: item.Value, Seconds: item.Seconds, Prefix: request.Prefix})
+		}
+		return nil
+	})
+	return err
+}
+
+// MDeleteRequest is a struct that represents a request to delete several keys from the cache.
+// It contains the keys to delete and an optional custom prefix.
+type MDeleteRequest struct {
+	Keys   []string
+	Prefix *string
+}
+
+// MDelete is a method of Cache that deletes several keys from the cache.
+// It takes a context and a pointer to a MDeleteRequest struct,
+// and returns the number of keys that were deleted as an int64 and an error.
+// The method uses the Redis DEL command to delete the keys, with one DEL per key on a Redis Cluster.
+func (c *Cache) MDelete(ctx context.Context, request *MDeleteRequest) (int64, error) {
+	if len(request.Keys) == 0 {
+		return 0, nil
+	}
+	keys := c.prefixKeys(request.Keys, request.Prefix)
+	val, err := c.del(ctx, keys)
+	if err != nil {
+		return val, err
+	}
+	return val, c.invalidateLocal(ctx, keys...)
+}
+
+// MExistsRequest is a struct that represents a request to check if several keys exist in the cache.
+// It contains the keys and an optional custom prefix.
+type MExistsRequest struct {
+	Keys   []string
+	Prefix *string
+}
+
+// MExists is a method of Cache that checks if several keys exist in the cache in one round trip.
+// It takes a context and a pointer to a MExistsRequest struct,
+// and returns a map of the keys to whether they exist and an error.
+// The method pipelines one Redis EXISTS command per key.
+func (c *Cache) MExists(ctx context.Context, request *MExistsRequest) (map[string]bool, error) {
+	cmds := make([]*redis.IntCmd, len(request.Keys))
+	_, err := c.Pipelined(ctx, func(pipe *Pipeline) error {
+		for i, key := range request.Keys {
+			cmds[i] = pipe.Exists(ctx, &ExistsRequest{Key: key, Prefix: request.Prefix})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]bool, len(request.Keys))
+	for i, key := range request.Keys {
+		result[key] = cmds[i].Val() == 1
+	}
+	return result, nil
+}
+
+// prefixKeys prepends the prefix to every key.
+func (c *Cache) prefixKeys(keys []string, prefix *string) []string {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.prefixKey(key, prefix)
+	}
+	return prefixed
+}
+
+// Pipeline queues commands to send them to Redis in one round trip.
+// Its methods take the same request structs as Cache and apply the prefix to every key.
+// Each method returns the queued command, whose result is available once the pipeline was executed.
+type Pipeline struct {
+	cache   *Cache
+	pipe    redis.Pipeliner
+	written []string
+}
+
+// Pipelined is a method of Cache that queues the commands added by fn and executes them in one round trip.
+// It takes a context and a function that adds commands to the pipeline,
+// and returns the executed commands and an error.
+// The commands are not atomic: use TxPipelined for that.
+func (c *Cache) Pipelined(ctx context.Context, fn func(pipe *Pipeline) error) ([]redis.Cmder, error) {
+	return c.pipelined(ctx, c.client.Pipeline(), fn)
+}
+
+// TxPipelined is a method of Cache that queues the commands added by fn and executes them
+// atomically in a MULTI/EXEC transaction.
+// With a Redis Cluster, all keys of the transaction must be in the same slot, see HashTag.
+// It takes a context and a function that adds commands to the pipeline,
+// and returns the executed commands and an error.
+func (c *Cache) TxPipelined(ctx context.Context, fn func(pipe *Pipeline) error) ([]redis.Cmder, error) {
+	return c.pipelined(ctx, c.client.TxPipeline(), fn)
+}
+
+func (c *Cache) pipelined(ctx context.Context, pipe redis.Pipeliner, fn func(pipe *Pipeline) error) ([]redis.Cmder, error) {
+	p := &Pipeline{cache: c, pipe: pipe}
+	if err := fn(p); err != nil {
+		pipe.Discard()
+		return nil, err
+	}
+	cmds, err := pipe.Exec(ctx)
+	// The writes were sent even if a command failed, e.g. a Get of a missing key
+	if invalidateErr := c.invalidateLocal(ctx, p.written...); err == nil {
+		err = invalidateErr
+	}
+	return cmds, err
+}
+
+// key prefixes a key and remembers it for local invalidation if the command writes it.
+func (p *Pipeline) key(key string, prefix *string, write bool) string {
+	key = p.cache.prefixKey(key, prefix)
+	if write {
+		p.written = append(p.written, key)
+	}
+	return key
+}
+
+// Set queues a Redis SET command.
+func (p *Pipeline) Set(ctx context.Context, request *SetCacheRequest) *redis.StatusCmd {
+	return p.pipe.Set(ctx, p.key(request.Key, request.Prefix, true), request.Value, time.Duration(request.Seconds)*time.Second)
+}
+
+// Get queues a Redis GET command.
+func (p *Pipeline) Get(ctx context.Context, request *GetCacheRequest) *redis.StringCmd {
+	return p.pipe.Get(ctx, p.key(request.Key, request.Prefix, false))
+}
+
+// SetNX queues a Redis SET NX command.
+func (p *Pipeline) SetNX(ctx context.Context, request *SetNXRequest) *redis.BoolCmd {
+	return p.pipe.SetNX(ctx, p.key(request.Key, request.Prefix, true), request.Value, time.Duration(request.Seconds)*time.Second)
+}
+
+// Inc queues a Redis INCR command.
+func (p *Pipeline) Inc(ctx context.Context, request *IncRequest) *redis.IntCmd {
+	return p.pipe.Incr(ctx, p.key(request.Key, request.Prefix, true))
+}
+
+// IncrBy queues a Redis INCRBY command.
+func (p *Pipeline) IncrBy(ctx context.Context, request *IncrByRequest) *redis.IntCmd {
+	return p.pipe.IncrBy(ctx, p.key(request.Key, request.Prefix, true), request.Value)
+}
+
+// Delete queues a Redis DEL command.
+func (p *Pipeline) Delete(ctx context.Context, request *DeleteRequest) *redis.IntCmd {
+	return p.pipe.Del(ctx, p.key(request.Key, request.Prefix, true))
+}
+
+// Exists queues a Redis EXISTS command.
+func (p *Pipeline) Exists(ctx context.Context, request *ExistsRequest) *redis.IntCmd {
+	return p.pipe.Exists(ctx, p.key(request.Key, request.Prefix, false))
+}
+
+// Expire queues a Redis EXPIRE command.
+func (p *Pipeline) Expire(ctx context.Context, request *ExpireRequest) *redis.BoolCmd {
+	return p.pipe.Expire(ctx, p.key(request.Key, request.Prefix, true), time.Duration(request.Seconds)*time.Second)
+}
+
+// TTL queues a Redis TTL command.
+func (p *Pipeline) TTL(ctx context.Context, request *TTLRequest) *redis.DurationCmd {
+	return p.pipe.TTL(ctx, p.key(request.Key, request.Prefix, false))
+}
+
+// LPush queues a Redis LPUSH command.
+func (p *Pipeline) LPush(ctx context.Context, request *LPushRequest) *redis.IntCmd {
+	return p.pipe.LPush(ctx, p.key(request.Key, request.Prefix, false), request.Value...)
+}
+
+// RPush queues a Redis RPUSH command.
+func (p *Pipeline) RPush(ctx context.Context, request *RPushRequest) *redis.IntCmd {
+	return p.pipe.RPush(ctx, p.key(request.Key, request.Prefix, false), request.Value...)
+}
+
+// LRange queues a Redis LRANGE command.
+func (p *Pipeline) LRange(ctx context.Context, request *LRangeRequest) *redis.StringSliceCmd {
+	var start int64 = 0
+	var end int64 = -1
+	if request.Start != nil {
+		start = *request.Start
+	}
+	if request.End != nil {
+		end = *request.End
+	}
+	return p.pipe.LRange(ctx, p.key(request.Key, request.Prefix, false), start, end)
+}
+
+// ZAdd queues a Redis ZADD command.
+func (p *Pipeline) ZAdd(ctx context.Context, request *ZAddRequest) *redis.IntCmd {
+	return p.pipe.ZAdd(ctx, p.key(request.Key, request.Prefix, false), request.Members...)
+}
+
+// ZRange queues a Redis ZRANGE command.
+func (p *Pipeline) ZRange(ctx context.Context, request *ZRangeRequest) *redis.StringSliceCmd {
+	return p.pipe.ZRange(ctx, p.key(request.Key, request.Prefix, false), request.Start, request.End)
+}
+
+// ZRank queues a Redis ZRANK command.
+func (p *Pipeline) ZRank(ctx context.Context, request *ZRankRequest) *redis.IntCmd {
+	return p.pipe.ZRank(ctx, p.key(request.Key, request.Prefix, false), request.Member)
+}
+
+// ZCard queues a Redis ZCARD command.
+func (p *Pipeline) ZCard(ctx context.Context, request *ZCardRequest) *redis.IntCmd {
+	return p.pipe.ZCard(ctx, p.key(request.Key, request.Prefix, false))
+}
+
+// ZRem queues a Redis ZREM command.
+func (p *Pipeline) ZRem(ctx context.Context, request *ZRemRequest) *redis.IntCmd {
+	return p.pipe.ZRem(ctx, p.key(request.Key, request.Prefix, false), request.Members...)
+}
+
+// SAdd queues a Redis SADD command.
+func (p *Pipeline) SAdd(ctx context.Context, request *SAddRequest) *redis.IntCmd {
+	return p.pipe.SAdd(ctx, p.key(request.Key, request.Prefix, false), request.Value...)
+}
+
+// SCard queues a Redis SCARD command.
+func (p *Pipeline) SCard(ctx context.Context, request *SCardRequest) *redis.IntCmd {
+	return p.pipe.SCard(ctx, p.key(request.Key, request.Prefix, false))
+}
+
+// SRem queues a Redis SREM command.
+func (p *Pipeline) SRem(ctx context.Context, request *SRemRequest) *redis.IntCmd {
+	return p.pipe.SRem(ctx, p.key(request.Key, request.Prefix, false), request.Value...)
+}
+
+// SIsMember queues a Redis SISMEMBER command.
+func (p *Pipeline) SIsMember(ctx context.Context, request *SIsMemberRequest) *redis.BoolCmd {
+	return p.pipe.SIsMember(ctx, p.key(request.Key, request.Prefix, false), request.Value)
+}
+
+// HSet queues a Redis HSET command.
+func (p *Pipeline) HSet(ctx context.Context, request *HSetRequest) *redis.IntCmd {
+	return p.pipe.HSet(ctx, p.key(request.Key, request.Prefix, false), request.Values)
+}
+
+// HGet queues a Redis HGET command.
+func (p *Pipeline) HGet(ctx context.Context, request *HGetRequest) *redis.StringCmd {
+	return p.pipe.HGet(ctx, p.key(request.Key, request.Prefix, false), request.Field)
+}
+
+// HGetAll queues a Redis HGETALL command.
+func (p *Pipeline) HGetAll(ctx context.Context, request *HGetAllRequest) *redis.MapStringStringCmd {
+	return p.pipe.HGetAll(ctx, p.key(request.Key, request.Prefix, false))
+}
+
+// HIncrBy queues a Redis HINCRBY command.
+func (p *Pipeline) HIncrBy(ctx context.Context, request *HIncrByRequest) *redis.IntCmd {
+	return p.pipe.HIncrBy(ctx, p.key(request.Key, request.Prefix, false), request.Field, request.Value)
+}
+
+// ZIncrBy queues a Redis ZINCRBY command.
+func (p *Pipeline) ZIncrBy(ctx context.Context, request *ZIncrByRequest) *redis.FloatCmd {
+	return p.pipe.ZIncrBy(ctx, p.key(request.Key, request.Prefix, false), request.Value, request.Member)
+}
+
+// ZScore queues a Redis ZSCORE command.
+func (p *Pipeline) ZScore(ctx context.Context, request *ZScoreRequest) *redis.FloatCmd {
+	return p.pipe.ZScore(ctx, p.key(request.Key, request.Prefix, false), request.Member)
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_Batch(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+
+	err := cache.MSet(ctx, &MSetRequest{Items: []MSetItem{
+		{Key: "batch-1", Value: []byte("1"), Seconds: 60},
+		{Key: "batch-2", Value: []byte("2"), Seconds: 120},
+	}})
+	assert.NoError(t, err)
+	ttl, err := cache.TTL(ctx, &TTLRequest{Key: "batch-2"})
+	assert.NoError(t, err)
+	assert.Greater(t, ttl.Seconds(), float64(60))
+
+	values, err := cache.MGet(ctx, &MGetRequest{Keys: []string{"batch-1", "batch-2", "batch-missing"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"batch-1": "1", "batch-2": "2"}, values)
+
+	exists, err := cache.MExists(ctx, &MExistsRequest{Keys: []string{"batch-1", "batch-missing"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"batch-1": true, "batch-missing": false}, exists)
+
+	deleted, err := cache.MDelete(ctx, &MDeleteRequest{Keys: []string{"batch-1", "batch-2", "batch-missing"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+}
+
+func TestCache_Pipelined(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+	_, _ = cache.Delete(ctx, &DeleteRequest{Key: "pipeline-rank"})
+
+	var rank *redis.IntCmd
+	var get *redis.StringCmd
+	_, err := cache.TxPipelined(ctx, func(pipe *Pipeline) error {
+		pipe.Set(ctx, &SetCacheRequest{Key: "pipeline", Value: []byte("value"), Seconds: 60})
+		pipe.ZAdd(ctx, &ZAddRequest{Key: "pipeline-rank", Members: []redis.Z{{Score: 1, Member: "a"}, {Score: 2, Member: "b"}}})
+		rank = pipe.ZRank(ctx, &ZRankRequest{Key: "pipeline-rank", Member: "b"})
+		get = pipe.Get(ctx, &GetCacheRequest{Key: "pipeline"})
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rank.Val())
+	assert.Equal(t, "value", get.Val())
+
+	cmds, err := cache.Pipelined(ctx, func(pipe *Pipeline) error {
+		pipe.Get(ctx, &GetCacheRequest{Key: "pipeline"})
+		pipe.ZCard(ctx, &ZCardRequest{Key: "pipeline-rank"})
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, cmds, 2)
+	assert.Equal(t, []any{"get", "test:pipeline"}, cmds[0].Args())
+}
+
+func TestCache_Pipelined_InvalidatesOnError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := newTestCache(t, "test:")
+	assert.NoError(t, cache.EnableLocalCache(ctx, &LocalCacheOptions{Size: 100, TTL: time.Minute}))
+	_, _ = cache.Delete(ctx, &DeleteRequest{Key: "pipeline-missing"})
+	assert.NoError(t, cache.Set(ctx, &SetCacheRequest{Key: "pipeline-local", Value: []byte("1"), Seconds: 60}))
+	value, err := cache.Get(ctx, &GetCacheRequest{Key: "pipeline-local"})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+
+	_, err = cache.Pipelined(ctx, func(pipe *Pipeline) error {
+		pipe.Set(ctx, &SetCacheRequest{Key: "pipeline-local", Value: []byte("2"), Seconds: 60})
+		pipe.Get(ctx, &GetCacheRequest{Key: "pipeline-missing"})
+		return nil
+	})
+	assert.ErrorIs(t, err, redis.Nil)
+	value, err = cache.Get(ctx, &GetCacheRequest{Key: "pipeline-local"})
+	assert.NoError(t, err)
+	assert.Equal(t, "2", value)
+}
@@ -3,17 +3,26 @@ package cache
 import (
 	"context"
 	"errors"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
 )
 
 // Cache is a struct that represents a Redis cache.
 // It contains a prefix that is prepended to all keys in the cache,
-// and a client that is used to interact with the Redis server.
+// and a client that is used to interact with a standalone, Sentinel or Cluster Redis deployment.
+// The group collapses concurrent SafeRemember rebuilds of the same key,
+// and local is the optional in-process tier enabled by EnableLocalCache.
 type Cache struct {
 	prefix string
-	client *redis.Client
+	client redis.UniversalClient
+	group  singleflight.Group
+	local  atomic.Pointer[localCache]
+	stats  stats
+	// instrumentation is set by Instrument.
+	instrumentation atomic.Pointer[instrumentation]
 }
 
 // NewCache is a function that creates a new Cache.
@@ -34,8 +43,33 @@ func NewCacheByFailover(options *redis.FailoverOptions, prefix string) (*Cache,
 	}, nil
 }
 
+// NewCacheByCluster is a function that creates a new Cache backed by a Redis Cluster.
+// It takes a pointer to a redis.ClusterOptions struct, which contains options for the cluster client,
+// and a prefix string, which is prepended to all keys in the cache.
+// It returns a pointer to the created Cache and an error.
+func NewCacheByCluster(options *redis.ClusterOptions, prefix string) (*Cache, error) {
+	return &Cache{
+		prefix: prefix,
+		client: redis.NewClusterClient(options),
+	}, nil
+}
+
+// NewCacheByUniversal is a function that creates a new Cache from redis.UniversalOptions.
+// The client is a Sentinel client if MasterName is set, a cluster client if several addresses are set,
+// and a single-node client otherwise.
+// It takes a pointer to a redis.UniversalOptions struct and a prefix string, which is prepended to all keys in the cache.
+// It returns a pointer to the created Cache and an error.
+func NewCacheByUniversal(options *redis.UniversalOptions, prefix string) (*Cache, error) {
+	return &Cache{
+		prefix: prefix,
+		client: redis.NewUniversalClient(options),
+	}, nil
+}
+
 // prefixKey is a method of Cache that prepends the cache's prefix to a key.
 // If a custom prefix is provided, it is used instead of the cache's prefix.
+// Prefixes should not contain hash tags ("{...}"), otherwise every key would be stored in the same cluster slot
+// and the hash tags of the keys would be ignored.
 func (c *Cache) prefixKey(key string, prefix *string) string {
 	if prefix != nil {
 		return *prefix + key
@@ -57,9 +91,14 @@ type SetCacheRequest struct {
 // It takes a context and a pointer to a SetCacheRequest struct,
 // and returns an error.
 // The method uses the Redis SET command to set the value.
+// If the local tier is enabled, the key is invalidated in every process.
 func (c *Cache) Set(ctx context.Context, request *SetCacheRequest) error {
-	_, err := c.client.Set(ctx, c.prefixKey(request.Key, request.Prefix), request.Value, time.Duration(request.Seconds)*time.Second).Result()
-	return err
+	key := c.prefixKey(request.Key, request.Prefix)
+	_, err := c.client.Set(ctx, key, request.Value, time.Duration(request.Seconds)*time.Second).Result()
+	if err != nil {
+		return err
+	}
+	return c.invalidateLocal(ctx, key)
 }
 
 // GetCacheRequest is a struct that represents a request to get a value from the cache.
@@ -73,8 +112,59 @@ type GetCacheRequest struct {
 // It takes a context and a pointer to a GetCacheRequest struct,
 // and returns the value as a string and an error.
 // The method uses the Redis GET command to get the value.
+// If the local tier is enabled, it is checked first and filled on a Redis hit.
 func (c *Cache) Get(ctx context.Context, request *GetCacheRequest) (string, error) {
-	return c.client.Get(ctx, c.prefixKey(request.Key, request.Prefix)).Result()
+	return c.get(ctx, request, "get")
+}
+
+// get gets a value like Get, recording the lookup under the given method name.
+func (c *Cache) get(ctx context.Context, request *GetCacheRequest, method string) (string, error) {
+	key := c.prefixKey(request.Key, request.Prefix)
+	local := c.local.Load()
+	var generation uint64
+	if local != nil {
+		if value, ok := local.get(key); ok {
+			c.stats.localHits.Add(1)
+			c.recordLookup(method, key, true)
+			return value, nil
+		}
+		c.stats.localMisses.Add(1)
+		generation = local.generation.Load()
+	}
+	if local == nil {
+		value, err := c.client.Get(ctx, key).Result()
+		c.recordGet(method, key, err)
+		return value, err
+	}
+	// The local copy must not outlive the key
+	var get *redis.StringCmd
+	var ttl *redis.DurationCmd
+	_, _ = c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		ttl = pipe.PTTL(ctx, key)
+		return nil
+	})
+	value, err := get.Result()
+	c.recordGet(method, key, err)
+	if err != nil {
+		return value, err
+	}
+	if ttl.Err() == nil {
+		local.set(key, value, generation, ttl.Val())
+	}
+	return value, nil
+}
+
+// recordGet counts the result of a GET in the statistics of the Redis tier.
+func (c *Cache) recordGet(method, key string, err error) {
+	switch {
+	case err == nil:
+		c.stats.redisHits.Add(1)
+		c.recordLookup(method, key, true)
+	case errors.Is(err, redis.Nil):
+		c.stats.redisMisses.Add(1)
+		c.recordLookup(method, key, false)
+	}
 }
 
 // IncRequest is a struct that represents a request to increment a value in the cache.
@@ -89,7 +179,12 @@ type IncRequest struct {
 // and returns the new value as an int64 and an error.
 // The method uses the Redis INCR command to increment the value.
 func (c *Cache) Inc(ctx context.Context, request *IncRequest) (int64, error) {
-	return c.client.Incr(ctx, c.prefixKey(request.Key, request.Prefix)).Result()
+	key := c.prefixKey(request.Key, request.Prefix)
+	val, err := c.client.Incr(ctx, key).Result()
+	if err != nil {
+		return val, err
+	}
+	return val, c.invalidateLocal(ctx, key)
 }
 
 // IncrByRequest is a struct that represents a request to increment a value in the cache by a certain amount.
@@ -105,7 +200,12 @@ type IncrByRequest struct {
 // and returns the new value as an int64 and an error.
 // The method uses the Redis INCRBY command to increment the value.
 func (c *Cache) IncrBy(ctx context.Context, request *IncrByRequest) (int64, error) {
-	return c.client.IncrBy(ctx, c.prefixKey(request.Key, request.Prefix), request.Value).Result()
+	key := c.prefixKey(request.Key, request.Prefix)
+	val, err := c.client.IncrBy(ctx, key, request.Value).Result()
+	if err != nil {
+		return val, err
+	}
+	return val, c.invalidateLocal(ctx, key)
 }
 
 // DeleteRequest is a struct that represents a request to delete a key from the cache.
@@ -120,7 +220,12 @@ type DeleteRequest struct {
 // and returns the number of keys that were deleted as an int64 and an error.
 // The method uses the Redis DEL command to delete the key.
 func (c *Cache) Delete(ctx context.Context, request *DeleteRequest) (int64, error) {
-	return c.client.Del(ctx, c.prefixKey(request.Key, request.Prefix)).Result()
+	key := c.prefixKey(request.Key, request.Prefix)
+	val, err := c.client.Del(ctx, key).Result()
+	if err != nil {
+		return val, err
+	}
+	return val, c.invalidateLocal(ctx, key)
 }
 
 // LPushRequest is a struct that represents a request to push a value onto a list in the cache.
@@ -267,7 +372,12 @@ type ExpireRequest struct {
 // and returns a boolean indicating whether the expiration time was set and an error.
 // The method uses the Redis EXPIRE command to set the expiration time.
 func (c *Cache) Expire(ctx context.Context, request *ExpireRequest) (bool, error) {
-	return c.client.Expire(ctx, c.prefixKey(request.Key, request.Prefix), time.Duration(request.Seconds)*time.Second).Result()
+	key := c.prefixKey(request.Key, request.Prefix)
+	val, err := c.client.Expire(ctx, key, time.Duration(request.Seconds)*time.Second).Result()
+	if err != nil {
+		return val, err
+	}
+	return val, c.invalidateLocal(ctx, key)
 }
 
 // ZRangeRequest is a struct that represents a request to get a range of members from a sorted set in the cache.
@@ -416,7 +526,12 @@ type SetNXRequest struct {
 // and returns a boolean indicating whether the key was set and an error.
 // The method uses the Redis SETNX command to set the key.
 func (c *Cache) SetNX(ctx context.Context, request *SetNXRequest) (bool, error) {
-	return c.client.SetNX(ctx, c.prefixKey(request.Key, request.Prefix), request.Value, time.Second*time.Duration(request.Seconds)).Result()
+	key := c.prefixKey(request.Key, request.Prefix)
+	val, err := c.client.SetNX(ctx, key, request.Value, time.Second*time.Duration(request.Seconds)).Result()
+	if err != nil || !val {
+		return val, err
+	}
+	return val, c.invalidateLocal(ctx, key)
 }
 
 // LRemRequest is a struct that represents a request to remove occurrences of a value from a list in the cache.
@@ -487,10 +602,10 @@ type RememberRequest struct {
 // and returns the value as a byte slice and an error.
 func (c *Cache) Remember(ctx context.Context, request *RememberRequest) ([]byte, error) {
 	// Get the value from the cache
-	value, err := c.Get(ctx, &GetCacheRequest{
+	value, err := c.get(ctx, &GetCacheRequest{
 		Key:    request.Key,
 		Prefix: request.Prefix,
-	})
+	}, "remember")
 	if err != nil {
 		// If the value is not in the cache, call the callback function to get the value
 		val, err := request.Callback()
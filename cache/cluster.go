@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// HashTag wraps a key in braces so that every key containing it is stored in the same Redis Cluster slot.
+// For example, the keys HashTag("user:1") + ":profile" and HashTag("user:1") + ":orders"
+// can be used together in transactions and scripts.
+func HashTag(key string) string {
+	return "{" + key + "}"
+}
+
+// hasHashTag reports whether Redis Cluster hashes key by a hash tag rather than by the whole key.
+func hasHashTag(key string) bool {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return false
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	return end > 0
+}
+
+// sameSlotKey returns a key derived from a prefixed key that is stored in the same cluster slot.
+// If key already has a hash tag, the suffix is appended; otherwise key becomes the hash tag.
+func sameSlotKey(key, suffix string) string {
+	if hasHashTag(key) {
+		return key + suffix
+	}
+	return HashTag(key) + suffix
+}
+
+// isCluster reports whether the cache is backed by a Redis Cluster.
+func (c *Cache) isCluster() bool {
+	_, ok := c.client.(*redis.ClusterClient)
+	return ok
+}
+
+// forEachMaster calls fn for every master of a Redis Cluster, or once for the client otherwise.
+// With a cluster, fn is called concurrently for every master.
+func (c *Cache) forEachMaster(ctx context.Context, fn func(ctx context.Context, client redis.UniversalClient) error) error {
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return fn(ctx, client)
+		})
+	}
+	return fn(ctx, c.client)
+}
+
+// mget gets several prefixed keys. With a cluster the keys may live in different slots,
+// so one GET per key is pipelined instead of a single MGET. Missing keys are nil.
+func (c *Cache) mget(ctx context.Context, keys []string) ([]any, error) {
+	if !c.isCluster() {
+		return c.client.MGet(ctx, keys...).Result()
+	}
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	// The error of Pipelined is the first error of the commands, which may be the redis.Nil of a missing key
+	if err != nil {
+		if err = firstCmdError(cmds); err != nil {
+			return nil, err
+		}
+	}
+	values := make([]any, len(keys))
+	for i, cmd := range cmds {
+		if cmd.Err() == nil {
+			values[i] = cmd.Val()
+		}
+	}
+	return values, nil
+}
+
+// firstCmdError returns the first error of the commands other than redis.Nil.
+func firstCmdError[C redis.Cmder](cmds []C) error {
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+	}
+	return nil
+}
+
+// del deletes several prefixed keys, with one DEL per key on a cluster.
+func (c *Cache) del(ctx context.Context, keys []string) (int64, error) {
+	if !c.isCluster() {
+		return c.client.Del(ctx, keys...).Result()
+	}
+	cmds := make([]*redis.IntCmd, len(keys))
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for _, cmd := range cmds {
+		deleted += cmd.Val()
+	}
+	return deleted, nil
+}
+
+// ScanKeysRequest is a struct that represents a request to iterate over the keys of the cache.
+// It contains a match pattern applied after the prefix, a count hint for each SCAN call,
+// an optional Redis type filter, and an optional custom prefix.
+type ScanKeysRequest struct {
+	// Match is a glob-style pattern matched against the key without the prefix. Defaults to "*".
+	Match string
+	Count int64
+	// Type filters keys by their Redis type, such as "string" or "zset".
+	Type   string
+	Prefix *string
+}
+
+// ScanKeys is a method of Cache that iterates over the keys under the prefix that match a pattern,
+// calling fn with every key without its prefix. Iteration stops at the first error returned by fn.
+// It takes a context, a pointer to a ScanKeysRequest struct and the callback function,
+// and returns an error.
+// The method uses the Redis SCAN command, on every master if the cache is backed by a Redis Cluster.
+// As with SCAN, a key may be passed to fn more than once.
+func (c *Cache) ScanKeys(ctx context.Context, request *ScanKeysRequest, fn func(key string) error) error {
+	prefix := c.prefixKey("", request.Prefix)
+	return c.scan(ctx, request, func(key string) error {
+		return fn(strings.TrimPrefix(key, prefix))
+	})
+}
+
+// scan is like ScanKeys but passes the keys to fn with their prefix.
+func (c *Cache) scan(ctx context.Context, request *ScanKeysRequest, fn func(key string) error) error {
+	match := request.Match
+	if match == "" {
+		match = "*"
+	}
+	pattern := escapeGlob(c.prefixKey("", request.Prefix)) + match
+	var mu sync.Mutex
+	return c.forEachMaster(ctx, func(ctx context.Context, client redis.UniversalClient) error {
+		var cursor uint64
+		for {
+			var keys []string
+			var err error
+			if request.Type != "" {
+				keys, cursor, err = client.ScanType(ctx, cursor, pattern, request.Count, request.Type).Result()
+			} else {
+				keys, cursor, err = client.Scan(ctx, cursor, pattern, request.Count).Result()
+			}
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			for _, key := range keys {
+				if err = fn(key); err != nil {
+					break
+				}
+			}
+			mu.Unlock()
+			if err != nil {
+				return err
+			}
+			if cursor == 0 {
+				return nil
+			}
+		}
+	})
+}
+
+// escapeGlob escapes the characters that have a special meaning in Redis glob-style patterns.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSameSlotKey(t *testing.T) {
+	assert.Equal(t, "{test:jobs}:delayed", sameSlotKey("test:jobs", ":delayed"))
+	assert.Equal(t, "test:{user:1}:delayed", sameSlotKey("test:{user:1}", ":delayed"))
+	assert.Equal(t, "{test:{}}:dead", sameSlotKey("test:{}", ":dead"))
+	assert.Equal(t, `test:\*\?\[a\]`, escapeGlob("test:*?[a]"))
+}
+
+func TestFirstCmdError(t *testing.T) {
+	ctx := context.Background()
+	missing, failed, found := redis.NewStringCmd(ctx), redis.NewStringCmd(ctx), redis.NewStringCmd(ctx)
+	missing.SetErr(redis.Nil)
+	failed.SetErr(errors.New("CLUSTERDOWN"))
+	assert.NoError(t, firstCmdError([]*redis.StringCmd{missing, found}))
+	// A failure after a missing key is not hidden by its redis.Nil
+	assert.EqualError(t, firstCmdError([]*redis.StringCmd{missing, found, failed}), "CLUSTERDOWN")
+}
+
+func TestCache_ScanKeys(t *testing.T) {
+	cache, err := NewCacheByUniversal(&redis.UniversalOptions{
+		Addrs:    []string{os.Getenv("REDIS_ADDR")},
+		Password: os.Getenv("REDIS_PASSWORD"),
+	}, "test:")
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.False(t, cache.isCluster())
+	for _, key := range []string{"scan:a", "scan:b", "scan:c"} {
+		assert.NoError(t, cache.Set(ctx, &SetCacheRequest{Key: key, Value: []byte("1"), Seconds: 60}))
+	}
+	_, err = cache.ZAdd(ctx, &ZAddRequest{Key: "scan:zset", Members: []redis.Z{{Score: 1, Member: "a"}}})
+	assert.NoError(t, err)
+
+	var keys []string
+	err = cache.ScanKeys(ctx, &ScanKeysRequest{Match: "scan:*", Type: "string", Count: 1}, func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	assert.NoError(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"scan:a", "scan:b", "scan:c"}, keys)
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec is an interface that converts values to and from their stored byte representation.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec is a Codec that uses encoding/json.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// MsgpackCodec is a Codec that uses MessagePack.
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+// GobCodec is a Codec that uses encoding/gob.
+// Interface values must be registered with gob.Register before they can be encoded.
+type GobCodec struct{}
+
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// ProtobufCodec is a Codec for protobuf messages.
+// Values must implement proto.Message; pointers to message pointers are allocated on Unmarshal,
+// so it can be used with Typed[*pb.Message].
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("cache: %T does not implement proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() && rv.Elem().Kind() == reflect.Pointer {
+		elem := reflect.New(rv.Elem().Type().Elem())
+		if m, ok := elem.Interface().(proto.Message); ok {
+			if err := proto.Unmarshal(data, m); err != nil {
+				return err
+			}
+			rv.Elem().Set(elem)
+			return nil
+		}
+	}
+	return fmt.Errorf("cache: %T does not implement proto.Message", v)
+}
+
+// Compression is the algorithm used to compress encoded values.
+type Compression byte
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+)
+
+var errUnknownCompression = errors.New("cache: unknown compression")
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// compress prepends the compression header byte to data,
+// compressing it with the given algorithm if it is larger than threshold.
+func compress(data []byte, compression Compression, threshold int) ([]byte, error) {
+	if compression == CompressionNone || len(data) <= threshold {
+		return append([]byte{byte(CompressionNone)}, data...), nil
+	}
+	switch compression {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		buf.WriteByte(byte(CompressionGzip))
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(data, []byte{byte(CompressionZstd)}), nil
+	}
+	return nil, errUnknownCompression
+}
+
+// decompress reads the compression header byte and returns the decompressed data.
+// Data without a known header byte was not written by compress, e.g. by Cache.Set, and is returned as is.
+func decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	switch Compression(data[0]) {
+	case CompressionNone:
+		return data[1:], nil
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data[1:]))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case CompressionZstd:
+		return zstdDecoder.DecodeAll(data[1:], nil)
+	}
+	return data, nil
+}
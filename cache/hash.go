@@ -0,0 +1,269 @@
+package cache
+
+import (
+	"context"
+)
+
+// HSetRequest is a struct that represents a request to set fields of a hash in the cache.
+// It contains the key of the hash, the fields and their values, and an optional custom prefix.
+type HSetRequest struct {
+	Key    string
+	Values map[string]any
+	Prefix *string
+}
+
+// HSet is a method of Cache that sets fields of a hash in the cache.
+// It takes a context and a pointer to a HSetRequest struct,
+// and returns the number of fields that were added and an error.
+// The method uses the Redis HSET command to set the fields.
+func (c *Cache) HSet(ctx context.Context, request *HSetRequest) (int64, error) {
+	return c.client.HSet(ctx, c.prefixKey(request.Key, request.Prefix), request.Values).Result()
+}
+
+// HSetNXRequest is a struct that represents a request to set a field of a hash, only if the field does not exist.
+// It contains the key of the hash, the field, the value to set, and an optional custom prefix.
+type HSetNXRequest struct {
+	Key    string
+	Field  string
+	Value  any
+	Prefix *string
+}
+
+// HSetNX is a method of Cache that sets a field of a hash in the cache, only if the field does not exist.
+// It takes a context and a pointer to a HSetNXRequest struct,
+// and returns a boolean indicating whether the field was set and an error.
+// The method uses the Redis HSETNX command to set the field.
+func (c *Cache) HSetNX(ctx context.Context, request *HSetNXRequest) (bool, error) {
+	return c.client.HSetNX(ctx, c.prefixKey(request.Key, request.Prefix), request.Field, request.Value).Result()
+}
+
+// HGetRequest is a struct that represents a request to get a field of a hash in the cache.
+// It contains the key of the hash, the field, and an optional custom prefix.
+type HGetRequest struct {
+	Key    string
+	Field  string
+	Prefix *string
+}
+
+// HGet is a method of Cache that gets a field of a hash in the cache.
+// It takes a context and a pointer to a HGetRequest struct,
+// and returns the value of the field as a string and an error.
+// If the hash or the field does not exist, the error is redis.Nil.
+// The method uses the Redis HGET command to get the field.
+func (c *Cache) HGet(ctx context.Context, request *HGetRequest) (string, error) {
+	return c.client.HGet(ctx, c.prefixKey(request.Key, request.Prefix), request.Field).Result()
+}
+
+// HMGetRequest is a struct that represents a request to get several fields of a hash in the cache.
+// It contains the key of the hash, the fields, and an optional custom prefix.
+type HMGetRequest struct {
+	Key    string
+	Fields []string
+	Prefix *string
+}
+
+// HMGet is a method of Cache that gets several fields of a hash in the cache.
+// It takes a context and a pointer to a HMGetRequest struct,
+// and returns a map of the found fields to their values and an error.
+// Fields that do not exist are left out of the map.
+// The method uses the Redis HMGET command to get the fields.
+func (c *Cache) HMGet(ctx context.Context, request *HMGetRequest) (map[string]string, error) {
+	values, err := c.client.HMGet(ctx, c.prefixKey(request.Key, request.Prefix), request.Fields...).Result()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(values))
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			result[request.Fields[i]] = s
+		}
+	}
+	return result, nil
+}
+
+// HGetAllRequest is a struct that represents a request to get all the fields of a hash in the cache.
+// It contains the key of the hash and an optional custom prefix.
+type HGetAllRequest struct {
+	Key    string
+	Prefix *string
+}
+
+// HGetAll is a method of Cache that gets all the fields of a hash in the cache.
+// It takes a context and a pointer to a HGetAllRequest struct,
+// and returns a map of the fields to their values and an error.
+// The method uses the Redis HGETALL command to get the fields.
+func (c *Cache) HGetAll(ctx context.Context, request *HGetAllRequest) (map[string]string, error) {
+	return c.client.HGetAll(ctx, c.prefixKey(request.Key, request.Prefix)).Result()
+}
+
+// HDelRequest is a struct that represents a request to delete fields of a hash in the cache.
+// It contains the key of the hash, the fields to delete, and an optional custom prefix.
+type HDelRequest struct {
+	Key    string
+	Fields []string
+	Prefix *string
+}
+
+// HDel is a method of Cache that deletes fields of a hash in the cache.
+// It takes a context and a pointer to a HDelRequest struct,
+// and returns the number of fields that were deleted and an error.
+// The method uses the Redis HDEL command to delete the fields.
+func (c *Cache) HDel(ctx context.Context, request *HDelRequest) (int64, error) {
+	return c.client.HDel(ctx, c.prefixKey(request.Key, request.Prefix), request.Fields...).Result()
+}
+
+// HExistsRequest is a struct that represents a request to check if a field of a hash exists in the cache.
+// It contains the key of the hash, the field, and an optional custom prefix.
+type HExistsRequest struct {
+	Key    string
+	Field  string
+	Prefix *string
+}
+
+// HExists is a method of Cache that checks if a field of a hash exists in the cache.
+// It takes a context and a pointer to a HExistsRequest struct,
+// and returns a boolean indicating whether the field exists and an error.
+// The method uses the Redis HEXISTS command to check if the field exists.
+func (c *Cache) HExists(ctx context.Context, request *HExistsRequest) (bool, error) {
+	return c.client.HExists(ctx, c.prefixKey(request.Key, request.Prefix), request.Field).Result()
+}
+
+// HIncrByRequest is a struct that represents a request to increment a field of a hash in the cache.
+// It contains the key of the hash, the field, the increment, and an optional custom prefix.
+type HIncrByRequest struct {
+	Key    string
+	Field  string
+	Value  int64
+	Prefix *string
+}
+
+// HIncrBy is a method of Cache that increments a field of a hash in the cache by a given value.
+// It takes a context and a pointer to a HIncrByRequest struct,
+// and returns the new value of the field as an int64 and an error.
+// The method uses the Redis HINCRBY command to increment the field.
+func (c *Cache) HIncrBy(ctx context.Context, request *HIncrByRequest) (int64, error) {
+	return c.client.HIncrBy(ctx, c.prefixKey(request.Key, request.Prefix), request.Field, request.Value).Result()
+}
+
+// HIncrByFloatRequest is a struct that represents a request to increment a field of a hash by a float value.
+// It contains the key of the hash, the field, the increment, and an optional custom prefix.
+type HIncrByFloatRequest struct {
+	Key    string
+	Field  string
+	Value  float64
+	Prefix *string
+}
+
+// HIncrByFloat is a method of Cache that increments a field of a hash in the cache by a float value.
+// It takes a context and a pointer to a HIncrByFloatRequest struct,
+// and returns the new value of the field as a float64 and an error.
+// The method uses the Redis HINCRBYFLOAT command to increment the field.
+func (c *Cache) HIncrByFloat(ctx context.Context, request *HIncrByFloatRequest) (float64, error) {
+	return c.client.HIncrByFloat(ctx, c.prefixKey(request.Key, request.Prefix), request.Field, request.Value).Result()
+}
+
+// HKeysRequest is a struct that represents a request to get the fields of a hash in the cache.
+// It contains the key of the hash and an optional custom prefix.
+type HKeysRequest struct {
+	Key    string
+	Prefix *string
+}
+
+// HKeys is a method of Cache that gets the fields of a hash in the cache.
+// It takes a context and a pointer to a HKeysRequest struct,
+// and returns the fields as a slice of strings and an error.
+// The method uses the Redis HKEYS command to get the fields.
+func (c *Cache) HKeys(ctx context.Context, request *HKeysRequest) ([]string, error) {
+	return c.client.HKeys(ctx, c.prefixKey(request.Key, request.Prefix)).Result()
+}
+
+// HLenRequest is a struct that represents a request to get the number of fields of a hash in the cache.
+// It contains the key of the hash and an optional custom prefix.
+type HLenRequest struct {
+	Key    string
+	Prefix *string
+}
+
+// HLen is a method of Cache that gets the number of fields of a hash in the cache.
+// It takes a context and a pointer to a HLenRequest struct,
+// and returns the number of fields as an int64 and an error.
+// The method uses the Redis HLEN command to get the number of fields.
+func (c *Cache) HLen(ctx context.Context, request *HLenRequest) (int64, error) {
+	return c.client.HLen(ctx, c.prefixKey(request.Key, request.Prefix)).Result()
+}
+
+// HScanRequest is a struct that represents a request to incrementally iterate over a hash in the cache.
+// It contains the key of the hash, a cursor to resume the iteration, a match pattern to filter the fields,
+// a count to limit the number of returned fields per call, and an optional custom prefix.
+type HScanRequest struct {
+	Key    string
+	Cursor uint64
+	Match  string
+	Count  int64
+	Prefix *string
+}
+
+// HScan is a method of Cache that incrementally iterates over a hash in the cache.
+// It takes a context and a pointer to a HScanRequest struct,
+// and returns the fields and values as a flat slice of strings, the next cursor, and an error.
+// The method uses the Redis HSCAN command to iterate over the fields.
+func (c *Cache) HScan(ctx context.Context, request *HScanRequest) ([]string, uint64, error) {
+	return c.client.
+		HScan(ctx, c.prefixKey(request.Key, request.Prefix), request.Cursor, request.Match, request.Count).
+		Result()
+}
+
+// TypedHSetRequest is a struct that represents a request to set typed fields of a hash in the cache.
+// It contains the key of the hash, the fields and their values, and an optional custom prefix.
+type TypedHSetRequest[T any] struct {
+	Key    string
+	Values map[string]T
+	Prefix *string
+}
+
+// HSet is a method of Typed that encodes values and sets them as fields of a hash in the cache.
+// It takes a context and a pointer to a TypedHSetRequest struct,
+// and returns the number of fields that were added and an error.
+func (t *Typed[T]) HSet(ctx context.Context, request *TypedHSetRequest[T]) (int64, error) {
+	values := make(map[string]any, len(request.Values))
+	for field, value := range request.Values {
+		data, err := t.encode(value)
+		if err != nil {
+			return 0, err
+		}
+		values[field] = data
+	}
+	return t.cache.HSet(ctx, &HSetRequest{Key: request.Key, Values: values, Prefix: request.Prefix})
+}
+
+// HGet is a method of Typed that gets a field of a hash in the cache and decodes it.
+// It takes a context and a pointer to a HGetRequest struct,
+// and returns the decoded value and an error.
+// If the hash or the field does not exist, the error is redis.Nil.
+func (t *Typed[T]) HGet(ctx context.Context, request *HGetRequest) (T, error) {
+	value, err := t.cache.HGet(ctx, request)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return t.decode([]byte(value))
+}
+
+// HGetAll is a method of Typed that gets all the fields of a hash in the cache and decodes them.
+// It takes a context and a pointer to a HGetAllRequest struct,
+// and returns a map of the fields to their decoded values and an error.
+func (t *Typed[T]) HGetAll(ctx context.Context, request *HGetAllRequest) (map[string]T, error) {
+	values, err := t.cache.HGetAll(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]T, len(values))
+	for field, value := range values {
+		decoded, err := t.decode([]byte(value))
+		if err != nil {
+			return nil, err
+		}
+		result[field] = decoded
+	}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_Hash(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+	_, _ = cache.Delete(ctx, &DeleteRequest{Key: "hash"})
+
+	added, err := cache.HSet(ctx, &HSetRequest{Key: "hash", Values: map[string]any{"name": "truman", "visits": 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), added)
+	ok, err := cache.HSetNX(ctx, &HSetNXRequest{Key: "hash", Field: "name", Value: "other"})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	name, err := cache.HGet(ctx, &HGetRequest{Key: "hash", Field: "name"})
+	assert.NoError(t, err)
+	assert.Equal(t, "truman", name)
+	_, err = cache.HGet(ctx, &HGetRequest{Key: "hash", Field: "missing"})
+	assert.True(t, errors.Is(err, redis.Nil))
+
+	visits, err := cache.HIncrBy(ctx, &HIncrByRequest{Key: "hash", Field: "visits", Value: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), visits)
+	values, err := cache.HMGet(ctx, &HMGetRequest{Key: "hash", Fields: []string{"visits", "missing"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"visits": "3"}, values)
+
+	deleted, err := cache.HDel(ctx, &HDelRequest{Key: "hash", Fields: []string{"visits"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	all, err := cache.HGetAll(ctx, &HGetAllRequest{Key: "hash"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"name": "truman"}, all)
+	n, err := cache.HLen(ctx, &HLenRequest{Key: "hash"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestTyped_Hash(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+	_, _ = cache.Delete(ctx, &DeleteRequest{Key: "typed-hash"})
+
+	type user struct {
+		Name string `json:"name"`
+	}
+	typed := NewTyped[user](cache, nil)
+	_, err := typed.HSet(ctx, &TypedHSetRequest[user]{Key: "typed-hash", Values: map[string]user{"1": {Name: "a"}, "2": {Name: "b"}}})
+	assert.NoError(t, err)
+	value, err := typed.HGet(ctx, &HGetRequest{Key: "typed-hash", Field: "2"})
+	assert.NoError(t, err)
+	assert.Equal(t, user{Name: "b"}, value)
+	all, err := typed.HGetAll(ctx, &HGetAllRequest{Key: "typed-hash"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]user{"1": {Name: "a"}, "2": {Name: "b"}}, all)
+}
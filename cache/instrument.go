@@ -0,0 +1,263 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"github.com/trumanwong/go-tools/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultSlowThreshold = 100 * time.Millisecond
+	instrumentationName  = "github.com/trumanwong/go-tools/cache"
+)
+
+// keylessCommands are the commands whose first argument is not a key.
+var keylessCommands = map[string]bool{
+	"auth": true, "client": true, "cluster": true, "command": true, "config": true, "dbsize": true,
+	"discard": true, "echo": true, "exec": true, "flushall": true, "flushdb": true, "hello": true,
+	"info": true, "multi": true, "ping": true, "psubscribe": true, "punsubscribe": true, "quit": true,
+	"readonly": true, "scan": true, "script": true, "select": true, "subscribe": true, "time": true,
+	"unsubscribe": true, "xread": true, "xreadgroup": true,
+}
+
+// InstrumentOptions is a struct that represents the options of Cache.Instrument.
+// It contains where and how the Prometheus metrics are registered, the OpenTelemetry tracer provider,
+// and the logger and threshold of slow command warnings.
+type InstrumentOptions struct {
+	// Registerer registers the metrics. Defaults to prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+	// Buckets are the buckets of the command duration histogram in seconds.
+	// Defaults to exponential buckets from 0.5ms to about 1s.
+	Buckets []float64
+	// TracerProvider creates the spans of the commands. Defaults to the global provider of otel.
+	TracerProvider trace.TracerProvider
+	// Logger receives a warning for every command slower than SlowThreshold. Nil disables the warnings.
+	Logger *log.Logger
+	// SlowThreshold defaults to 100 milliseconds.
+	SlowThreshold time.Duration
+	// KeyLabel returns the "prefix" label of a key, which must take a bounded number of values.
+	// Defaults to the cache prefix followed by the first segment of the key, if it ends with a colon,
+	// so that "app:user:1" and "app:user:1:orders" are both labelled "app:user:".
+	KeyLabel func(key string) string
+}
+
+// instrumentation records metrics, spans and slow command warnings for the commands of a Cache.
+type instrumentation struct {
+	commandsTotal   *prometheus.CounterVec
+	commandDuration *prometheus.HistogramVec
+	hitsTotal       *prometheus.CounterVec
+	missesTotal     *prometheus.CounterVec
+	tracer          trace.Tracer
+	logger          *log.Logger
+	slowThreshold   time.Duration
+	keyLabel        func(key string) string
+}
+
+// Instrument is a method of Cache that records Prometheus metrics and OpenTelemetry spans for every Redis
+// command, and logs a warning for slow commands.
+// It takes a pointer to an InstrumentOptions struct, which may be nil, and returns an error
+// if the metrics cannot be registered.
+//
+// The following metrics are registered, named like those of middlewares.NewPrometheusMiddleware:
+//   - redis_commands_total: the number of commands, by command and status ("ok", "nil" or "error").
+//   - redis_command_duration_seconds: the latencies of commands, by command and status.
+//   - cache_hits_total and cache_misses_total: the lookups of Get, Remember and SafeRemember, by method and key prefix.
+//
+// Pipelines are recorded as a single "pipeline" command. The key prefix of a key is given by KeyLabel.
+func (c *Cache) Instrument(options *InstrumentOptions) error {
+	if options == nil {
+		options = &InstrumentOptions{}
+	}
+	registerer := options.Registerer
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	buckets := options.Buckets
+	if buckets == nil {
+		buckets = prometheus.ExponentialBuckets(0.0005, 2, 12)
+	}
+	provider := options.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	slowThreshold := options.SlowThreshold
+	if slowThreshold <= 0 {
+		slowThreshold = defaultSlowThreshold
+	}
+	keyLabel := options.KeyLabel
+	if keyLabel == nil {
+		keyLabel = c.keyLabel
+	}
+
+	i := &instrumentation{
+		commandsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "redis_commands_total",
+				Help: "Tracks the number of Redis commands.",
+			}, []string{"command", "status"},
+		),
+		commandDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "redis_command_duration_seconds",
+				Help:    "Tracks the latencies for Redis commands.",
+				Buckets: buckets,
+			}, []string{"command", "status"},
+		),
+		hitsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cache_hits_total",
+				Help: "Tracks the number of cache hits.",
+			}, []string{"method", "prefix"},
+		),
+		missesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cache_misses_total",
+				Help: "Tracks the number of cache misses.",
+			}, []string{"method", "prefix"},
+		),
+		tracer:        provider.Tracer(instrumentationName),
+		logger:        options.Logger,
+		slowThreshold: slowThreshold,
+		keyLabel:      keyLabel,
+	}
+	for _, collector := range []prometheus.Collector{i.commandsTotal, i.commandDuration, i.hitsTotal, i.missesTotal} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	c.client.AddHook(i)
+	c.instrumentation.Store(i)
+	return nil
+}
+
+// DialHook implements redis.Hook.
+func (i *instrumentation) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+// ProcessHook implements redis.Hook.
+func (i *instrumentation) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		prefix := i.keyLabel(commandKey(cmd))
+		ctx, span := i.tracer.Start(ctx, "redis."+cmd.Name(),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "redis"),
+				attribute.String("db.operation", cmd.Name()),
+				attribute.String("db.redis.key_prefix", prefix),
+			),
+		)
+		start := time.Now()
+		err := next(ctx, cmd)
+		i.record(ctx, span, cmd.Name(), prefix, start, err)
+		return err
+	}
+}
+
+// ProcessPipelineHook implements redis.Hook.
+func (i *instrumentation) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		var prefix string
+		if len(cmds) > 0 {
+			prefix = i.keyLabel(commandKey(cmds[0]))
+		}
+		ctx, span := i.tracer.Start(ctx, "redis.pipeline",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "redis"),
+				attribute.String("db.operation", "pipeline"),
+				attribute.String("db.redis.key_prefix", prefix),
+				attribute.Int("db.redis.num_cmd", len(cmds)),
+			),
+		)
+		start := time.Now()
+		err := next(ctx, cmds)
+		i.record(ctx, span, "pipeline", prefix, start, err)
+		return err
+	}
+}
+
+// record ends the span of a command, updates the command metrics and warns about slow commands.
+func (i *instrumentation) record(ctx context.Context, span trace.Span, command, prefix string, start time.Time, err error) {
+	duration := time.Since(start)
+	status := "ok"
+	switch {
+	case errors.Is(err, redis.Nil):
+		status = "nil"
+	case err != nil:
+		status = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	i.commandsTotal.WithLabelValues(command, status).Inc()
+	i.commandDuration.WithLabelValues(command, status).Observe(duration.Seconds())
+
+	if i.logger != nil && duration >= i.slowThreshold {
+		entry := i.logger.WithContext(ctx).WithField("command", command).
+			WithField("prefix", prefix).
+			WithField("duration", duration.String())
+		if spanContext := span.SpanContext(); spanContext.HasTraceID() {
+			entry = entry.WithField("trace_id", spanContext.TraceID().String())
+		}
+		entry.Warn("slow redis command")
+	}
+}
+
+// recordLookup counts a hit or a miss of a lookup method for a prefixed key, if the cache is instrumented.
+func (c *Cache) recordLookup(method, key string, hit bool) {
+	i := c.instrumentation.Load()
+	if i == nil {
+		return
+	}
+	if hit {
+		i.hitsTotal.WithLabelValues(method, i.keyLabel(key)).Inc()
+	} else {
+		i.missesTotal.WithLabelValues(method, i.keyLabel(key)).Inc()
+	}
+}
+
+// commandKey returns the first key of a command, or an empty string if the command has no key.
+func commandKey(cmd redis.Cmder) string {
+	args := cmd.Args()
+	pos := 1
+	switch name := cmd.Name(); {
+	case keylessCommands[name]:
+		return ""
+	case name == "eval" || name == "evalsha" || name == "eval_ro" || name == "evalsha_ro":
+		if len(args) < 3 || fmt.Sprint(args[2]) == "0" {
+			return ""
+		}
+		pos = 3
+	case name == "memory":
+		pos = 2
+	}
+	if len(args) <= pos {
+		return ""
+	}
+	key, _ := args[pos].(string)
+	return key
+}
+
+// keyLabel returns the cache prefix of a key followed by its first segment, up to and including a colon.
+// The segments after it usually hold IDs, which would make the number of labels unbounded.
+func (c *Cache) keyLabel(key string) string {
+	prefix := ""
+	if strings.HasPrefix(key, c.prefix) {
+		prefix, key = c.prefix, key[len(c.prefix):]
+	}
+	return prefix + key[:strings.IndexByte(key, ':')+1]
+}
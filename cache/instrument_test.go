@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/trumanwong/go-tools/log"
+)
+
+func TestCache_Instrument(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	var output bytes.Buffer
+	registry := prometheus.NewRegistry()
+	err := cache.Instrument(&InstrumentOptions{
+		Registerer:    registry,
+		Logger:        log.NewLogger(&log.Options{Output: &output}),
+		SlowThreshold: time.Nanosecond,
+	})
+	assert.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), "X-Trace-Id", "trace-1")
+	assert.NoError(t, cache.Set(ctx, &SetCacheRequest{Key: "instrument:a", Value: []byte("1"), Seconds: 60}))
+	_, err = cache.Get(ctx, &GetCacheRequest{Key: "instrument:a"})
+	assert.NoError(t, err)
+	_, err = cache.Get(ctx, &GetCacheRequest{Key: "instrument:missing"})
+	assert.ErrorIs(t, err, redis.Nil)
+
+	counters := map[string]float64{}
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := ""
+			for _, label := range metric.GetLabel() {
+				labels += "," + label.GetName() + "=" + label.GetValue()
+			}
+			if metric.GetCounter() != nil {
+				counters[family.GetName()+labels] = metric.GetCounter().GetValue()
+			}
+		}
+	}
+	assert.Equal(t, float64(1), counters["cache_hits_total,method=get,prefix=test:instrument:"])
+	assert.Equal(t, float64(1), counters["cache_misses_total,method=get,prefix=test:instrument:"])
+	assert.Equal(t, float64(1), counters["redis_commands_total,command=get,status=nil"])
+	assert.Equal(t, float64(1), counters["redis_commands_total,command=set,status=ok"])
+
+	assert.Contains(t, output.String(), "slow redis command")
+	assert.Contains(t, output.String(), `"X-Trace-Id":"trace-1"`)
+	assert.Contains(t, output.String(), `"prefix":"test:instrument:"`)
+
+	assert.Error(t, cache.Instrument(&InstrumentOptions{Registerer: registry}))
+
+	assert.Equal(t, "test:user:", cache.keyLabel("test:user:1:orders"))
+	assert.Equal(t, "test:", cache.keyLabel("test:user"))
+	assert.Equal(t, "other:", cache.keyLabel("other:user:1"))
+}
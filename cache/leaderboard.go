@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/trumanwong/go-tools/helper"
+)
+
+// LeaderboardOptions is a struct that represents the options of a Leaderboard.
+// It contains the name of the leaderboard, the period of periodic leaderboards and how long they are kept,
+// the order of the scores, and an optional custom prefix.
+type LeaderboardOptions struct {
+	Name string
+	// Period makes the leaderboard start over every day, week, month or year, as computed by helper.GetIntervalTime.
+	// Each period is stored in its own sorted set. Nil keeps a single all-time leaderboard.
+	Period *helper.IntervalTimeType
+	// Retention is how long a periodic leaderboard is kept after its period ended.
+	// Defaults to the length of the period, so that the previous period can still be read.
+	Retention time.Duration
+	// Ascending ranks the lowest scores first, for example for completion times.
+	Ascending bool
+	Prefix    *string
+}
+
+// LeaderboardEntry is a struct that represents a member of a Leaderboard.
+// It contains the member, its score, and its rank starting at 1.
+// Members with the same score have the same rank, and the next rank is skipped ("1224" ranking).
+type LeaderboardEntry struct {
+	Member string
+	Score  float64
+	Rank   int64
+}
+
+// Leaderboard ranks members by score in a Redis sorted set.
+type Leaderboard struct {
+	cache     *Cache
+	name      string
+	period    *helper.IntervalTimeType
+	retention time.Duration
+	ascending bool
+	at        time.Time
+}
+
+// NewLeaderboard is a function that creates a new Leaderboard.
+// It takes a pointer to a Cache and a pointer to a LeaderboardOptions struct,
+// and returns a pointer to the created Leaderboard.
+func NewLeaderboard(c *Cache, options *LeaderboardOptions) *Leaderboard {
+	return &Leaderboard{
+		cache:     c,
+		name:      c.prefixKey(options.Name, options.Prefix),
+		period:    options.Period,
+		retention: options.Retention,
+		ascending: options.Ascending,
+	}
+}
+
+// At is a method of Leaderboard that returns a copy of the leaderboard for the period containing t,
+// for example the previous day of a daily leaderboard. It has no effect on an all-time leaderboard.
+func (l *Leaderboard) At(t time.Time) *Leaderboard {
+	board := *l
+	board.at = t
+	return &board
+}
+
+// key returns the sorted set of the current period and the time at which it expires,
+// which is zero for an all-time leaderboard.
+func (l *Leaderboard) key() (string, time.Time) {
+	if l.period == nil {
+		return l.name, time.Time{}
+	}
+	at := l.at
+	if at.IsZero() {
+		at = time.Now()
+	}
+	interval := helper.GetIntervalTime(&helper.GetIntervalTimeRequest{Time: at, Type: *l.period})
+	retention := l.retention
+	if retention <= 0 {
+		retention = interval.EndAt.Sub(interval.StartAt) + time.Second
+	}
+	return l.name + ":" + interval.StartAt.Format("20060102"), interval.EndAt.Add(retention)
+}
+
+// write runs a command on the sorted set of the current period and refreshes its expiration time.
+func (l *Leaderboard) write(ctx context.Context, fn func(pipe redis.Pipeliner, key string)) error {
+	key, expireAt := l.key()
+	_, err := l.cache.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		fn(pipe, key)
+		if !expireAt.IsZero() {
+			pipe.ExpireAt(ctx, key, expireAt)
+		}
+		return nil
+	})
+	return err
+}
+
+// Add is a method of Leaderboard that sets the score of a member.
+// It takes a context, the member and its score, and returns an error.
+// The method uses the Redis ZADD command.
+func (l *Leaderboard) Add(ctx context.Context, member string, score float64) error {
+	return l.write(ctx, func(pipe redis.Pipeliner, key string) {
+		pipe.ZAdd(ctx, key, redis.Z{Score: score, Member: member})
+	})
+}
+
+// IncrBy is a method of Leaderboard that increments the score of a member, adding the member if needed.
+// It takes a context, the member and the increment, and returns the new score and an error.
+// The method uses the Redis ZINCRBY command.
+func (l *Leaderboard) IncrBy(ctx context.Context, member string, value float64) (float64, error) {
+	var cmd *redis.FloatCmd
+	err := l.write(ctx, func(pipe redis.Pipeliner, key string) {
+		cmd = pipe.ZIncrBy(ctx, key, value, member)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return cmd.Val(), nil
+}
+
+// Remove is a method of Leaderboard that removes members.
+// The method uses the Redis ZREM command.
+func (l *Leaderboard) Remove(ctx context.Context, members ...string) error {
+	key, _ := l.key()
+	values := make([]any, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+	return l.cache.client.ZRem(ctx, key, values...).Err()
+}
+
+// Count is a method of Leaderboard that gets the number of members.
+// The method uses the Redis ZCARD command.
+func (l *Leaderboard) Count(ctx context.Context) (int64, error) {
+	key, _ := l.key()
+	return l.cache.client.ZCard(ctx, key).Result()
+}
+
+// Rank is a method of Leaderboard that gets the score and rank of a member.
+// It takes a context and the member, and returns a pointer to a LeaderboardEntry and an error.
+// If the member does not exist, the error is redis.Nil.
+// The method uses the Redis ZSCORE and ZCOUNT commands.
+func (l *Leaderboard) Rank(ctx context.Context, member string) (*LeaderboardEntry, error) {
+	key, _ := l.key()
+	score, err := l.cache.client.ZScore(ctx, key, member).Result()
+	if err != nil {
+		return nil, err
+	}
+	better, err := l.countBetter(ctx, key, score)
+	if err != nil {
+		return nil, err
+	}
+	return &LeaderboardEntry{Member: member, Score: score, Rank: better + 1}, nil
+}
+
+// Top is a method of Leaderboard that gets the n best members with their scores and ranks.
+// Members with the same score as the last one may be left out.
+// The method uses the Redis ZRANGE command with WITHSCORES.
+func (l *Leaderboard) Top(ctx context.Context, n int64) ([]LeaderboardEntry, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	key, _ := l.key()
+	return l.entries(ctx, key, 0, n-1)
+}
+
+// Around is a method of Leaderboard that gets a member together with the n members ranked right above
+// and the n members ranked right below it, with their scores and ranks.
+// If the member does not exist, the error is redis.Nil.
+// The method uses the Redis ZRANK and ZRANGE commands.
+func (l *Leaderboard) Around(ctx context.Context, member string, n int64) ([]LeaderboardEntry, error) {
+	key, _ := l.key()
+	var index int64
+	var err error
+	if l.ascending {
+		index, err = l.cache.client.ZRank(ctx, key, member).Result()
+	} else {
+		index, err = l.cache.client.ZRevRank(ctx, key, member).Result()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return l.entries(ctx, key, max(index-n, 0), index+n)
+}
+
+// entries gets the members between two indexes and computes their ranks,
+// giving members with the same score the same rank.
+func (l *Leaderboard) entries(ctx context.Context, key string, start, stop int64) ([]LeaderboardEntry, error) {
+	members, err := l.cache.client.ZRangeArgsWithScores(ctx, redis.ZRangeArgs{
+		Key:   key,
+		Start: start,
+		Stop:  stop,
+		Rev:   !l.ascending,
+	}).Result()
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+	// Only the first member may share its score with members before the range.
+	better, err := l.countBetter(ctx, key, members[0].Score)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]LeaderboardEntry, len(members))
+	for i, member := range members {
+		rank := better + 1
+		if i > 0 {
+			rank = start + int64(i) + 1
+			if member.Score == members[i-1].Score {
+				rank = entries[i-1].Rank
+			}
+		}
+		entries[i] = LeaderboardEntry{Member: member.Member.(string), Score: member.Score, Rank: rank}
+	}
+	return entries, nil
+}
+
+// countBetter counts the members with a strictly better score.
+func (l *Leaderboard) countBetter(ctx context.Context, key string, score float64) (int64, error) {
+	bound := "(" + strconv.FormatFloat(score, 'f', -1, 64)
+	if l.ascending {
+		return l.cache.client.ZCount(ctx, key, "-inf", bound).Result()
+	}
+	return l.cache.client.ZCount(ctx, key, bound, "+inf").Result()
+}
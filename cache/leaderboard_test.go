@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trumanwong/go-tools/helper"
+)
+
+func TestLeaderboard(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+	_, _ = cache.Delete(ctx, &DeleteRequest{Key: "leaderboard"})
+
+	board := NewLeaderboard(cache, &LeaderboardOptions{Name: "leaderboard"})
+	for member, score := range map[string]float64{"a": 100, "b": 90, "c": 90, "d": 80, "e": 70} {
+		assert.NoError(t, board.Add(ctx, member, score))
+	}
+	score, err := board.IncrBy(ctx, "e", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(80), score)
+
+	top, err := board.Top(ctx, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []LeaderboardEntry{
+		{Member: "a", Score: 100, Rank: 1},
+		{Member: "c", Score: 90, Rank: 2},
+		{Member: "b", Score: 90, Rank: 2},
+	}, top)
+
+	entry, err := board.Rank(ctx, "d")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), entry.Rank)
+
+	around, err := board.Around(ctx, "b", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []LeaderboardEntry{
+		{Member: "c", Score: 90, Rank: 2},
+		{Member: "b", Score: 90, Rank: 2},
+		{Member: "e", Score: 80, Rank: 4},
+	}, around)
+
+	scores, err := cache.ZRevRangeWithScores(ctx, &ZRangeRequest{Key: "leaderboard", Start: 0, End: 0})
+	assert.NoError(t, err)
+	assert.Equal(t, float64(100), scores[0].Score)
+}
+
+func TestLeaderboard_Period(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+	period := helper.Day
+	board := NewLeaderboard(cache, &LeaderboardOptions{Name: "daily", Period: &period, Ascending: true})
+	yesterday := board.At(time.Now().AddDate(0, 0, -1))
+	key, _ := board.key()
+	previousKey, _ := yesterday.key()
+	_, _ = cache.client.Del(ctx, key, previousKey).Result()
+
+	assert.NoError(t, board.Add(ctx, "a", 30))
+	assert.NoError(t, board.Add(ctx, "b", 20))
+	assert.NoError(t, yesterday.Add(ctx, "c", 10))
+
+	top, err := board.Top(ctx, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []LeaderboardEntry{{Member: "b", Score: 20, Rank: 1}, {Member: "a", Score: 30, Rank: 2}}, top)
+	count, err := yesterday.Count(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	assert.Equal(t, "test:daily:"+time.Now().Format("20060102"), key)
+	ttl, err := cache.client.TTL(ctx, key).Result()
+	assert.NoError(t, err)
+	assert.Greater(t, ttl, 24*time.Hour)
+	assert.LessOrEqual(t, ttl, 48*time.Hour)
+}
@@ -0,0 +1,233 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LocalCacheOptions is a struct that represents the options of the in-process cache tier.
+// It contains the maximum number of entries, the maximum time an entry is kept,
+// and the Pub/Sub channel used to broadcast invalidations to other processes.
+type LocalCacheOptions struct {
+	// Size is the maximum number of entries. The least recently used entry is evicted first.
+	// Defaults to 10000.
+	Size int
+	// TTL is the maximum time an entry is kept locally, even if the Redis key lives longer.
+	// It bounds how stale a value can get if an invalidation message is lost. Defaults to one minute.
+	TTL time.Duration
+	// Channel is the Pub/Sub channel for invalidations. Defaults to the cache prefix + "cache:invalidate".
+	Channel string
+}
+
+const (
+	defaultLocalCacheSize = 10000
+	defaultLocalCacheTTL  = time.Minute
+)
+
+// Stats is a struct that represents the hit and miss counters of each cache tier.
+type Stats struct {
+	LocalHits   uint64
+	LocalMisses uint64
+	RedisHits   uint64
+	RedisMisses uint64
+}
+
+type stats struct {
+	localHits   atomic.Uint64
+	localMisses atomic.Uint64
+	redisHits   atomic.Uint64
+	redisMisses atomic.Uint64
+}
+
+// invalidateMessage is the payload published when keys are written or deleted.
+type invalidateMessage struct {
+	Node string   `json:"node"`
+	Keys []string `json:"keys"`
+}
+
+type localEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+// localCache is a bounded LRU cache with a TTL per entry.
+type localCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	items   map[string]*list.Element
+	order   *list.List
+	node    string
+	channel string
+	// generation is incremented on every invalidation, so that a value read from Redis
+	// before an invalidation arrived is not stored locally after it.
+	generation atomic.Uint64
+}
+
+func newLocalCache(size int, ttl time.Duration) *localCache {
+	return &localCache{
+		size:  size,
+		ttl:   ttl,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+		node:  uuid.New().String(),
+	}
+}
+
+func (l *localCache) get(key string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elem, ok := l.items[key]
+	if !ok {
+		return "", false
+	}
+	entry := elem.Value.(*localEntry)
+	if time.Now().After(entry.expiresAt) {
+		l.order.Remove(elem)
+		delete(l.items, key)
+		return "", false
+	}
+	l.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// set stores a value if no invalidation happened since generation was read, until the cache TTL
+// or the expiration of the key in Redis, whichever comes first.
+// keyTTL is the PTTL of the key: -1 if it does not expire, -2 if it is gone.
+func (l *localCache) set(key, value string, generation uint64, keyTTL time.Duration) {
+	ttl := l.ttl
+	if keyTTL != -1 && keyTTL < ttl {
+		ttl = keyTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.generation.Load() != generation {
+		return
+	}
+	expiresAt := time.Now().Add(ttl)
+	if elem, ok := l.items[key]; ok {
+		entry := elem.Value.(*localEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		l.order.MoveToFront(elem)
+		return
+	}
+	l.items[key] = l.order.PushFront(&localEntry{key: key, value: value, expiresAt: expiresAt})
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*localEntry).key)
+	}
+}
+
+func (l *localCache) delete(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.generation.Add(1)
+	for _, key := range keys {
+		if elem, ok := l.items[key]; ok {
+			l.order.Remove(elem)
+			delete(l.items, key)
+		}
+	}
+}
+
+func (l *localCache) purge() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.generation.Add(1)
+	l.items = make(map[string]*list.Element)
+	l.order.Init()
+}
+
+// EnableLocalCache is a method of Cache that puts a bounded in-process LRU cache in front of Redis for Get.
+// It takes a context and a pointer to a LocalCacheOptions struct, and returns an error.
+//
+// Keys written or deleted through Set, Delete, Inc, IncrBy and SetNX are dropped locally and an
+// invalidation is published on the options channel, so that other processes drop their copy too.
+// The subscription runs until the context is done, after which the local tier is disabled.
+func (c *Cache) EnableLocalCache(ctx context.Context, options *LocalCacheOptions) error {
+	channel := options.Channel
+	if channel == "" {
+		channel = c.prefix + "cache:invalidate"
+	}
+	size := options.Size
+	if size <= 0 {
+		size = defaultLocalCacheSize
+	}
+	ttl := options.TTL
+	if ttl <= 0 {
+		ttl = defaultLocalCacheTTL
+	}
+	local := newLocalCache(size, ttl)
+	local.channel = channel
+
+	pubSub := c.Subscribe(ctx, &SubscribeRequest{Channels: channel})
+	// Wait for the subscription to be confirmed so that no invalidation is missed.
+	if _, err := pubSub.Receive(ctx); err != nil {
+		_ = pubSub.Close()
+		return err
+	}
+	c.local.Store(local)
+
+	go func() {
+		defer pubSub.Close()
+		messages := pubSub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				c.local.CompareAndSwap(local, nil)
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				var invalidate invalidateMessage
+				if err := json.Unmarshal([]byte(message.Payload), &invalidate); err != nil {
+					// An unreadable message may hide an invalidation, so drop everything.
+					local.purge()
+					continue
+				}
+				if invalidate.Node != local.node {
+					local.delete(invalidate.Keys...)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// invalidateLocal drops prefixed keys from the local tier and broadcasts the invalidation.
+func (c *Cache) invalidateLocal(ctx context.Context, keys ...string) error {
+	local := c.local.Load()
+	if local == nil || len(keys) == 0 {
+		return nil
+	}
+	local.delete(keys...)
+	message, err := json.Marshal(&invalidateMessage{Node: local.node, Keys: keys})
+	if err != nil {
+		return err
+	}
+	_, err = c.Publish(ctx, &PublishRequest{Channel: local.channel, Message: message})
+	return err
+}
+
+// Stats is a method of Cache that returns the hit and miss counters of the local and Redis tiers for Get.
+func (c *Cache) Stats() Stats {
+	return Stats{
+		LocalHits:   c.stats.localHits.Load(),
+		LocalMisses: c.stats.localMisses.Load(),
+		RedisHits:   c.stats.redisHits.Load(),
+		RedisMisses: c.stats.redisMisses.Load(),
+	}
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalCache_LRU(t *testing.T) {
+	local := newLocalCache(2, time.Minute)
+	local.set("a", "1", 0, -1)
+	local.set("b", "2", 0, -1)
+	_, _ = local.get("a")
+	local.set("c", "3", 0, -1)
+
+	_, ok := local.get("b")
+	assert.False(t, ok)
+	value, ok := local.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", value)
+
+	generation := local.generation.Load()
+	local.delete("a")
+	local.set("a", "stale", generation, -1)
+	_, ok = local.get("a")
+	assert.False(t, ok)
+
+	// The local copy does not outlive the key in Redis
+	local.set("short", "1", local.generation.Load(), 20*time.Millisecond)
+	_, ok = local.get("short")
+	assert.True(t, ok)
+	time.Sleep(30 * time.Millisecond)
+	_, ok = local.get("short")
+	assert.False(t, ok)
+	local.set("gone", "1", local.generation.Load(), -2)
+	_, ok = local.get("gone")
+	assert.False(t, ok)
+}
+
+func TestCache_EnableLocalCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	writer := newTestCache(t, "test:")
+	reader := newTestCache(t, "test:")
+	assert.NoError(t, writer.EnableLocalCache(ctx, &LocalCacheOptions{Size: 100, TTL: time.Minute}))
+	assert.NoError(t, reader.EnableLocalCache(ctx, &LocalCacheOptions{Size: 100, TTL: time.Minute}))
+
+	assert.NoError(t, writer.Set(ctx, &SetCacheRequest{Key: "local", Value: []byte("1"), Seconds: 60}))
+	// Wait for the invalidation of the first write to reach the reader, so that it does not drop the value read below.
+	local := reader.local.Load()
+	assert.Eventually(t, func() bool {
+		return local.generation.Load() > 0
+	}, time.Second, 10*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		value, err := reader.Get(ctx, &GetCacheRequest{Key: "local"})
+		assert.NoError(t, err)
+		assert.Equal(t, "1", value)
+	}
+	stats := reader.Stats()
+	assert.Equal(t, uint64(2), stats.LocalHits)
+	assert.Equal(t, uint64(1), stats.LocalMisses)
+	assert.Equal(t, uint64(1), stats.RedisHits)
+
+	assert.NoError(t, writer.Set(ctx, &SetCacheRequest{Key: "local", Value: []byte("2"), Seconds: 60}))
+	assert.Eventually(t, func() bool {
+		value, err := reader.Get(ctx, &GetCacheRequest{Key: "local"})
+		return err == nil && value == "2"
+	}, time.Second, 10*time.Millisecond)
+
+	_, err := writer.Delete(ctx, &DeleteRequest{Key: "local"})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := reader.Get(ctx, &GetCacheRequest{Key: "local"})
+		return IsMiss(err)
+	}, time.Second, 10*time.Millisecond)
+	assert.NotZero(t, reader.Stats().RedisMisses)
+}
+
+func TestCache_LocalCachePipelinedExpire(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := newTestCache(t, "test:")
+	assert.NoError(t, cache.EnableLocalCache(ctx, &LocalCacheOptions{Size: 100, TTL: time.Minute}))
+	assert.NoError(t, cache.Set(ctx, &SetCacheRequest{Key: "local-expire", Value: []byte("1"), Seconds: 60}))
+	local := cache.local.Load()
+	assert.Eventually(t, func() bool {
+		return local.generation.Load() > 0
+	}, time.Second, 10*time.Millisecond)
+	value, err := cache.Get(ctx, &GetCacheRequest{Key: "local-expire"})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+
+	// Shortening the TTL in a pipeline drops the local copy, which was capped at the old TTL
+	_, err = cache.Pipelined(ctx, func(pipe *Pipeline) error {
+		pipe.Expire(ctx, &ExpireRequest{Key: "local-expire", Seconds: 1})
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := cache.Get(ctx, &GetCacheRequest{Key: "local-expire"})
+		return IsMiss(err)
+	}, 3*time.Second, 50*time.Millisecond)
+}
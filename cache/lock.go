@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrLockNotObtained is returned when the lock is held by someone else.
+	ErrLockNotObtained = errors.New("cache: lock not obtained")
+	// ErrLockNotHeld is returned when releasing or extending a lock that expired or was taken over.
+	ErrLockNotHeld = errors.New("cache: lock not held")
+)
+
+const (
+	defaultLockRetryDelay    = 50 * time.Millisecond
+	defaultLockMaxRetryDelay = time.Second
+)
+
+// releaseLockScript deletes the lock key only if it still holds the caller's token.
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// extendLockScript resets the TTL of the lock key only if it still holds the caller's token.
+var extendLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// LockRequest is a struct that represents a request to obtain a distributed lock.
+// It contains the key of the lock, the TTL in seconds, an optional token identifying the holder,
+// the retry delays used by Lock, whether to run a watchdog, and an optional custom prefix.
+type LockRequest struct {
+	Key string
+	// Seconds is the TTL of the lock. Defaults to 10.
+	Seconds int64
+	// Token identifies the holder. A random token is generated if it is empty.
+	Token string
+	// RetryDelay is the first delay between attempts of Lock. It doubles up to MaxRetryDelay.
+	// Defaults to 50ms and 1s.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// Watchdog keeps extending the lock every third of its TTL until it is released.
+	Watchdog bool
+	Prefix   *string
+}
+
+// Lock is a distributed lock held in Redis.
+// It is released and extended only if the key still holds its token.
+type Lock struct {
+	cache *Cache
+	key   string
+	token string
+
+	// mu guards ttl, which Extend changes while the watchdog reads it.
+	mu  sync.Mutex
+	ttl time.Duration
+	// extended wakes the watchdog up when Extend changes the TTL.
+	extended chan struct{}
+
+	once sync.Once
+	stop chan struct{}
+	lost chan struct{}
+}
+
+// TryLock is a method of Cache that tries to obtain a distributed lock once.
+// It takes a context and a pointer to a LockRequest struct,
+// and returns a pointer to the Lock and an error.
+// If the lock is held by someone else, the error is ErrLockNotObtained.
+// The method uses the Redis SET NX PX command to obtain the lock.
+func (c *Cache) TryLock(ctx context.Context, request *LockRequest) (*Lock, error) {
+	token := request.Token
+	if token == "" {
+		token = uuid.New().String()
+	}
+	seconds := request.Seconds
+	if seconds <= 0 {
+		seconds = defaultLockSeconds
+	}
+	lock, err := c.obtainLock(ctx, c.prefixKey(request.Key, request.Prefix), token, time.Duration(seconds)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if request.Watchdog {
+		go lock.watchdog()
+	}
+	return lock, nil
+}
+
+// Lock is a method of Cache that obtains a distributed lock, waiting until it is free.
+// It takes a context and a pointer to a LockRequest struct,
+// and returns a pointer to the Lock and an error.
+// The method retries with exponential backoff until the lock is obtained or the context is done.
+func (c *Cache) Lock(ctx context.Context, request *LockRequest) (*Lock, error) {
+	delay := request.RetryDelay
+	if delay <= 0 {
+		delay = defaultLockRetryDelay
+	}
+	maxDelay := request.MaxRetryDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultLockMaxRetryDelay
+	}
+	for {
+		lock, err := c.TryLock(ctx, request)
+		if !errors.Is(err, ErrLockNotObtained) {
+			return lock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxDelay)
+	}
+}
+
+// obtainLock sets the prefixed lock key to token if it does not exist.
+func (c *Cache) obtainLock(ctx context.Context, key, token string, ttl time.Duration) (*Lock, error) {
+	ok, err := c.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, &BackendError{Op: "setnx", Key: key, Err: err}
+	}
+	if !ok {
+		return nil, ErrLockNotObtained
+	}
+	return &Lock{
+		cache:    c,
+		key:      key,
+		token:    token,
+		ttl:      ttl,
+		extended: make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		lost:     make(chan struct{}),
+	}, nil
+}
+
+// Key returns the prefixed key of the lock.
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token returns the token identifying the holder of the lock.
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Lost returns a channel that is closed when the watchdog finds out that the lock is no longer held.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release is a method of Lock that releases the lock if it is still held.
+// It takes a context and returns an error.
+// If the lock expired or was taken over, the error is ErrLockNotHeld.
+func (l *Lock) Release(ctx context.Context) error {
+	l.once.Do(func() {
+		close(l.stop)
+	})
+	res, err := releaseLockScript.Run(ctx, l.cache.client, []string{l.key}, l.token).Int64()
+	if err != nil {
+		return &BackendError{Op: "release", Key: l.key, Err: err}
+	}
+	if res == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Extend is a method of Lock that resets the TTL of the lock if it is still held.
+// It takes a context and the new TTL in seconds, using the current TTL if it is zero, and returns an error.
+// A new TTL replaces the current one, so that the watchdog keeps extending the lock by it.
+// If the lock expired or was taken over, the error is ErrLockNotHeld.
+func (l *Lock) Extend(ctx context.Context, seconds int64) error {
+	ttl := l.getTTL()
+	if seconds > 0 {
+		ttl = time.Duration(seconds) * time.Second
+	}
+	res, err := extendLockScript.Run(ctx, l.cache.client, []string{l.key}, l.token, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return &BackendError{Op: "extend", Key: l.key, Err: err}
+	}
+	if res == 0 {
+		return ErrLockNotHeld
+	}
+	if seconds > 0 {
+		l.mu.Lock()
+		l.ttl = ttl
+		l.mu.Unlock()
+		select {
+		case l.extended <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (l *Lock) getTTL() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ttl
+}
+
+// watchdog extends the lock every third of its TTL until it is released or lost.
+// Backend errors are retried on the next tick, since the lock may still be held.
+func (l *Lock) watchdog() {
+	ticker := time.NewTicker(l.getTTL() / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-l.extended:
+			ticker.Reset(l.getTTL() / 3)
+			continue
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), l.getTTL()/3)
+		err := l.Extend(ctx, 0)
+		cancel()
+		if errors.Is(err, ErrLockNotHeld) {
+			close(l.lost)
+			return
+		}
+	}
+}
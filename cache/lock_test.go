@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_TryLock(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+
+	lock, err := cache.TryLock(ctx, &LockRequest{Key: "lock", Seconds: 10})
+	assert.NoError(t, err)
+	_, err = cache.TryLock(ctx, &LockRequest{Key: "lock", Seconds: 10})
+	assert.True(t, errors.Is(err, ErrLockNotObtained))
+
+	assert.NoError(t, lock.Extend(ctx, 20))
+	assert.NoError(t, lock.Release(ctx))
+	assert.True(t, errors.Is(lock.Release(ctx), ErrLockNotHeld))
+	assert.True(t, errors.Is(lock.Extend(ctx, 0), ErrLockNotHeld))
+}
+
+func TestCache_Lock(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+
+	lock, err := cache.TryLock(ctx, &LockRequest{Key: "lock-wait", Seconds: 10})
+	assert.NoError(t, err)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_ = lock.Release(ctx)
+	}()
+	other, err := cache.Lock(ctx, &LockRequest{Key: "lock-wait", Seconds: 10})
+	assert.NoError(t, err)
+	assert.NotEqual(t, lock.Token(), other.Token())
+	assert.NoError(t, other.Release(ctx))
+
+	lock, err = cache.TryLock(ctx, &LockRequest{Key: "lock-wait", Seconds: 10})
+	assert.NoError(t, err)
+	defer lock.Release(ctx)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	_, err = cache.Lock(timeoutCtx, &LockRequest{Key: "lock-wait", Seconds: 10})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestCache_LockWatchdog(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+
+	lock, err := cache.TryLock(ctx, &LockRequest{Key: "lock-watchdog", Seconds: 1, Watchdog: true})
+	assert.NoError(t, err)
+	time.Sleep(1500 * time.Millisecond)
+	_, err = cache.TryLock(ctx, &LockRequest{Key: "lock-watchdog", Seconds: 1})
+	assert.True(t, errors.Is(err, ErrLockNotObtained))
+
+	_, err = cache.Delete(ctx, &DeleteRequest{Key: "lock-watchdog"})
+	assert.NoError(t, err)
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("watchdog did not report the lost lock")
+	}
+}
+
+func TestCache_LockWatchdogExtend(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+
+	lock, err := cache.TryLock(ctx, &LockRequest{Key: "lock-watchdog-extend", Seconds: 1, Watchdog: true})
+	assert.NoError(t, err)
+	defer lock.Release(ctx)
+	assert.NoError(t, lock.Extend(ctx, 60))
+	// The watchdog would have extended the lock by its original TTL by now
+	time.Sleep(500 * time.Millisecond)
+	ttl, err := cache.TTL(ctx, &TTLRequest{Key: "lock-watchdog-extend"})
+	assert.NoError(t, err)
+	assert.Greater(t, ttl, 50*time.Second)
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/trumanwong/go-tools/log"
+)
+
+// LogLevelsOptions is a struct that represents the options of the runtime control of the log levels.
+// It contains the logger whose levels are changed and the Pub/Sub channel of the changes.
+type LogLevelsOptions struct {
+	Logger *log.Logger
+	// Channel is the Pub/Sub channel of the level changes. Defaults to the cache prefix + "log:levels".
+	Channel string
+}
+
+func (c *Cache) logLevelsChannel(channel string) string {
+	if channel == "" {
+		return c.prefix + "log:levels"
+	}
+	return channel
+}
+
+// WatchLogLevels is a method of Cache that applies the log level changes published on the options channel,
+// so that the levels of every process can be changed at once, see PublishLogLevel.
+// The messages are log.LevelChange in JSON. The subscription runs until the context is done.
+func (c *Cache) WatchLogLevels(ctx context.Context, options *LogLevelsOptions) error {
+	if options.Logger == nil {
+		return errors.New("cache: the logger of the log levels is nil")
+	}
+	logger := options.Logger
+	pubSub := c.Subscribe(ctx, &SubscribeRequest{Channels: c.logLevelsChannel(options.Channel)})
+	// Wait for the subscription to be confirmed so that no change is missed.
+	if _, err := pubSub.Receive(ctx); err != nil {
+		_ = pubSub.Close()
+		return err
+	}
+
+	go func() {
+		defer pubSub.Close()
+		messages := pubSub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				var change log.LevelChange
+				err := json.Unmarshal([]byte(message.Payload), &change)
+				if err == nil {
+					err = logger.SetModuleLevel(change.Module, change.Level)
+				}
+				if err != nil {
+					logger.WithError(err).Warnf("invalid log level change %q", message.Payload)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// PublishLogLevel is a method of Cache that publishes a log level change to the processes watching the channel.
+// It returns the number of processes that received it.
+func (c *Cache) PublishLogLevel(ctx context.Context, options *LogLevelsOptions, change *log.LevelChange) (int64, error) {
+	message, err := json.Marshal(change)
+	if err != nil {
+		return 0, err
+	}
+	return c.Publish(ctx, &PublishRequest{Channel: c.logLevelsChannel(options.Channel), Message: message})
+}
@@ -0,0 +1,33 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/trumanwong/go-tools/log"
+)
+
+func TestCache_WatchLogLevels(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := newTestCache(t, "test:")
+	logger := log.NewLogger(&log.Options{Output: io.Discard})
+	orders := logger.Named("orders")
+	options := &LogLevelsOptions{Logger: logger}
+	assert.NoError(t, c.WatchLogLevels(ctx, options))
+
+	received, err := c.PublishLogLevel(ctx, options, &log.LevelChange{Module: "orders", Level: "debug"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), received)
+	assert.Eventually(t, func() bool {
+		return orders.GetLevel() == logrus.DebugLevel
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, logrus.InfoLevel, logger.GetLevel())
+
+	assert.Error(t, c.WatchLogLevels(ctx, &LogLevelsOptions{}))
+}
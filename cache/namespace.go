@@ -0,0 +1,234 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultBulkBatchSize = 100
+
+// BulkKeysRequest is a struct that represents a request to act on every key under a prefix that matches a pattern.
+// It contains the match pattern and type filter of ScanKeysRequest, the number of keys handled per batch,
+// the pause between batches, and an optional custom prefix.
+type BulkKeysRequest struct {
+	// Match is a glob-style pattern matched against the key without the prefix. Defaults to "*".
+	Match string
+	// Type filters keys by their Redis type, such as "string" or "zset".
+	Type string
+	// BatchSize is the number of keys sent to Redis at once. Defaults to 100.
+	BatchSize int64
+	// Pause is how long to wait after every batch, to limit the load on Redis. Zero disables the pause.
+	Pause  time.Duration
+	Prefix *string
+}
+
+// DeleteKeys is a method of Cache that deletes every key under the prefix that matches a pattern.
+// It takes a context and a pointer to a BulkKeysRequest struct,
+// and returns the number of keys that were deleted as an int64 and an error.
+// The method uses the Redis SCAN command to find the keys and deletes them in batches.
+func (c *Cache) DeleteKeys(ctx context.Context, request *BulkKeysRequest) (int64, error) {
+	var deleted int64
+	err := c.scanBatches(ctx, request, func(keys []string) error {
+		n, err := c.del(ctx, keys)
+		deleted += n
+		if err != nil {
+			return err
+		}
+		return c.invalidateLocal(ctx, keys...)
+	})
+	return deleted, err
+}
+
+// ExpireKeysRequest is a struct that represents a request to set the expiration time of several keys.
+// It contains the keys to match, the expiration time in seconds,
+// and whether only the keys without an expiration time are updated.
+type ExpireKeysRequest struct {
+	BulkKeysRequest
+	Seconds int64
+	// OnlyPersistent leaves the keys that already have an expiration time unchanged.
+	OnlyPersistent bool
+}
+
+// ExpireKeys is a method of Cache that sets the expiration time of every key under the prefix that matches a pattern.
+// It takes a context and a pointer to an ExpireKeysRequest struct,
+// and returns the number of keys that were updated as an int64 and an error.
+// The method uses the Redis SCAN command to find the keys and pipelines one EXPIRE command per key,
+// with the NX option if OnlyPersistent is set.
+func (c *Cache) ExpireKeys(ctx context.Context, request *ExpireKeysRequest) (int64, error) {
+	expiration := time.Duration(request.Seconds) * time.Second
+	var updated int64
+	err := c.scanBatches(ctx, &request.BulkKeysRequest, func(keys []string) error {
+		cmds := make([]*redis.BoolCmd, len(keys))
+		_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				if request.OnlyPersistent {
+					cmds[i] = pipe.ExpireNX(ctx, key, expiration)
+				} else {
+					cmds[i] = pipe.Expire(ctx, key, expiration)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, cmd := range cmds {
+			if cmd.Val() {
+				updated++
+			}
+		}
+		return c.invalidateLocal(ctx, keys...)
+	})
+	return updated, err
+}
+
+// KeyInfo is a struct that represents the details of a key in a KeyReport.
+// It contains the key without its prefix, its Redis type, its memory usage in bytes,
+// and its time to live, which is -1 if the key does not expire.
+type KeyInfo struct {
+	Key  string
+	Type string
+	Size int64
+	TTL  time.Duration
+}
+
+// KeyReport is a struct that represents the result of Cache.KeyReport.
+// It contains the number and total memory usage of the matched keys, the same for the keys without an
+// expiration time, the number of keys and bytes per type, and the largest keys.
+type KeyReport struct {
+	Keys           int64
+	Size           int64
+	PersistentKeys int64
+	PersistentSize int64
+	TypeKeys       map[string]int64
+	TypeSize       map[string]int64
+	// Largest holds the largest keys, sorted by decreasing size.
+	Largest []KeyInfo
+	// LargestPersistent holds the largest keys without an expiration time, sorted by decreasing size.
+	// These keys are never evicted by their TTL and are the usual cause of leaking memory.
+	LargestPersistent []KeyInfo
+}
+
+// KeyReportRequest is a struct that represents a request to build a KeyReport.
+// It contains the keys to match and the number of keys kept in the largest keys lists.
+type KeyReportRequest struct {
+	BulkKeysRequest
+	// Top is the number of keys kept in Largest and LargestPersistent. Defaults to 10.
+	Top int
+}
+
+// KeyReport is a method of Cache that reports the memory usage and expiration times of every key
+// under the prefix that matches a pattern.
+// It takes a context and a pointer to a KeyReportRequest struct,
+// and returns a pointer to a KeyReport and an error.
+// The method uses the Redis SCAN command to find the keys and pipelines the TYPE, MEMORY USAGE and PTTL commands.
+// As SCAN may return a key more than once, the totals are approximate while keys are being added.
+func (c *Cache) KeyReport(ctx context.Context, request *KeyReportRequest) (*KeyReport, error) {
+	top := request.Top
+	if top <= 0 {
+		top = 10
+	}
+	prefix := c.prefixKey("", request.Prefix)
+	report := &KeyReport{TypeKeys: map[string]int64{}, TypeSize: map[string]int64{}}
+	err := c.scanBatches(ctx, &request.BulkKeysRequest, func(keys []string) error {
+		types := make([]*redis.StatusCmd, len(keys))
+		sizes := make([]*redis.IntCmd, len(keys))
+		ttls := make([]*redis.DurationCmd, len(keys))
+		_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				types[i] = pipe.Type(ctx, key)
+				sizes[i] = pipe.MemoryUsage(ctx, key)
+				ttls[i] = pipe.PTTL(ctx, key)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		for i, key := range keys {
+			// The key expired or was deleted since it was scanned.
+			if sizes[i].Err() != nil || ttls[i].Val() == -2 {
+				continue
+			}
+			info := KeyInfo{Key: key[len(prefix):], Type: types[i].Val(), Size: sizes[i].Val(), TTL: ttls[i].Val()}
+			report.Keys++
+			report.Size += info.Size
+			report.TypeKeys[info.Type]++
+			report.TypeSize[info.Type] += info.Size
+			report.Largest = appendLargest(report.Largest, info, top)
+			if info.TTL < 0 {
+				report.PersistentKeys++
+				report.PersistentSize += info.Size
+				report.LargestPersistent = appendLargest(report.LargestPersistent, info, top)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// appendLargest adds a key to a list sorted by decreasing size, keeping at most top keys.
+func appendLargest(keys []KeyInfo, info KeyInfo, top int) []KeyInfo {
+	i := sort.Search(len(keys), func(i int) bool {
+		return keys[i].Size < info.Size
+	})
+	if i >= top {
+		return keys
+	}
+	keys = append(keys, KeyInfo{})
+	copy(keys[i+1:], keys[i:])
+	keys[i] = info
+	if len(keys) > top {
+		keys = keys[:top]
+	}
+	return keys
+}
+
+// scanBatches scans the keys matched by a BulkKeysRequest and passes them with their prefix to fn in batches,
+// pausing after every batch.
+func (c *Cache) scanBatches(ctx context.Context, request *BulkKeysRequest, fn func(keys []string) error) error {
+	batchSize := request.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBulkBatchSize
+	}
+	batch := make([]string, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := fn(batch)
+		batch = batch[:0]
+		if err != nil || request.Pause <= 0 {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(request.Pause):
+			return nil
+		}
+	}
+	err := c.scan(ctx, &ScanKeysRequest{
+		Match:  request.Match,
+		Count:  batchSize,
+		Type:   request.Type,
+		Prefix: request.Prefix,
+	}, func(key string) error {
+		batch = append(batch, key)
+		if int64(len(batch)) < batchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_BulkKeys(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+	prefix := "test:namespace:"
+	_, _ = cache.DeleteKeys(ctx, &BulkKeysRequest{Prefix: &prefix})
+
+	for _, key := range []string{"a", "b", "c"} {
+		assert.NoError(t, cache.Set(ctx, &SetCacheRequest{Key: key, Value: []byte("value"), Prefix: &prefix}))
+	}
+	assert.NoError(t, cache.Set(ctx, &SetCacheRequest{Key: "d", Value: []byte("a longer value"), Seconds: 60, Prefix: &prefix}))
+
+	report, err := cache.KeyReport(ctx, &KeyReportRequest{BulkKeysRequest: BulkKeysRequest{Prefix: &prefix}, Top: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), report.Keys)
+	assert.Equal(t, int64(3), report.PersistentKeys)
+	assert.Equal(t, int64(4), report.TypeKeys["string"])
+	assert.Len(t, report.Largest, 2)
+	assert.Equal(t, "d", report.Largest[0].Key)
+	assert.Len(t, report.LargestPersistent, 2)
+	assert.Less(t, report.LargestPersistent[0].TTL, time.Duration(0))
+
+	updated, err := cache.ExpireKeys(ctx, &ExpireKeysRequest{
+		BulkKeysRequest: BulkKeysRequest{Prefix: &prefix, BatchSize: 2, Pause: time.Millisecond},
+		Seconds:         120,
+		OnlyPersistent:  true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), updated)
+	ttl, err := cache.TTL(ctx, &TTLRequest{Key: "d", Prefix: &prefix})
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, ttl, time.Minute)
+
+	deleted, err := cache.DeleteKeys(ctx, &BulkKeysRequest{Match: "[ab]", Prefix: &prefix, BatchSize: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	var keys []string
+	err = cache.ScanKeys(ctx, &ScanKeysRequest{Prefix: &prefix}, func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"c", "d"}, keys)
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitAlgorithm is a type that represents the algorithm used by a rate limit.
+type RateLimitAlgorithm int
+
+// Constants for the different rate limit algorithms.
+const (
+	// FixedWindow counts requests in consecutive windows of Period.
+	// It is the cheapest algorithm, but allows up to twice the limit around a window boundary.
+	FixedWindow RateLimitAlgorithm = iota
+	// SlidingWindow keeps a log of the requests of the last Period in a sorted set.
+	// It is exact, at the cost of memory proportional to Limit.
+	SlidingWindow
+	// TokenBucket uses the generic cell rate algorithm (GCRA): the quota refills continuously
+	// at Limit per Period, with bursts of up to Limit.
+	TokenBucket
+)
+
+var (
+	errUnknownRateLimitAlgorithm = errors.New("cache: unknown rate limit algorithm")
+	errInvalidRateLimit          = errors.New("cache: a rate limit needs a positive limit and a period of at least a millisecond")
+)
+
+// fixedWindowScript returns {allowed, remaining, retry after ms, reset after ms}.
+var fixedWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < 0 then
+	ttl = period
+end
+if current + cost > limit then
+	return {0, limit - current, ttl, ttl}
+end
+current = redis.call("INCRBY", KEYS[1], cost)
+if redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], period)
+end
+return {1, limit - current, 0, ttl}
+`)
+
+// slidingWindowScript returns {allowed, remaining, retry after ms, reset after ms}.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - period)
+local count = redis.call("ZCARD", KEYS[1])
+if count + cost > limit then
+	local retry = period
+	local index = count + cost - limit - 1
+	local entry = redis.call("ZRANGE", KEYS[1], index, index, "WITHSCORES")
+	if entry[2] then
+		retry = tonumber(entry[2]) + period - now
+	end
+	local reset = period
+	local last = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+	if last[2] then
+		reset = tonumber(last[2]) + period - now
+	end
+	return {0, limit - count, retry, reset}
+end
+for i = 1, cost do
+	redis.call("ZADD", KEYS[1], now, ARGV[4] .. ":" .. i)
+end
+redis.call("PEXPIRE", KEYS[1], period)
+return {1, limit - count - cost, 0, period}
+`)
+
+// tokenBucketScript implements GCRA and returns {allowed, remaining, retry after ms, reset after ms}.
+// The key holds the theoretical arrival time in milliseconds.
+var tokenBucketScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local emission = period / limit
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + tonumber(time[2]) / 1000
+local tat = tonumber(redis.call("GET", KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+local newTat = tat + emission * cost
+local diff = now - (newTat - period)
+if diff < 0 then
+	local remaining = math.floor((now - (tat - period)) / emission)
+	return {0, remaining, math.ceil(-diff), math.ceil(tat - now)}
+end
+local reset = math.ceil(newTat - now)
+redis.call("SET", KEYS[1], tostring(newTat), "PX", reset)
+return {1, math.floor(diff / emission), 0, reset}
+`)
+
+// RateLimitRequest is a struct that represents a request to consume quota from a rate limit.
+// It contains the key of the limit, the algorithm, the number of requests allowed per period,
+// the period, the cost of the request, and an optional custom prefix.
+type RateLimitRequest struct {
+	Key       string
+	Algorithm RateLimitAlgorithm
+	Limit     int64
+	Period    time.Duration
+	// Cost is the quota consumed by the request. Defaults to 1.
+	Cost   int64
+	Prefix *string
+}
+
+// RateLimitResult is a struct that represents the result of a rate limit check.
+// It contains whether the request is allowed, the limit, the remaining quota,
+// how long to wait before retrying a denied request, and how long until the quota is fully restored.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int64
+	Remaining  int64
+	RetryAfter time.Duration
+	ResetAfter time.Duration
+}
+
+// RateLimit is a method of Cache that atomically checks a rate limit and consumes quota if the request is allowed.
+// It takes a context and a pointer to a RateLimitRequest struct,
+// and returns a pointer to a RateLimitResult struct and an error.
+// Denied requests do not consume quota.
+// The method runs a Lua script, so that concurrent requests from any number of processes are counted exactly.
+func (c *Cache) RateLimit(ctx context.Context, request *RateLimitRequest) (*RateLimitResult, error) {
+	// The scripts divide the period by the limit
+	if request.Limit <= 0 || request.Period < time.Millisecond {
+		return nil, errInvalidRateLimit
+	}
+	cost := request.Cost
+	if cost <= 0 {
+		cost = 1
+	}
+	key := c.prefixKey(request.Key, request.Prefix)
+	args := []any{request.Limit, request.Period.Milliseconds(), cost}
+	var script *redis.Script
+	switch request.Algorithm {
+	case FixedWindow:
+		script = fixedWindowScript
+	case SlidingWindow:
+		script = slidingWindowScript
+		args = append(args, uuid.New().String())
+	case TokenBucket:
+		script = tokenBucketScript
+	default:
+		return nil, errUnknownRateLimitAlgorithm
+	}
+	res, err := script.Run(ctx, c.client, []string{key}, args...).Int64Slice()
+	if err != nil {
+		return nil, &BackendError{Op: "ratelimit", Key: key, Err: err}
+	}
+	return &RateLimitResult{
+		Allowed:    res[0] == 1,
+		Limit:      request.Limit,
+		Remaining:  max(res[1], 0),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+		ResetAfter: time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_RateLimit(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+
+	for name, algorithm := range map[string]RateLimitAlgorithm{
+		"fixed":   FixedWindow,
+		"sliding": SlidingWindow,
+		"bucket":  TokenBucket,
+	} {
+		key := "ratelimit:" + name
+		_, _ = cache.Delete(ctx, &DeleteRequest{Key: key})
+		request := &RateLimitRequest{Key: key, Algorithm: algorithm, Limit: 3, Period: time.Second}
+		for i := int64(0); i < 3; i++ {
+			res, err := cache.RateLimit(ctx, request)
+			assert.NoError(t, err, name)
+			assert.True(t, res.Allowed, name)
+			assert.Equal(t, 2-i, res.Remaining, name)
+		}
+		res, err := cache.RateLimit(ctx, request)
+		assert.NoError(t, err, name)
+		assert.False(t, res.Allowed, name)
+		assert.Equal(t, int64(0), res.Remaining, name)
+		assert.Greater(t, res.RetryAfter, time.Duration(0), name)
+		assert.LessOrEqual(t, res.RetryAfter, time.Second, name)
+
+		time.Sleep(res.RetryAfter + 50*time.Millisecond)
+		res, err = cache.RateLimit(ctx, request)
+		assert.NoError(t, err, name)
+		assert.True(t, res.Allowed, name)
+
+		_, err = cache.RateLimit(ctx, &RateLimitRequest{Key: key, Algorithm: algorithm, Period: time.Second})
+		assert.ErrorIs(t, err, errInvalidRateLimit, name)
+	}
+}
@@ -0,0 +1,256 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNotFound is returned by SafeRemember when the value is known not to exist.
+// A SafeRememberRequest callback returns ErrNotFound (or an error wrapping it) to signal
+// that the value does not exist, and the result is cached for NotFoundSeconds.
+var ErrNotFound = errors.New("cache: not found")
+
+// BackendError is returned when the Redis server could not be reached or answered with an error.
+// It allows callers to tell a backend failure apart from a cache miss.
+type BackendError struct {
+	Op  string
+	Key string
+	Err error
+}
+
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("cache: %s %s: %v", e.Op, e.Key, e.Err)
+}
+
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
+
+// IsMiss reports whether err means the key is not in the cache or the value is known not to exist.
+func IsMiss(err error) bool {
+	return errors.Is(err, redis.Nil) || errors.Is(err, ErrNotFound)
+}
+
+// IsBackendError reports whether err is a failure of the Redis backend.
+func IsBackendError(err error) bool {
+	var backendErr *BackendError
+	return errors.As(err, &backendErr)
+}
+
+const (
+	// entryMagic marks values written by SafeRemember.
+	entryMagic = "\xffR"
+	// entryHeaderSize is the size of the magic, the kind byte and the fresh-until timestamp.
+	entryHeaderSize = len(entryMagic) + 1 + 8
+
+	entryValue    byte = 'v'
+	entryNotFound byte = 'n'
+
+	defaultLockSeconds = 10
+	lockPollInterval   = 50 * time.Millisecond
+)
+
+// entryForever is the fresh-until time of entries that never go stale.
+var entryForever = time.UnixMilli(math.MaxInt64)
+
+// SafeRememberRequest is a struct that represents a request to get a value from the cache,
+// or to rebuild it with a callback function if it is missing or stale.
+// It contains the key, the fresh and stale periods in seconds, the period in seconds for which
+// a "not found" result is cached, the rebuild lock settings, the callback function and an optional custom prefix.
+type SafeRememberRequest struct {
+	Key string
+	// Seconds is the period during which the value is considered fresh.
+	Seconds int64
+	// StaleSeconds is the extra period after Seconds during which the stale value is
+	// returned immediately while a single background refresh runs. Zero disables it.
+	StaleSeconds int64
+	// NotFoundSeconds is the period for which an ErrNotFound result of Callback is cached.
+	// Zero disables negative caching.
+	NotFoundSeconds int64
+	// LockSeconds is the TTL of the Redis lock held while the value is rebuilt. Defaults to 10.
+	LockSeconds int64
+	// LockWait is how long to wait for another process to rebuild the value before
+	// calling Callback anyway. Defaults to LockSeconds.
+	LockWait time.Duration
+	Callback func(ctx context.Context) ([]byte, error)
+	Prefix   *string
+}
+
+// SafeRemember is a method of Cache that retrieves a value from the cache if it exists,
+// or sets it using a callback function if it does not, without stampeding the backend.
+// It takes a context and a pointer to a SafeRememberRequest struct,
+// and returns the value as a byte slice and an error.
+//
+// Concurrent misses for the same key in one process are collapsed into a single call, which is not
+// cancelled with the caller that started it: each caller stops waiting when its own context is done.
+// A short Redis lock makes sure only one process runs the callback at a time.
+// If StaleSeconds is set, a stale value is returned at once and refreshed in the background.
+// The method returns ErrNotFound for cached "not found" results and a *BackendError when Redis fails.
+// Values are stored with a small header, so keys written by SafeRemember must not be read with Get.
+func (c *Cache) SafeRemember(ctx context.Context, request *SafeRememberRequest) ([]byte, error) {
+	key := c.prefixKey(request.Key, request.Prefix)
+	kind, freshUntil, value, err := c.getEntry(ctx, key)
+	if err == nil || errors.Is(err, redis.Nil) {
+		c.recordLookup("safe_remember", key, err == nil)
+	}
+	if err == nil {
+		if time.Now().Before(freshUntil) {
+			return entryResult(kind, value)
+		}
+		// The value is stale: serve it and refresh it in the background.
+		go func() {
+			refreshCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), request.lockTTL())
+			defer cancel()
+			_, _, _ = c.group.Do(key, func() (any, error) {
+				return c.rebuild(refreshCtx, key, request)
+			})
+		}()
+		return entryResult(kind, value)
+	}
+	if !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	// The rebuild is shared by the collapsed callers, so it must not be cancelled with the first one.
+	results := c.group.DoChan(key, func() (any, error) {
+		rebuildCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), request.lockWait()+request.lockTTL())
+		defer cancel()
+		return c.rebuild(rebuildCtx, key, request)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-results:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.([]byte), nil
+	}
+}
+
+// rebuild takes the rebuild lock and calls the callback. If another process holds the lock,
+// it waits for that process to write the value instead.
+func (c *Cache) rebuild(ctx context.Context, key string, request *SafeRememberRequest) ([]byte, error) {
+	lock, err := c.obtainLock(ctx, key+":lock", uuid.New().String(), request.lockTTL())
+	switch {
+	case err == nil:
+		defer lock.Release(context.WithoutCancel(ctx))
+	case errors.Is(err, ErrLockNotObtained):
+		kind, value, err := c.waitEntry(ctx, key, request.lockWait())
+		if err == nil {
+			return entryResult(kind, value)
+		}
+		if !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		// The lock holder did not finish in time, rebuild the value ourselves.
+	default:
+		return nil, err
+	}
+
+	value, err := request.Callback(ctx)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) && request.NotFoundSeconds > 0 {
+			if setErr := c.setEntry(ctx, key, entryNotFound, nil, request.NotFoundSeconds, 0); setErr != nil {
+				return nil, setErr
+			}
+		}
+		return nil, err
+	}
+	if err = c.setEntry(ctx, key, entryValue, value, request.Seconds, request.StaleSeconds); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// waitEntry polls the key until a fresh entry appears, the timeout elapses or the context is done.
+func (c *Cache) waitEntry(ctx context.Context, key string, timeout time.Duration) (byte, []byte, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		case <-timer.C:
+			return 0, nil, redis.Nil
+		case <-ticker.C:
+		}
+		kind, freshUntil, value, err := c.getEntry(ctx, key)
+		if err == nil && time.Now().Before(freshUntil) {
+			return kind, value, nil
+		}
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return 0, nil, err
+		}
+	}
+}
+
+// getEntry reads and decodes an entry written by setEntry.
+// A value that was not written by setEntry is treated as fresh.
+func (c *Cache) getEntry(ctx context.Context, key string) (byte, time.Time, []byte, error) {
+	raw, err := c.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, time.Time{}, nil, err
+		}
+		return 0, time.Time{}, nil, &BackendError{Op: "get", Key: key, Err: err}
+	}
+	if len(raw) < entryHeaderSize || string(raw[:len(entryMagic)]) != entryMagic {
+		return entryValue, entryForever, raw, nil
+	}
+	kind := raw[len(entryMagic)]
+	freshUntil := time.UnixMilli(int64(binary.BigEndian.Uint64(raw[len(entryMagic)+1 : entryHeaderSize])))
+	return kind, freshUntil, raw[entryHeaderSize:], nil
+}
+
+// setEntry encodes and writes an entry that is fresh for seconds and kept for another staleSeconds.
+func (c *Cache) setEntry(ctx context.Context, key string, kind byte, value []byte, seconds, staleSeconds int64) error {
+	freshUntil := entryForever
+	if seconds > 0 {
+		freshUntil = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	raw := make([]byte, entryHeaderSize, entryHeaderSize+len(value))
+	copy(raw, entryMagic)
+	raw[len(entryMagic)] = kind
+	binary.BigEndian.PutUint64(raw[len(entryMagic)+1:], uint64(freshUntil.UnixMilli()))
+	raw = append(raw, value...)
+
+	var expiration time.Duration
+	if seconds > 0 {
+		expiration = time.Duration(seconds+staleSeconds) * time.Second
+	}
+	if err := c.client.Set(ctx, key, raw, expiration).Err(); err != nil {
+		return &BackendError{Op: "set", Key: key, Err: err}
+	}
+	return c.invalidateLocal(ctx, key)
+}
+
+func entryResult(kind byte, value []byte) ([]byte, error) {
+	if kind == entryNotFound {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+func (request *SafeRememberRequest) lockTTL() time.Duration {
+	if request.LockSeconds > 0 {
+		return time.Duration(request.LockSeconds) * time.Second
+	}
+	return defaultLockSeconds * time.Second
+}
+
+func (request *SafeRememberRequest) lockWait() time.Duration {
+	if request.LockWait > 0 {
+		return request.LockWait
+	}
+	return request.lockTTL()
+}
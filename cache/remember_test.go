@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCache(t *testing.T, prefix string) *Cache {
+	cache, err := NewCache(&redis.Options{
+		Addr:     os.Getenv("REDIS_ADDR"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+		DB:       0,
+	}, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestCache_SafeRemember(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+	_, _ = cache.Delete(ctx, &DeleteRequest{Key: "safe-remember"})
+
+	var calls atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ret, err := cache.SafeRemember(ctx, &SafeRememberRequest{
+				Key:     "safe-remember",
+				Seconds: 60,
+				Callback: func(ctx context.Context) ([]byte, error) {
+					calls.Add(1)
+					time.Sleep(100 * time.Millisecond)
+					return []byte("test"), nil
+				},
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, "test", string(ret))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestCache_SafeRemember_NotFound(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+	_, _ = cache.Delete(ctx, &DeleteRequest{Key: "safe-remember-not-found"})
+
+	var calls atomic.Int32
+	request := &SafeRememberRequest{
+		Key:             "safe-remember-not-found",
+		Seconds:         60,
+		NotFoundSeconds: 10,
+		Callback: func(ctx context.Context) ([]byte, error) {
+			calls.Add(1)
+			return nil, ErrNotFound
+		},
+	}
+	for i := 0; i < 3; i++ {
+		_, err := cache.SafeRemember(ctx, request)
+		assert.True(t, errors.Is(err, ErrNotFound))
+		assert.True(t, IsMiss(err))
+		assert.False(t, IsBackendError(err))
+	}
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestCache_SafeRemember_Stale(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+	_, _ = cache.Delete(ctx, &DeleteRequest{Key: "safe-remember-stale"})
+
+	var calls atomic.Int32
+	request := &SafeRememberRequest{
+		Key:          "safe-remember-stale",
+		Seconds:      1,
+		StaleSeconds: 60,
+		Callback: func(ctx context.Context) ([]byte, error) {
+			if calls.Add(1) == 1 {
+				return []byte("old"), nil
+			}
+			return []byte("new"), nil
+		},
+	}
+	ret, err := cache.SafeRemember(ctx, request)
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(ret))
+
+	time.Sleep(1100 * time.Millisecond)
+	ret, err = cache.SafeRemember(ctx, request)
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(ret))
+
+	assert.Eventually(t, func() bool {
+		ret, err = cache.SafeRemember(ctx, request)
+		return err == nil && string(ret) == "new"
+	}, 2*time.Second, 50*time.Millisecond)
+}
+
+func TestCache_SafeRemember_BackendError(t *testing.T) {
+	cache, _ := NewCache(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}, "test:")
+	_, err := cache.SafeRemember(context.Background(), &SafeRememberRequest{
+		Key:     "safe-remember",
+		Seconds: 60,
+		Callback: func(ctx context.Context) ([]byte, error) {
+			return []byte("test"), nil
+		},
+	})
+	assert.True(t, IsBackendError(err))
+	assert.False(t, IsMiss(err))
+}
+
+func TestCache_SafeRemember_CancelledCaller(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	_, _ = cache.Delete(context.Background(), &DeleteRequest{Key: "safe-remember-cancel"})
+
+	started := make(chan struct{})
+	request := &SafeRememberRequest{
+		Key:     "safe-remember-cancel",
+		Seconds: 60,
+		Callback: func(ctx context.Context) ([]byte, error) {
+			close(started)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(200 * time.Millisecond):
+				return []byte("loaded"), nil
+			}
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := cache.SafeRemember(ctx, request)
+		cancelled <- err
+	}()
+	<-started
+	done := make(chan struct{})
+	var ret []byte
+	var err error
+	go func() {
+		defer close(done)
+		ret, err = cache.SafeRemember(context.Background(), request)
+	}()
+	cancel()
+	assert.ErrorIs(t, <-cancelled, context.Canceled)
+	<-done
+	assert.NoError(t, err)
+	assert.Equal(t, "loaded", string(ret))
+}
@@ -0,0 +1,385 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultSchedulerPollInterval      = time.Second
+	defaultSchedulerBatchSize         = 100
+	defaultSchedulerVisibilityTimeout = time.Minute
+	defaultSchedulerMaxAttempts       = 5
+	defaultSchedulerRetryDelay        = 10 * time.Second
+	defaultSchedulerMaxRetryDelay     = time.Hour
+	defaultSchedulerPendingLimit      = 100
+)
+
+var (
+	// ErrJobNotFound is returned when a job does not exist or is no longer pending.
+	ErrJobNotFound = errors.New("cache: job not found")
+	// ErrJobClaimLost is returned by Ack and Retry when the visibility timeout of the claim expired,
+	// so that the job may have been claimed again by another worker.
+	ErrJobClaimLost = errors.New("cache: job claim lost")
+)
+
+// claimJobsScript moves jobs whose visibility timeout expired back to the delayed set,
+// then moves due jobs from the delayed set to the processing set, records the claim token
+// in the claims hash, and returns their IDs and data.
+// Pollers in any number of processes can run it concurrently without claiming a job twice.
+var claimJobsScript = redis.NewScript(`
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local expired = redis.call("ZRANGEBYSCORE", KEYS[2], "-inf", now)
+for _, id in ipairs(expired) do
+	redis.call("ZREM", KEYS[2], id)
+	redis.call("HDEL", KEYS[4], id)
+	redis.call("ZADD", KEYS[1], now, id)
+end
+local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", now, "LIMIT", 0, ARGV[1])
+local result = {}
+for _, id in ipairs(ids) do
+	redis.call("ZREM", KEYS[1], id)
+	local data = redis.call("HGET", KEYS[3], id)
+	if data then
+		redis.call("ZADD", KEYS[2], now + tonumber(ARGV[2]), id)
+		redis.call("HSET", KEYS[4], id, ARGV[3])
+		table.insert(result, id)
+		table.insert(result, data)
+	end
+end
+return result
+`)
+
+// finishJobScript removes a claimed job, or reschedules it with new data if ARGV[2] is set,
+// or moves it to the failed hash if ARGV[4] is set. It does nothing if the job is no longer
+// claimed with the token ARGV[5].
+var finishJobScript = redis.NewScript(`
+if redis.call("HGET", KEYS[5], ARGV[1]) ~= ARGV[5] then
+	return 0
+end
+redis.call("HDEL", KEYS[5], ARGV[1])
+redis.call("ZREM", KEYS[2], ARGV[1])
+if ARGV[2] ~= "" then
+	redis.call("HSET", KEYS[3], ARGV[1], ARGV[2])
+	redis.call("ZADD", KEYS[1], ARGV[3], ARGV[1])
+	return 1
+end
+if ARGV[4] ~= "" then
+	redis.call("HSET", KEYS[4], ARGV[1], ARGV[4])
+end
+redis.call("HDEL", KEYS[3], ARGV[1])
+return 1
+`)
+
+// cancelJobScript removes a job that has not been claimed yet.
+var cancelJobScript = redis.NewScript(`
+if redis.call("ZREM", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("HDEL", KEYS[2], ARGV[1])
+return 1
+`)
+
+// Job is a struct that represents a delayed job.
+// It contains the ID of the job, its payload, the time it is due,
+// the number of failed attempts, and the error of the last attempt.
+type Job struct {
+	ID        string    `json:"id"`
+	Payload   []byte    `json:"payload"`
+	RunAt     time.Time `json:"run_at"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	// claim is the token of the claim that returned the job, checked by Ack and Retry.
+	claim string
+}
+
+// SchedulerOptions is a struct that represents the options of a Scheduler.
+// It contains the name of the scheduler, the polling settings, the visibility timeout,
+// the retry settings, and an optional custom prefix.
+type SchedulerOptions struct {
+	// Name is the namespace of the keys of the scheduler.
+	// The keys share a hash tag so that they are in the same Redis Cluster slot.
+	Name string
+	// PollInterval is the time between polls when no job is due. Defaults to one second.
+	PollInterval time.Duration
+	// BatchSize is the maximum number of jobs returned by Claim. Defaults to 100.
+	// The claimed jobs share the visibility timeout, so they must all be handled within it.
+	BatchSize int64
+	// VisibilityTimeout is how long a claimed job may run before it is claimed again,
+	// in case its worker crashed. Defaults to one minute.
+	VisibilityTimeout time.Duration
+	// MaxAttempts is the number of attempts after which a failing job is moved to the failed hash. Defaults to 5.
+	MaxAttempts int
+	// RetryDelay is the delay before the first retry. It doubles on every attempt up to MaxRetryDelay.
+	// Defaults to 10 seconds and one hour.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	Prefix        *string
+}
+
+// Scheduler is a delayed job scheduler built on Redis sorted sets.
+// Jobs wait in a sorted set scored by their due time, are claimed atomically by pollers,
+// and stay in a processing set until their handler finishes.
+type Scheduler struct {
+	cache             *Cache
+	delayedKey        string
+	processingKey     string
+	jobsKey           string
+	failedKey         string
+	claimsKey         string
+	pollInterval      time.Duration
+	batchSize         int64
+	visibilityTimeout time.Duration
+	maxAttempts       int
+	retryDelay        time.Duration
+	maxRetryDelay     time.Duration
+}
+
+// NewScheduler is a function that creates a new Scheduler.
+// It takes a pointer to a Cache and a pointer to a SchedulerOptions struct,
+// and returns a pointer to the created Scheduler.
+func NewScheduler(c *Cache, options *SchedulerOptions) *Scheduler {
+	name := c.prefixKey(options.Name, options.Prefix)
+	s := &Scheduler{
+		cache:             c,
+		delayedKey:        sameSlotKey(name, ":delayed"),
+		processingKey:     sameSlotKey(name, ":processing"),
+		jobsKey:           sameSlotKey(name, ":jobs"),
+		failedKey:         sameSlotKey(name, ":failed"),
+		claimsKey:         sameSlotKey(name, ":claims"),
+		pollInterval:      options.PollInterval,
+		batchSize:         options.BatchSize,
+		visibilityTimeout: options.VisibilityTimeout,
+		maxAttempts:       options.MaxAttempts,
+		retryDelay:        options.RetryDelay,
+		maxRetryDelay:     options.MaxRetryDelay,
+	}
+	if s.pollInterval <= 0 {
+		s.pollInterval = defaultSchedulerPollInterval
+	}
+	if s.batchSize <= 0 {
+		s.batchSize = defaultSchedulerBatchSize
+	}
+	if s.visibilityTimeout <= 0 {
+		s.visibilityTimeout = defaultSchedulerVisibilityTimeout
+	}
+	if s.maxAttempts <= 0 {
+		s.maxAttempts = defaultSchedulerMaxAttempts
+	}
+	if s.retryDelay <= 0 {
+		s.retryDelay = defaultSchedulerRetryDelay
+	}
+	if s.maxRetryDelay <= 0 {
+		s.maxRetryDelay = defaultSchedulerMaxRetryDelay
+	}
+	return s
+}
+
+// EnqueueRequest is a struct that represents a request to schedule a job.
+// It contains an optional ID, the payload, and the time the job is due.
+type EnqueueRequest struct {
+	// ID defaults to a random UUID. Enqueueing an existing ID reschedules the job.
+	ID      string
+	Payload []byte
+	RunAt   time.Time
+}
+
+// Enqueue is a method of Scheduler that schedules a job to run at a given time.
+// It takes a context and a pointer to an EnqueueRequest struct,
+// and returns the ID of the job and an error.
+// The method uses the Redis HSET and ZADD commands in a transaction.
+func (s *Scheduler) Enqueue(ctx context.Context, request *EnqueueRequest) (string, error) {
+	job := &Job{ID: request.ID, Payload: request.Payload, RunAt: request.RunAt}
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+	_, err = s.cache.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, s.jobsKey, job.ID, data)
+		pipe.ZAdd(ctx, s.delayedKey, redis.Z{Score: float64(job.RunAt.UnixMilli()), Member: job.ID})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return job.ID, nil
+}
+
+// Cancel is a method of Scheduler that removes a job that has not been claimed yet.
+// It takes a context and the ID of the job, and returns an error.
+// If the job does not exist or is already running, the error is ErrJobNotFound.
+func (s *Scheduler) Cancel(ctx context.Context, id string) error {
+	res, err := cancelJobScript.Run(ctx, s.cache.client, []string{s.delayedKey, s.jobsKey}, id).Int64()
+	if err != nil {
+		return err
+	}
+	if res == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// Get is a method of Scheduler that gets a pending or running job.
+// It takes a context and the ID of the job, and returns a pointer to the Job and an error.
+// If the job does not exist, the error is ErrJobNotFound.
+func (s *Scheduler) Get(ctx context.Context, id string) (*Job, error) {
+	data, err := s.cache.client.HGet(ctx, s.jobsKey, id).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrJobNotFound
+		}
+		return nil, err
+	}
+	job := new(Job)
+	return job, json.Unmarshal(data, job)
+}
+
+// PendingRequest is a struct that represents a request to list the pending jobs of a scheduler.
+// It contains the offset and the maximum number of jobs to return.
+type PendingRequest struct {
+	Offset int64
+	// Limit defaults to 100.
+	Limit int64
+}
+
+// Pending is a method of Scheduler that lists the jobs that are not claimed yet, ordered by their due time.
+// It takes a context and a pointer to a PendingRequest struct,
+// and returns the jobs, the total number of pending jobs and an error.
+func (s *Scheduler) Pending(ctx context.Context, request *PendingRequest) ([]*Job, int64, error) {
+	limit := request.Limit
+	if limit <= 0 {
+		limit = defaultSchedulerPendingLimit
+	}
+	var ids *redis.StringSliceCmd
+	var total *redis.IntCmd
+	_, err := s.cache.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		ids = pipe.ZRange(ctx, s.delayedKey, request.Offset, request.Offset+limit-1)
+		total = pipe.ZCard(ctx, s.delayedKey)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(ids.Val()) == 0 {
+		return nil, total.Val(), nil
+	}
+	values, err := s.cache.client.HMGet(ctx, s.jobsKey, ids.Val()...).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	jobs := make([]*Job, 0, len(values))
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		job := new(Job)
+		if err = json.Unmarshal([]byte(data), job); err != nil {
+			return nil, 0, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, total.Val(), nil
+}
+
+// Claim is a method of Scheduler that atomically claims up to BatchSize jobs that are due.
+// Claimed jobs must be finished with Ack or Retry within the visibility timeout,
+// otherwise they are claimed again by the next poll.
+func (s *Scheduler) Claim(ctx context.Context) ([]*Job, error) {
+	return s.claim(ctx, s.batchSize)
+}
+
+func (s *Scheduler) claim(ctx context.Context, count int64) ([]*Job, error) {
+	token := uuid.New().String()
+	res, err := claimJobsScript.Run(ctx, s.cache.client,
+		[]string{s.delayedKey, s.processingKey, s.jobsKey, s.claimsKey},
+		count, s.visibilityTimeout.Milliseconds(), token,
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(res)/2)
+	for i := 0; i+1 < len(res); i += 2 {
+		job := &Job{claim: token}
+		if err = json.Unmarshal([]byte(res[i+1]), job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Ack is a method of Scheduler that removes a claimed job after it succeeded.
+// If the claim expired, the error is ErrJobClaimLost.
+func (s *Scheduler) Ack(ctx context.Context, job *Job) error {
+	return s.finish(ctx, job, nil, time.Time{}, nil)
+}
+
+// Retry is a method of Scheduler that records a failed attempt of a claimed job.
+// The job is rescheduled with exponential backoff, or moved to the failed hash after MaxAttempts attempts.
+// If the claim expired, the error is ErrJobClaimLost.
+func (s *Scheduler) Retry(ctx context.Context, job *Job, cause error) error {
+	job.Attempts++
+	job.LastError = cause.Error()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if job.Attempts >= s.maxAttempts {
+		return s.finish(ctx, job, nil, time.Time{}, data)
+	}
+	delay := s.retryDelay << (job.Attempts - 1)
+	if delay <= 0 || delay > s.maxRetryDelay {
+		delay = s.maxRetryDelay
+	}
+	return s.finish(ctx, job, data, time.Now().Add(delay), nil)
+}
+
+func (s *Scheduler) finish(ctx context.Context, job *Job, retry []byte, runAt time.Time, failed []byte) error {
+	res, err := finishJobScript.Run(ctx, s.cache.client,
+		[]string{s.delayedKey, s.processingKey, s.jobsKey, s.failedKey, s.claimsKey},
+		job.ID, retry, runAt.UnixMilli(), failed, job.claim,
+	).Int64()
+	if err != nil {
+		return err
+	}
+	if res == 0 {
+		return ErrJobClaimLost
+	}
+	return nil
+}
+
+// Run is a method of Scheduler that polls for due jobs and passes them to a handler until the context is done.
+// A job is removed when the handler returns nil and retried with backoff otherwise.
+// Jobs are claimed one at a time, so that the visibility timeout only covers the running job.
+// Run can be called in any number of processes at once.
+func (s *Scheduler) Run(ctx context.Context, handler func(ctx context.Context, job *Job) error) error {
+	for {
+		jobs, err := s.claim(ctx, 1)
+		for _, job := range jobs {
+			if err = handler(ctx, job); err != nil {
+				err = s.Retry(ctx, job, err)
+			} else {
+				err = s.Ack(ctx, job)
+			}
+		}
+		// A lost claim is handled by the worker that claimed the job again
+		if (err == nil || errors.Is(err, ErrJobClaimLost)) && len(jobs) > 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.pollInterval):
+		}
+	}
+}
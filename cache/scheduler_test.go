@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestScheduler(t *testing.T, name string) *Scheduler {
+	cache := newTestCache(t, "test:")
+	scheduler := NewScheduler(cache, &SchedulerOptions{
+		Name:          name,
+		PollInterval:  20 * time.Millisecond,
+		MaxAttempts:   2,
+		RetryDelay:    50 * time.Millisecond,
+		MaxRetryDelay: time.Second,
+	})
+	cache.client.Del(context.Background(), scheduler.delayedKey, scheduler.processingKey, scheduler.jobsKey, scheduler.failedKey, scheduler.claimsKey)
+	return scheduler
+}
+
+func TestScheduler_EnqueueCancel(t *testing.T) {
+	scheduler := newTestScheduler(t, "scheduler-cancel")
+	ctx := context.Background()
+
+	id, err := scheduler.Enqueue(ctx, &EnqueueRequest{Payload: []byte("close order 1"), RunAt: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+	_, err = scheduler.Enqueue(ctx, &EnqueueRequest{ID: "order-2", Payload: []byte("close order 2"), RunAt: time.Now().Add(time.Minute)})
+	assert.NoError(t, err)
+
+	jobs, total, err := scheduler.Pending(ctx, &PendingRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, "order-2", jobs[0].ID)
+	assert.Equal(t, id, jobs[1].ID)
+
+	assert.NoError(t, scheduler.Cancel(ctx, id))
+	assert.True(t, errors.Is(scheduler.Cancel(ctx, id), ErrJobNotFound))
+	_, err = scheduler.Get(ctx, id)
+	assert.True(t, errors.Is(err, ErrJobNotFound))
+
+	jobs, err = scheduler.Claim(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 0)
+}
+
+func TestScheduler_Run(t *testing.T) {
+	scheduler := newTestScheduler(t, "scheduler-run")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := scheduler.Enqueue(ctx, &EnqueueRequest{ID: "ok", RunAt: time.Now().Add(100 * time.Millisecond)})
+	assert.NoError(t, err)
+	_, err = scheduler.Enqueue(ctx, &EnqueueRequest{ID: "flaky", RunAt: time.Now()})
+	assert.NoError(t, err)
+	_, err = scheduler.Enqueue(ctx, &EnqueueRequest{ID: "broken", RunAt: time.Now()})
+	assert.NoError(t, err)
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	handler := func(ctx context.Context, job *Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[job.ID]++
+		if job.ID == "broken" || (job.ID == "flaky" && job.Attempts == 0) {
+			return errors.New("failed")
+		}
+		return nil
+	}
+	// Two pollers must not run a job twice.
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = scheduler.Run(ctx, handler)
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		_, total, err := scheduler.Pending(ctx, &PendingRequest{Limit: 10})
+		processing, _ := scheduler.cache.client.ZCard(ctx, scheduler.processingKey).Result()
+		return err == nil && total == 0 && processing == 0
+	}, 2*time.Second, 20*time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	assert.Equal(t, map[string]int{"ok": 1, "flaky": 2, "broken": 2}, calls)
+	failed, err := scheduler.cache.client.HGet(context.Background(), scheduler.failedKey, "broken").Result()
+	assert.NoError(t, err)
+	assert.Contains(t, failed, `"attempts":2`)
+}
+
+func TestScheduler_ClaimLost(t *testing.T) {
+	scheduler := newTestScheduler(t, "scheduler-claim")
+	scheduler.visibilityTimeout = 50 * time.Millisecond
+	ctx := context.Background()
+	_, err := scheduler.Enqueue(ctx, &EnqueueRequest{ID: "slow", RunAt: time.Now()})
+	assert.NoError(t, err)
+
+	stale, err := scheduler.Claim(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, stale, 1)
+	// The visibility timeout expires and another worker claims the job
+	time.Sleep(100 * time.Millisecond)
+	jobs, err := scheduler.Claim(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+
+	assert.ErrorIs(t, scheduler.Ack(ctx, stale[0]), ErrJobClaimLost)
+	assert.ErrorIs(t, scheduler.Retry(ctx, stale[0], errors.New("failed")), ErrJobClaimLost)
+	assert.NoError(t, scheduler.Ack(ctx, jobs[0]))
+	_, err = scheduler.Get(ctx, "slow")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"context"
+)
+
+// SMembersRequest is a struct that represents a request to get the members of a set in the cache.
+// It contains the key of the set and an optional custom prefix.
+type SMembersRequest struct {
+	Key    string
+	Prefix *string
+}
+
+// SMembers is a method of Cache that gets the members of a set in the cache.
+// It takes a context and a pointer to a SMembersRequest struct,
+// and returns the members as a slice of strings and an error.
+// The method uses the Redis SMEMBERS command to get the members.
+func (c *Cache) SMembers(ctx context.Context, request *SMembersRequest) ([]string, error) {
+	return c.client.SMembers(ctx, c.prefixKey(request.Key, request.Prefix)).Result()
+}
+
+// SIsMemberRequest is a struct that represents a request to check if a value is a member of a set in the cache.
+// It contains the key of the set, the value to check, and an optional custom prefix.
+type SIsMemberRequest struct {
+	Key    string
+	Value  any
+	Prefix *string
+}
+
+// SIsMember is a method of Cache that checks if a value is a member of a set in the cache.
+// It takes a context and a pointer to a SIsMemberRequest struct,
+// and returns a boolean indicating whether the value is a member and an error.
+// The method uses the Redis SISMEMBER command to check the value.
+func (c *Cache) SIsMember(ctx context.Context, request *SIsMemberRequest) (bool, error) {
+	return c.client.SIsMember(ctx, c.prefixKey(request.Key, request.Prefix), request.Value).Result()
+}
+
+// SMIsMemberRequest is a struct that represents a request to check if several values are members of a set.
+// It contains the key of the set, the values to check, and an optional custom prefix.
+type SMIsMemberRequest struct {
+	Key    string
+	Values []any
+	Prefix *string
+}
+
+// SMIsMember is a method of Cache that checks if several values are members of a set in the cache.
+// It takes a context and a pointer to a SMIsMemberRequest struct,
+// and returns a slice of booleans in the order of the values and an error.
+// The method uses the Redis SMISMEMBER command to check the values.
+func (c *Cache) SMIsMember(ctx context.Context, request *SMIsMemberRequest) ([]bool, error) {
+	return c.client.SMIsMember(ctx, c.prefixKey(request.Key, request.Prefix), request.Values...).Result()
+}
+
+// SRemRequest is a struct that represents a request to remove members from a set in the cache.
+// It contains the key of the set, the members to remove, and an optional custom prefix.
+type SRemRequest struct {
+	Key    string
+	Value  []any
+	Prefix *string
+}
+
+// SRem is a method of Cache that removes members from a set in the cache.
+// It takes a context and a pointer to a SRemRequest struct,
+// and returns the number of members that were removed and an error.
+// The method uses the Redis SREM command to remove the members.
+func (c *Cache) SRem(ctx context.Context, request *SRemRequest) (int64, error) {
+	return c.client.SRem(ctx, c.prefixKey(request.Key, request.Prefix), request.Value...).Result()
+}
+
+// SPopRequest is a struct that represents a request to remove and return random members of a set in the cache.
+// It contains the key of the set, the number of members to pop, and an optional custom prefix.
+type SPopRequest struct {
+	Key    string
+	Count  int64
+	Prefix *string
+}
+
+// SPop is a method of Cache that removes and returns random members of a set in the cache.
+// It takes a context and a pointer to a SPopRequest struct,
+// and returns the popped members as a slice of strings and an error.
+// The method uses the Redis SPOP command to pop the members.
+func (c *Cache) SPop(ctx context.Context, request *SPopRequest) ([]string, error) {
+	count := request.Count
+	if count <= 0 {
+		count = 1
+	}
+	return c.client.SPopN(ctx, c.prefixKey(request.Key, request.Prefix), count).Result()
+}
+
+// SRandMemberRequest is a struct that represents a request to get random members of a set in the cache.
+// It contains the key of the set, the number of members to return, and an optional custom prefix.
+// A negative count may return the same member several times.
+type SRandMemberRequest struct {
+	Key    string
+	Count  int64
+	Prefix *string
+}
+
+// SRandMember is a method of Cache that gets random members of a set in the cache without removing them.
+// It takes a context and a pointer to a SRandMemberRequest struct,
+// and returns the members as a slice of strings and an error.
+// The method uses the Redis SRANDMEMBER command to get the members.
+func (c *Cache) SRandMember(ctx context.Context, request *SRandMemberRequest) ([]string, error) {
+	count := request.Count
+	if count == 0 {
+		count = 1
+	}
+	return c.client.SRandMemberN(ctx, c.prefixKey(request.Key, request.Prefix), count).Result()
+}
+
+// SetsRequest is a struct that represents a request to combine several sets in the cache.
+// It contains the keys of the sets and an optional custom prefix.
+// With a Redis Cluster, all the sets must be in the same slot, see HashTag.
+type SetsRequest struct {
+	Keys   []string
+	Prefix *string
+}
+
+// SInter is a method of Cache that gets the members that are in every set.
+// It takes a context and a pointer to a SetsRequest struct,
+// and returns the members as a slice of strings and an error.
+// The method uses the Redis SINTER command to intersect the sets.
+func (c *Cache) SInter(ctx context.Context, request *SetsRequest) ([]string, error) {
+	return c.client.SInter(ctx, c.prefixKeys(request.Keys, request.Prefix)...).Result()
+}
+
+// SUnion is a method of Cache that gets the members that are in any of the sets.
+// It takes a context and a pointer to a SetsRequest struct,
+// and returns the members as a slice of strings and an error.
+// The method uses the Redis SUNION command to merge the sets.
+func (c *Cache) SUnion(ctx context.Context, request *SetsRequest) ([]string, error) {
+	return c.client.SUnion(ctx, c.prefixKeys(request.Keys, request.Prefix)...).Result()
+}
+
+// SDiff is a method of Cache that gets the members of the first set that are in none of the other sets.
+// It takes a context and a pointer to a SetsRequest struct,
+// and returns the members as a slice of strings and an error.
+// The method uses the Redis SDIFF command to subtract the sets.
+func (c *Cache) SDiff(ctx context.Context, request *SetsRequest) ([]string, error) {
+	return c.client.SDiff(ctx, c.prefixKeys(request.Keys, request.Prefix)...).Result()
+}
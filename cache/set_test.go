@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_Set(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+	_, _ = cache.MDelete(ctx, &MDeleteRequest{Keys: []string{"set-a", "set-b"}})
+
+	_, err := cache.SAdd(ctx, &SAddRequest{Key: "set-a", Value: []any{"1", "2", "3"}})
+	assert.NoError(t, err)
+	_, err = cache.SAdd(ctx, &SAddRequest{Key: "set-b", Value: []any{"2", "3", "4"}})
+	assert.NoError(t, err)
+
+	members, err := cache.SMembers(ctx, &SMembersRequest{Key: "set-a"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, members)
+	ok, err := cache.SIsMember(ctx, &SIsMemberRequest{Key: "set-a", Value: "2"})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	found, err := cache.SMIsMember(ctx, &SMIsMemberRequest{Key: "set-a", Values: []any{"1", "4"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false}, found)
+
+	inter, err := cache.SInter(ctx, &SetsRequest{Keys: []string{"set-a", "set-b"}})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"2", "3"}, inter)
+	diff, err := cache.SDiff(ctx, &SetsRequest{Keys: []string{"set-a", "set-b"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, diff)
+
+	removed, err := cache.SRem(ctx, &SRemRequest{Key: "set-a", Value: []any{"1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+	union, err := cache.SUnion(ctx, &SetsRequest{Keys: []string{"set-a", "set-b"}})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"2", "3", "4"}, union)
+}
@@ -0,0 +1,317 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultStreamBlock   = 5 * time.Second
+	defaultStreamCount   = 10
+	defaultStreamMinIdle = time.Minute
+)
+
+// deadLetterScript acknowledges a pending message and copies it to the dead-letter stream atomically,
+// so that a message reclaimed by several consumers at once is dead-lettered only once.
+var deadLetterScript = redis.NewScript(`
+local entries = redis.call("XRANGE", KEYS[1], ARGV[2], ARGV[2])
+if redis.call("XACK", KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+if entries[1] then
+	local fields = entries[1][2]
+	table.insert(fields, "x-stream-id")
+	table.insert(fields, ARGV[2])
+	table.insert(fields, "x-deliveries")
+	table.insert(fields, ARGV[3])
+	redis.call("XADD", KEYS[2], "*", unpack(fields))
+	redis.call("XDEL", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// StreamQueueOptions is a struct that represents the options of a StreamQueue.
+// It contains the stream and consumer group names, the consumer name, trimming and dead-letter settings,
+// the blocking read settings, the idle time after which pending messages are reclaimed, and an optional custom prefix.
+type StreamQueueOptions struct {
+	Stream string
+	Group  string
+	// Consumer defaults to the hostname followed by a random suffix.
+	Consumer string
+	// MaxLen trims the stream to about this many entries on every Add. Zero disables trimming.
+	MaxLen int64
+	// MaxDeliveries moves a message to the dead-letter stream once it was delivered this many times
+	// without being acknowledged. Zero disables dead-lettering.
+	MaxDeliveries int64
+	// DeadLetterStream defaults to the stream key wrapped in a hash tag followed by ":dead",
+	// which is in the same Redis Cluster slot as the stream. A custom stream must be in the same slot too.
+	DeadLetterStream string
+	// Block is how long Read waits for new messages. Defaults to 5 seconds.
+	Block time.Duration
+	// Count is the maximum number of messages returned by Read and Reclaim. Defaults to 10.
+	Count int64
+	// MinIdle is how long a message stays pending before Reclaim takes it over. Defaults to one minute.
+	MinIdle time.Duration
+	// StartID is the ID after which a group created by CreateGroup starts reading.
+	// Defaults to "$", the messages added after its creation. "0" reads the whole stream.
+	StartID string
+	Prefix  *string
+}
+
+// StreamMessage is a struct that represents a message read from a stream.
+// It contains the ID of the message, its values, and how many times it was delivered.
+type StreamMessage struct {
+	ID         string
+	Values     map[string]any
+	Deliveries int64
+}
+
+// StreamQueue is a reliable queue built on Redis Streams and consumer groups.
+// Messages stay pending until they are acknowledged, so a message whose consumer crashed
+// is delivered again by Reclaim.
+type StreamQueue struct {
+	cache      *Cache
+	stream     string
+	deadLetter string
+	group      string
+	consumer   string
+	maxLen     int64
+	maxDeliver int64
+	block      time.Duration
+	count      int64
+	minIdle    time.Duration
+	startID    string
+}
+
+// NewStreamQueue is a function that creates a new StreamQueue.
+// It takes a pointer to a Cache and a pointer to a StreamQueueOptions struct,
+// and returns a pointer to the created StreamQueue.
+func NewStreamQueue(c *Cache, options *StreamQueueOptions) *StreamQueue {
+	consumer := options.Consumer
+	if consumer == "" {
+		hostname, _ := os.Hostname()
+		consumer = hostname + "-" + uuid.New().String()[:8]
+	}
+	stream := c.prefixKey(options.Stream, options.Prefix)
+	deadLetter := sameSlotKey(stream, ":dead")
+	if options.DeadLetterStream != "" {
+		deadLetter = c.prefixKey(options.DeadLetterStream, options.Prefix)
+	}
+	q := &StreamQueue{
+		cache:      c,
+		stream:     stream,
+		deadLetter: deadLetter,
+		group:      options.Group,
+		consumer:   consumer,
+		maxLen:     options.MaxLen,
+		maxDeliver: options.MaxDeliveries,
+		block:      options.Block,
+		count:      options.Count,
+		minIdle:    options.MinIdle,
+		startID:    options.StartID,
+	}
+	if q.block <= 0 {
+		q.block = defaultStreamBlock
+	}
+	if q.count <= 0 {
+		q.count = defaultStreamCount
+	}
+	if q.minIdle <= 0 {
+		q.minIdle = defaultStreamMinIdle
+	}
+	if q.startID == "" {
+		q.startID = "$"
+	}
+	return q
+}
+
+// Add is a method of StreamQueue that appends a message to the stream.
+// It takes a context and the values of the message,
+// and returns the ID of the message and an error.
+// The method uses the Redis XADD command, trimming the stream approximately to MaxLen.
+func (q *StreamQueue) Add(ctx context.Context, values map[string]any) (string, error) {
+	return q.cache.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: q.stream,
+		MaxLen: q.maxLen,
+		Approx: q.maxLen > 0,
+		Values: values,
+	}).Result()
+}
+
+// CreateGroup is a method of StreamQueue that creates the consumer group and the stream if they do not exist.
+// New groups start after StartID, by default with the messages added after their creation.
+// The method uses the Redis XGROUP CREATE command with MKSTREAM.
+func (q *StreamQueue) CreateGroup(ctx context.Context) error {
+	err := q.cache.client.XGroupCreateMkStream(ctx, q.stream, q.group, q.startID).Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// Read is a method of StreamQueue that reads new messages for this consumer,
+// blocking for up to Block if there are none.
+// It returns the messages and an error. If no message arrived, the slice is empty and the error is nil.
+// The method uses the Redis XREADGROUP command.
+func (q *StreamQueue) Read(ctx context.Context) ([]StreamMessage, error) {
+	streams, err := q.cache.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    q.group,
+		Consumer: q.consumer,
+		Streams:  []string{q.stream, ">"},
+		Count:    q.count,
+		Block:    q.block,
+	}).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var messages []StreamMessage
+	for _, stream := range streams {
+		for _, message := range stream.Messages {
+			messages = append(messages, StreamMessage{ID: message.ID, Values: message.Values, Deliveries: 1})
+		}
+	}
+	return messages, nil
+}
+
+// Ack is a method of StreamQueue that acknowledges processed messages,
+// removing them from the pending entries list.
+// The method uses the Redis XACK command.
+func (q *StreamQueue) Ack(ctx context.Context, ids ...string) error {
+	return q.cache.client.XAck(ctx, q.stream, q.group, ids...).Err()
+}
+
+// DeadLetter is a method of StreamQueue that moves a pending message to the dead-letter stream,
+// acknowledging it. A message that is no longer pending is left alone.
+// The method uses the Redis XACK, XADD and XDEL commands in a script.
+func (q *StreamQueue) DeadLetter(ctx context.Context, message StreamMessage) error {
+	return deadLetterScript.Run(ctx, q.cache.client, []string{q.stream, q.deadLetter}, q.group, message.ID, message.Deliveries).Err()
+}
+
+// Reclaim is a method of StreamQueue that takes over messages that stayed pending for longer than MinIdle,
+// typically because their consumer crashed.
+// Messages claimed after MaxDeliveries deliveries are moved to the dead-letter stream instead.
+// It returns up to Count reclaimed messages and an error.
+// The method uses the Redis XAUTOCLAIM command, following its cursor through the pending entries list,
+// and XPENDING to read the delivery counts of the claimed messages.
+func (q *StreamQueue) Reclaim(ctx context.Context) ([]StreamMessage, error) {
+	var messages []StreamMessage
+	start := "0-0"
+	for {
+		claimed, next, err := q.cache.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   q.stream,
+			Group:    q.group,
+			Consumer: q.consumer,
+			MinIdle:  q.minIdle,
+			Start:    start,
+			Count:    q.count - int64(len(messages)),
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		deliveries, err := q.deliveries(ctx, claimed)
+		if err != nil {
+			return nil, err
+		}
+		for i, message := range claimed {
+			// The count includes the delivery of the claim
+			if q.maxDeliver > 0 && deliveries[i] > q.maxDeliver {
+				err = deadLetterScript.Run(ctx, q.cache.client, []string{q.stream, q.deadLetter}, q.group, message.ID, deliveries[i]-1).Err()
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			messages = append(messages, StreamMessage{
+				ID:         message.ID,
+				Values:     message.Values,
+				Deliveries: deliveries[i],
+			})
+		}
+		if next == "0-0" || int64(len(messages)) >= q.count {
+			return messages, nil
+		}
+		start = next
+	}
+}
+
+// deliveries returns the delivery counts of messages from the pending entries list.
+func (q *StreamQueue) deliveries(ctx context.Context, messages []redis.XMessage) ([]int64, error) {
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	cmds := make([]*redis.XPendingExtCmd, len(messages))
+	_, err := q.cache.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, message := range messages {
+			cmds[i] = pipe.XPendingExt(ctx, &redis.XPendingExtArgs{
+				Stream: q.stream,
+				Group:  q.group,
+				Start:  message.ID,
+				End:    message.ID,
+				Count:  1,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]int64, len(messages))
+	for i, cmd := range cmds {
+		if pending := cmd.Val(); len(pending) > 0 {
+			deliveries[i] = pending[0].RetryCount
+		}
+	}
+	return deliveries, nil
+}
+
+// Consume is a method of StreamQueue that reads messages and passes them to a handler until the context is done.
+// Messages are acknowledged when the handler returns nil. Otherwise they stay pending and are
+// delivered again by Reclaim after MinIdle, until MaxDeliveries moves them to the dead-letter stream.
+// The consumer group is created if it does not exist.
+func (q *StreamQueue) Consume(ctx context.Context, handler func(ctx context.Context, message StreamMessage) error) error {
+	if err := q.CreateGroup(ctx); err != nil {
+		return err
+	}
+	lastReclaim := time.Time{}
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var messages []StreamMessage
+		var err error
+		if time.Since(lastReclaim) >= q.minIdle/2 {
+			lastReclaim = time.Now()
+			messages, err = q.Reclaim(ctx)
+		}
+		if err == nil && len(messages) == 0 {
+			messages, err = q.Read(ctx)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		for _, message := range messages {
+			if handler(ctx, message) == nil {
+				if err = q.Ack(ctx, message.ID); err != nil && ctx.Err() != nil {
+					return ctx.Err()
+				}
+			}
+		}
+	}
+}
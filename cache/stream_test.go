@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamQueue(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+	_, _ = cache.Delete(ctx, &DeleteRequest{Key: "stream"})
+	cache.client.Del(ctx, "{test:stream}:dead")
+
+	options := &StreamQueueOptions{
+		Stream:        "stream",
+		Group:         "workers",
+		MaxLen:        1000,
+		MaxDeliveries: 2,
+		Block:         100 * time.Millisecond,
+		MinIdle:       100 * time.Millisecond,
+	}
+	producer := NewStreamQueue(cache, options)
+	assert.NoError(t, producer.CreateGroup(ctx))
+	assert.NoError(t, producer.CreateGroup(ctx))
+	_, err := producer.Add(ctx, map[string]any{"order_id": "1"})
+	assert.NoError(t, err)
+
+	// The first consumer crashes without acknowledging the message.
+	crashed := NewStreamQueue(cache, &StreamQueueOptions{Stream: "stream", Group: "workers", Consumer: "crashed", Block: 100 * time.Millisecond})
+	messages, err := crashed.Read(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+
+	options.Consumer = "worker"
+	worker := NewStreamQueue(cache, options)
+	time.Sleep(150 * time.Millisecond)
+	messages, err = worker.Reclaim(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "1", messages[0].Values["order_id"])
+	assert.Equal(t, int64(2), messages[0].Deliveries)
+
+	// The message failed twice and is moved to the dead-letter stream.
+	time.Sleep(150 * time.Millisecond)
+	messages, err = worker.Reclaim(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 0)
+	dead, err := cache.client.XRange(ctx, "{test:stream}:dead", "-", "+").Result()
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+	assert.Equal(t, "1", dead[0].Values["order_id"])
+}
+
+func TestStreamQueue_ReclaimCursor(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+	_, _ = cache.Delete(ctx, &DeleteRequest{Key: "stream-cursor"})
+	cache.client.Del(ctx, "{test:stream-cursor}:dead")
+
+	options := &StreamQueueOptions{
+		Stream:        "stream-cursor",
+		Group:         "workers",
+		Consumer:      "crashed",
+		MaxDeliveries: 1,
+		Count:         1,
+		Block:         100 * time.Millisecond,
+		MinIdle:       50 * time.Millisecond,
+	}
+	crashed := NewStreamQueue(cache, options)
+	assert.NoError(t, crashed.CreateGroup(ctx))
+	for _, id := range []string{"1", "2", "3"} {
+		_, err := crashed.Add(ctx, map[string]any{"order_id": id})
+		assert.NoError(t, err)
+		messages, err := crashed.Read(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, messages, 1)
+	}
+
+	// Every claimed message was already delivered MaxDeliveries times, beyond the first Count entries too.
+	options.Consumer = "worker"
+	worker := NewStreamQueue(cache, options)
+	time.Sleep(100 * time.Millisecond)
+	messages, err := worker.Reclaim(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+	dead, err := cache.client.XRange(ctx, "{test:stream-cursor}:dead", "-", "+").Result()
+	assert.NoError(t, err)
+	assert.Len(t, dead, 3)
+}
+
+func TestStreamQueue_Consume(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, _ = cache.Delete(ctx, &DeleteRequest{Key: "stream-consume"})
+
+	queue := NewStreamQueue(cache, &StreamQueueOptions{
+		Stream:  "stream-consume",
+		Group:   "workers",
+		Block:   100 * time.Millisecond,
+		MinIdle: 200 * time.Millisecond,
+	})
+	assert.NoError(t, queue.CreateGroup(ctx))
+	for _, id := range []string{"1", "2", "3"} {
+		_, err := queue.Add(ctx, map[string]any{"order_id": id})
+		assert.NoError(t, err)
+	}
+
+	received := make(map[string]int)
+	err := queue.Consume(ctx, func(ctx context.Context, message StreamMessage) error {
+		id := message.Values["order_id"].(string)
+		received[id]++
+		if id == "2" && received[id] == 1 {
+			return errors.New("retry later")
+		}
+		if len(received) == 3 && received["2"] == 2 {
+			cancel()
+		}
+		return nil
+	})
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, map[string]int{"1": 1, "2": 2, "3": 1}, received)
+}
+
+func TestStreamQueue_DeadLetter(t *testing.T) {
+	cache := newTestCache(t, "test:")
+	ctx := context.Background()
+	_, _ = cache.Delete(ctx, &DeleteRequest{Key: "stream-dead"})
+	cache.client.Del(ctx, "{test:stream-dead}:dead")
+
+	queue := NewStreamQueue(cache, &StreamQueueOptions{Stream: "stream-dead", Group: "workers", StartID: "0", Block: 100 * time.Millisecond})
+	// The group starts at StartID, so the message added before it is read
+	_, err := queue.Add(ctx, map[string]any{"order_id": "1"})
+	assert.NoError(t, err)
+	assert.NoError(t, queue.CreateGroup(ctx))
+	messages, err := queue.Read(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+
+	assert.NoError(t, queue.DeadLetter(ctx, messages[0]))
+	assert.NoError(t, queue.DeadLetter(ctx, messages[0]))
+	dead, err := cache.client.XRange(ctx, "{test:stream-dead}:dead", "-", "+").Result()
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+	assert.Equal(t, "1", dead[0].Values["x-deliveries"])
+	pending, err := cache.client.XPending(ctx, "test:stream-dead", "workers").Result()
+	assert.NoError(t, err)
+	assert.Zero(t, pending.Count)
+}
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+)
+
+// TypedOptions is a struct that represents the options of a Typed cache.
+// It contains the codec used to encode values, the compression algorithm,
+// and the size in bytes above which encoded values are compressed.
+type TypedOptions struct {
+	// Codec defaults to JSONCodec.
+	Codec Codec
+	// Compression defaults to CompressionNone.
+	Compression Compression
+	// CompressThreshold is the encoded size in bytes above which values are compressed.
+	CompressThreshold int
+}
+
+// Typed is a generic wrapper around Cache that stores values of type T.
+// Values are encoded with the configured Codec and optionally compressed,
+// and keys use the same prefix handling as Cache.
+//
+// Every value written by Typed starts with a byte naming its Compression, so Cache.Get returns it with
+// that byte. Values written without it, e.g. by Cache.Set before adopting Typed, are decoded as they are,
+// unless they start with the byte 0, 1 or 2 like a small integer encoded by MsgpackCodec.
+type Typed[T any] struct {
+	cache             *Cache
+	codec             Codec
+	compression       Compression
+	compressThreshold int
+}
+
+// NewTyped is a function that creates a new Typed cache on top of a Cache.
+// It takes a pointer to a Cache and a pointer to a TypedOptions struct, which may be nil,
+// and returns a pointer to the created Typed cache.
+func NewTyped[T any](cache *Cache, options *TypedOptions) *Typed[T] {
+	if options == nil {
+		options = &TypedOptions{}
+	}
+	codec := options.Codec
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	return &Typed[T]{
+		cache:             cache,
+		codec:             codec,
+		compression:       options.Compression,
+		compressThreshold: options.CompressThreshold,
+	}
+}
+
+func (t *Typed[T]) encode(value T) ([]byte, error) {
+	data, err := t.codec.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return compress(data, t.compression, t.compressThreshold)
+}
+
+func (t *Typed[T]) decode(data []byte) (T, error) {
+	var value T
+	data, err := decompress(data)
+	if err != nil {
+		return value, err
+	}
+	err = t.codec.Unmarshal(data, &value)
+	return value, err
+}
+
+// TypedSetRequest is a struct that represents a request to set a typed value in the cache.
+// It contains the key to set, the value to set it to, the expiration time in seconds,
+// and an optional custom prefix.
+type TypedSetRequest[T any] struct {
+	Key     string
+	Value   T
+	Seconds int64
+	Prefix  *string
+}
+
+// Set is a method of Typed that encodes a value and sets it in the cache.
+// It takes a context and a pointer to a TypedSetRequest struct,
+// and returns an error.
+func (t *Typed[T]) Set(ctx context.Context, request *TypedSetRequest[T]) error {
+	data, err := t.encode(request.Value)
+	if err != nil {
+		return err
+	}
+	return t.cache.Set(ctx, &SetCacheRequest{
+		Key:     request.Key,
+		Value:   data,
+		Seconds: request.Seconds,
+		Prefix:  request.Prefix,
+	})
+}
+
+// Get is a method of Typed that gets a value from the cache and decodes it.
+// It takes a context and a pointer to a GetCacheRequest struct,
+// and returns the decoded value and an error.
+// If the key does not exist, the error is redis.Nil.
+func (t *Typed[T]) Get(ctx context.Context, request *GetCacheRequest) (T, error) {
+	value, err := t.cache.Get(ctx, request)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return t.decode([]byte(value))
+}
+
+// TypedMGetRequest is a struct that represents a request to get several typed values from the cache.
+// It contains the keys to get and an optional custom prefix.
+type TypedMGetRequest struct {
+	Keys   []string
+	Prefix *string
+}
+
+// MGet is a method of Typed that gets several values from the cache in one round trip and decodes them.
+// It takes a context and a pointer to a TypedMGetRequest struct,
+// and returns a map of the found keys to their decoded values and an error.
+// Keys that do not exist are left out of the map.
+func (t *Typed[T]) MGet(ctx context.Context, request *TypedMGetRequest) (map[string]T, error) {
+	values, err := t.cache.MGet(ctx, &MGetRequest{Keys: request.Keys, Prefix: request.Prefix})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]T, len(values))
+	for key, value := range values {
+		decoded, err := t.decode([]byte(value))
+		if err != nil {
+			return nil, err
+		}
+		result[key] = decoded
+	}
+	return result, nil
+}
+
+// TypedMSetRequest is a struct that represents a request to set several typed values in the cache.
+// It contains the keys and values to set, the expiration time in seconds, and an optional custom prefix.
+type TypedMSetRequest[T any] struct {
+	Values  map[string]T
+	Seconds int64
+	Prefix  *string
+}
+
+// MSet is a method of Typed that encodes several values and sets them in the cache in one round trip.
+// It takes a context and a pointer to a TypedMSetRequest struct,
+// and returns an error.
+func (t *Typed[T]) MSet(ctx context.Context, request *TypedMSetRequest[T]) error {
+	items := make([]MSetItem, 0, len(request.Values))
+	for key, value := range request.Values {
+		data, err := t.encode(value)
+		if err != nil {
+			return err
+		}
+		items = append(items, MSetItem{Key: key, Value: data, Seconds: request.Seconds})
+	}
+	return t.cache.MSet(ctx, &MSetRequest{Items: items, Prefix: request.Prefix})
+}
+
+// TypedRememberRequest is a struct that represents a request to get a typed value from the cache,
+// or to set it using a callback function if it does not exist.
+// It contains the key, the expiration time in seconds, the callback function and an optional custom prefix.
+type TypedRememberRequest[T any] struct {
+	Key      string
+	Seconds  int64
+	Callback func() (T, error)
+	Prefix   *string
+}
+
+// Remember is a method of Typed that retrieves a value from the cache if it exists,
+// or sets it using a callback function if it does not.
+// It takes a context and a pointer to a TypedRememberRequest struct,
+// and returns the decoded value and an error.
+func (t *Typed[T]) Remember(ctx context.Context, request *TypedRememberRequest[T]) (T, error) {
+	var zero T
+	data, err := t.cache.Remember(ctx, &RememberRequest{
+		Key:     request.Key,
+		Seconds: request.Seconds,
+		Callback: func() ([]byte, error) {
+			value, err := request.Callback()
+			if err != nil {
+				return nil, err
+			}
+			return t.encode(value)
+		},
+		Prefix: request.Prefix,
+	})
+	if err != nil {
+		return zero, err
+	}
+	return t.decode(data)
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type typedUser struct {
+	Id   int64
+	Name string
+}
+
+func TestTyped_Codecs(t *testing.T) {
+	codecs := map[string]Codec{
+		"json":    JSONCodec{},
+		"msgpack": MsgpackCodec{},
+		"gob":     GobCodec{},
+	}
+	for name, codec := range codecs {
+		for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+			typed := NewTyped[typedUser](nil, &TypedOptions{Codec: codec, Compression: compression, CompressThreshold: 8})
+			user := typedUser{Id: 1, Name: strings.Repeat("truman", 10)}
+			data, err := typed.encode(user)
+			assert.NoError(t, err, name)
+			assert.Equal(t, byte(compression), data[0], name)
+			ret, err := typed.decode(data)
+			assert.NoError(t, err, name)
+			assert.Equal(t, user, ret, name)
+		}
+	}
+
+	typed := NewTyped[*wrapperspb.StringValue](nil, &TypedOptions{Codec: ProtobufCodec{}})
+	data, err := typed.encode(wrapperspb.String("truman"))
+	assert.NoError(t, err)
+	ret, err := typed.decode(data)
+	assert.NoError(t, err)
+	assert.True(t, proto.Equal(wrapperspb.String("truman"), ret))
+}
+
+func TestTyped_SetGet(t *testing.T) {
+	ctx := context.Background()
+	typed := NewTyped[typedUser](newTestCache(t, "test:"), &TypedOptions{
+		Codec:             MsgpackCodec{},
+		Compression:       CompressionZstd,
+		CompressThreshold: 16,
+	})
+
+	err := typed.Set(ctx, &TypedSetRequest[typedUser]{Key: "typed", Value: typedUser{Id: 1, Name: "truman"}, Seconds: 60})
+	assert.NoError(t, err)
+	user, err := typed.Get(ctx, &GetCacheRequest{Key: "typed"})
+	assert.NoError(t, err)
+	assert.Equal(t, typedUser{Id: 1, Name: "truman"}, user)
+
+	_, err = typed.Get(ctx, &GetCacheRequest{Key: "typed-missing"})
+	assert.True(t, IsMiss(err))
+
+	err = typed.MSet(ctx, &TypedMSetRequest[typedUser]{
+		Values: map[string]typedUser{
+			"typed-1": {Id: 1, Name: "a"},
+			"typed-2": {Id: 2, Name: "b"},
+		},
+		Seconds: 60,
+	})
+	assert.NoError(t, err)
+	users, err := typed.MGet(ctx, &TypedMGetRequest{Keys: []string{"typed-1", "typed-2", "typed-missing"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]typedUser{
+		"typed-1": {Id: 1, Name: "a"},
+		"typed-2": {Id: 2, Name: "b"},
+	}, users)
+}
+
+func TestTyped_Remember(t *testing.T) {
+	ctx := context.Background()
+	cache := newTestCache(t, "test:")
+	_, _ = cache.Delete(ctx, &DeleteRequest{Key: "typed-remember"})
+	typed := NewTyped[[]int](cache, nil)
+
+	calls := 0
+	for i := 0; i < 2; i++ {
+		ret, err := typed.Remember(ctx, &TypedRememberRequest[[]int]{
+			Key:     "typed-remember",
+			Seconds: 60,
+			Callback: func() ([]int, error) {
+				calls++
+				return []int{1, 2, 3}, nil
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 3}, ret)
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestTyped_GetRaw(t *testing.T) {
+	ctx := context.Background()
+	cache := newTestCache(t, "test:")
+	// A value written before adopting Typed has no compression header
+	assert.NoError(t, cache.Set(ctx, &SetCacheRequest{Key: "typed-raw", Value: []byte(`{"Id":1,"Name":"truman"}`), Seconds: 60}))
+	typed := NewTyped[typedUser](cache, nil)
+	user, err := typed.Get(ctx, &GetCacheRequest{Key: "typed-raw"})
+	assert.NoError(t, err)
+	assert.Equal(t, typedUser{Id: 1, Name: "truman"}, user)
+	users, err := typed.MGet(ctx, &TypedMGetRequest{Keys: []string{"typed-raw"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]typedUser{"typed-raw": {Id: 1, Name: "truman"}}, users)
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ZIncrByRequest is a struct that represents a request to increment the score of a member of a sorted set.
+// It contains the key of the sorted set, the member, the increment, and an optional custom prefix.
+type ZIncrByRequest struct {
+	Key    string
+	Member string
+	Value  float64
+	Prefix *string
+}
+
+// ZIncrBy is a method of Cache that increments the score of a member of a sorted set in the cache.
+// It takes a context and a pointer to a ZIncrByRequest struct,
+// and returns the new score of the member as a float64 and an error.
+// The method uses the Redis ZINCRBY command to increment the score.
+func (c *Cache) ZIncrBy(ctx context.Context, request *ZIncrByRequest) (float64, error) {
+	return c.client.ZIncrBy(ctx, c.prefixKey(request.Key, request.Prefix), request.Value, request.Member).Result()
+}
+
+// ZScoreRequest is a struct that represents a request to get the score of a member of a sorted set.
+// It contains the key of the sorted set, the member, and an optional custom prefix.
+type ZScoreRequest struct {
+	Key    string
+	Member string
+	Prefix *string
+}
+
+// ZScore is a method of Cache that gets the score of a member of a sorted set in the cache.
+// It takes a context and a pointer to a ZScoreRequest struct,
+// and returns the score as a float64 and an error.
+// If the member does not exist, the error is redis.Nil.
+// The method uses the Redis ZSCORE command to get the score.
+func (c *Cache) ZScore(ctx context.Context, request *ZScoreRequest) (float64, error) {
+	return c.client.ZScore(ctx, c.prefixKey(request.Key, request.Prefix), request.Member).Result()
+}
+
+// ZRevRank is a method of Cache that gets the rank of a member in a sorted set ordered from the highest score.
+// It takes a context and a pointer to a ZRankRequest struct,
+// and returns the rank of the member as an int64 and an error.
+// If the member does not exist, the error is redis.Nil.
+// The method uses the Redis ZREVRANK command to get the rank.
+func (c *Cache) ZRevRank(ctx context.Context, request *ZRankRequest) (int64, error) {
+	return c.client.ZRevRank(ctx, c.prefixKey(request.Key, request.Prefix), request.Member).Result()
+}
+
+// ZRevRange is a method of Cache that gets a range of members from a sorted set ordered from the highest score.
+// It takes a context and a pointer to a ZRangeRequest struct,
+// and returns the members as a slice of strings and an error.
+// The method uses the Redis ZREVRANGE command to get the members.
+func (c *Cache) ZRevRange(ctx context.Context, request *ZRangeRequest) ([]string, error) {
+	return c.client.ZRevRange(ctx, c.prefixKey(request.Key, request.Prefix), request.Start, request.End).Result()
+}
+
+// ZRangeWithScores is a method of Cache that gets a range of members and their scores from a sorted set.
+// It takes a context and a pointer to a ZRangeRequest struct,
+// and returns the members and their scores as a slice of redis.Z and an error.
+// The method uses the Redis ZRANGE command with WITHSCORES to get the members.
+func (c *Cache) ZRangeWithScores(ctx context.Context, request *ZRangeRequest) ([]redis.Z, error) {
+	return c.client.ZRangeWithScores(ctx, c.prefixKey(request.Key, request.Prefix), request.Start, request.End).Result()
+}
+
+// ZRevRangeWithScores is a method of Cache that gets a range of members and their scores from a sorted set
+// ordered from the highest score.
+// It takes a context and a pointer to a ZRangeRequest struct,
+// and returns the members and their scores as a slice of redis.Z and an error.
+// The method uses the Redis ZREVRANGE command with WITHSCORES to get the members.
+func (c *Cache) ZRevRangeWithScores(ctx context.Context, request *ZRangeRequest) ([]redis.Z, error) {
+	return c.client.ZRevRangeWithScores(ctx, c.prefixKey(request.Key, request.Prefix), request.Start, request.End).Result()
+}
+
+// ZCountRequest is a struct that represents a request to count the members of a sorted set within a score range.
+// It contains the key of the sorted set, the minimum and maximum scores, and an optional custom prefix.
+// Min and Max accept the Redis syntax, such as "-inf", "+inf" or "(10" for an exclusive bound.
+type ZCountRequest struct {
+	Key    string
+	Min    string
+	Max    string
+	Prefix *string
+}
+
+// ZCount is a method of Cache that counts the members of a sorted set with a score within a range.
+// It takes a context and a pointer to a ZCountRequest struct,
+// and returns the number of members as an int64 and an error.
+// The method uses the Redis ZCOUNT command to count the members.
+func (c *Cache) ZCount(ctx context.Context, request *ZCountRequest) (int64, error) {
+	return c.client.ZCount(ctx, c.prefixKey(request.Key, request.Prefix), request.Min, request.Max).Result()
+}
+
+// ZRemRangeByRankRequest is a struct that represents a request to remove members of a sorted set by rank.
+// It contains the key of the sorted set, the start and end ranks, and an optional custom prefix.
+type ZRemRangeByRankRequest struct {
+	Key    string
+	Start  int64
+	End    int64
+	Prefix *string
+}
+
+// ZRemRangeByRank is a method of Cache that removes the members of a sorted set within a range of ranks.
+// It takes a context and a pointer to a ZRemRangeByRankRequest struct,
+// and returns the number of members that were removed and an error.
+// The method uses the Redis ZREMRANGEBYRANK command to remove the members.
+func (c *Cache) ZRemRangeByRank(ctx context.Context, request *ZRemRangeByRankRequest) (int64, error) {
+	return c.client.ZRemRangeByRank(ctx, c.prefixKey(request.Key, request.Prefix), request.Start, request.End).Result()
+}
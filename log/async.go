@@ -0,0 +1,163 @@
+package log
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultAsyncBufferSize = 1024
+
+// DropPolicy selects what an AsyncSink does with an entry when its buffer is full.
+type DropPolicy int
+
+const (
+	// Block waits for room in the buffer, slowing down the logging goroutines.
+	Block DropPolicy = iota
+	// DropNewest drops the entry being written.
+	DropNewest
+	// DropOldest drops the oldest buffered entry to make room for the entry being written.
+	DropOldest
+)
+
+// AsyncOptions is a struct that represents the options of an AsyncSink.
+// It contains the number of buffered entries and what to do when the buffer is full.
+type AsyncOptions struct {
+	// BufferSize defaults to 1024 entries.
+	BufferSize int
+	DropPolicy DropPolicy
+}
+
+// AsyncSink writes the entries to a Sink on a background goroutine, so that logging
+// does not wait for the disk. Flush and Close wait for the buffered entries to be written.
+type AsyncSink struct {
+	sink    Sink
+	policy  DropPolicy
+	entries chan []byte
+	flushes chan chan error
+	dropped atomic.Int64
+
+	// mu guards closed, so that no entry is sent once the writing goroutine stopped.
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewAsyncSink creates an AsyncSink writing to sink. Options may be nil.
+func NewAsyncSink(sink Sink, options *AsyncOptions) *AsyncSink {
+	if options == nil {
+		options = &AsyncOptions{}
+	}
+	size := options.BufferSize
+	if size <= 0 {
+		size = defaultAsyncBufferSize
+	}
+	s := &AsyncSink{
+		sink:    sink,
+		policy:  options.DropPolicy,
+		entries: make(chan []byte, size),
+		flushes: make(chan chan error),
+		done:    make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+// run writes the entries until the sink is closed, then writes the remaining ones.
+func (s *AsyncSink) run() {
+	defer s.wg.Done()
+	for {
+		select {
+		case p := <-s.entries:
+			_, _ = s.sink.Write(p)
+		case reply := <-s.flushes:
+			s.drain()
+			reply <- s.sink.Flush()
+		case <-s.done:
+			s.drain()
+			return
+		}
+	}
+}
+
+// drain writes the buffered entries.
+func (s *AsyncSink) drain() {
+	for {
+		select {
+		case p := <-s.entries:
+			_, _ = s.sink.Write(p)
+		default:
+			return
+		}
+	}
+}
+
+// Write buffers a copy of the entry. It returns os.ErrClosed once the sink is closed.
+// Errors of the underlying sink are not reported.
+func (s *AsyncSink) Write(p []byte) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return 0, os.ErrClosed
+	}
+	// The formatters reuse their buffer
+	entry := append([]byte(nil), p...)
+	switch s.policy {
+	case DropNewest:
+		select {
+		case s.entries <- entry:
+		default:
+			s.dropped.Add(1)
+		}
+	case DropOldest:
+		for {
+			select {
+			case s.entries <- entry:
+				return len(p), nil
+			default:
+			}
+			select {
+			case <-s.entries:
+				s.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		s.entries <- entry
+	}
+	return len(p), nil
+}
+
+// Dropped returns the number of entries dropped because the buffer was full.
+func (s *AsyncSink) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Flush waits for the buffered entries to be written, and flushes the underlying sink.
+func (s *AsyncSink) Flush() error {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return s.sink.Flush()
+	}
+	reply := make(chan error, 1)
+	s.flushes <- reply
+	s.mu.RUnlock()
+	return <-reply
+}
+
+// Close writes the buffered entries and closes the underlying sink.
+func (s *AsyncSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+	close(s.done)
+	s.wg.Wait()
+	return s.sink.Close()
+}
@@ -0,0 +1,186 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ModuleField is the field holding the name of the module of the loggers created by Named.
+const ModuleField = "module"
+
+// LevelChange is a request to change the level of a module, see Logger.LevelHandler and cache.WatchLogLevels.
+// An empty Module is the root logger.
+type LevelChange struct {
+	Module string `json:"module"`
+	Level  string `json:"level"`
+}
+
+// family holds the loggers created from the same root logger by Named, by name.
+type family struct {
+	mu      sync.Mutex
+	loggers map[string]*Logger
+	// explicit are the loggers whose level was set, which do not follow the level of the root logger.
+	explicit map[string]bool
+	// pending are the levels set before their module logger was created.
+	pending map[string]logrus.Level
+}
+
+// lockedWriter serializes the writes of the loggers of a family, which have their own lock.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// Named returns the logger of a module, which adds the module field to its entries and has its own level.
+// It shares the output, the sinks and the trace key of the logger. The loggers of the modules of a module
+// are named after both, e.g. logger.Named("orders").Named("repository") is "orders.repository".
+// Named returns the same logger for the same name. Its level is the level of the root logger,
+// until it is set with SetLevel or SetModuleLevel, which may be called before the module logger is created.
+func (logger *Logger) Named(name string) *Logger {
+	if logger.name != "" {
+		name = logger.name + "." + name
+	}
+	f := logger.family
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if child, ok := f.loggers[name]; ok {
+		return child
+	}
+	root := f.loggers[""]
+	l := logrus.New()
+	l.Out = root.logger.Out
+	l.Formatter = root.logger.Formatter
+	l.Hooks = root.logger.Hooks
+	l.ExitFunc = root.logger.ExitFunc
+	l.ReportCaller = root.logger.ReportCaller
+	if level, ok := f.pending[name]; ok {
+		l.SetLevel(level)
+		f.explicit[name] = true
+		delete(f.pending, name)
+	} else {
+		l.SetLevel(root.logger.GetLevel())
+	}
+	child := &Logger{
+		traceKey: root.traceKey,
+		logger:   l,
+		sinks:    root.sinks,
+		name:     name,
+		fields:   logrus.Fields{ModuleField: name},
+		family:   f,
+	}
+	f.loggers[name] = child
+	return child
+}
+
+// Name returns the name of the module of the logger, empty for the root logger.
+func (logger *Logger) Name() string {
+	return logger.name
+}
+
+// GetLevel returns the level of the logger.
+func (logger *Logger) GetLevel() logrus.Level {
+	return logger.logger.GetLevel()
+}
+
+// SetLevel sets the level of the logger. Setting the level of the root logger also sets the level
+// of the module loggers whose level was not set.
+func (logger *Logger) SetLevel(level logrus.Level) {
+	f := logger.family
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	logger.setLevel(level)
+}
+
+// setLevel must be called with the mutex of the family held.
+func (logger *Logger) setLevel(level logrus.Level) {
+	logger.logger.SetLevel(level)
+	if logger.name != "" {
+		logger.family.explicit[logger.name] = true
+		return
+	}
+	for name, l := range logger.family.loggers {
+		if name != "" && !logger.family.explicit[name] {
+			l.logger.SetLevel(level)
+		}
+	}
+}
+
+// SetModuleLevel sets the level of a module by name, e.g. "debug", see logrus.ParseLevel.
+// An empty module is the root logger. The level of a module without a logger yet is applied when it is created.
+func (logger *Logger) SetModuleLevel(module, level string) error {
+	l, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	f := logger.family
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if target, ok := f.loggers[module]; ok {
+		target.setLevel(l)
+	} else {
+		f.pending[module] = l
+	}
+	return nil
+}
+
+// Levels returns the levels of the root logger, under the empty name, and of the module loggers.
+func (logger *Logger) Levels() map[string]string {
+	f := logger.family
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	levels := make(map[string]string, len(f.loggers))
+	for name, l := range f.loggers {
+		levels[name] = l.logger.GetLevel().String()
+	}
+	return levels
+}
+
+// LevelHandler returns a handler changing the levels of the loggers at runtime. With gin, use gin.WrapH.
+// GET responds with the levels in JSON, see Levels. PUT and POST take a LevelChange in JSON,
+// or the module and level form values, and respond with the levels.
+// The handler should only be reachable by operators.
+func (logger *Logger) LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var change LevelChange
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+				if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+					writeLevelError(w, http.StatusBadRequest, err)
+					return
+				}
+			} else {
+				change.Module = r.FormValue("module")
+				change.Level = r.FormValue("level")
+			}
+			if err := logger.SetModuleLevel(change.Module, change.Level); err != nil {
+				writeLevelError(w, http.StatusBadRequest, err)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			writeLevelError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(logger.Levels())
+	})
+}
+
+func writeLevelError(w http.ResponseWriter, code int, err error) {
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,95 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger_Named(t *testing.T) {
+	var output bytes.Buffer
+	level := logrus.WarnLevel
+	logger := NewLogger(&Options{Output: &output, Level: &level})
+	assert.NoError(t, logger.SetModuleLevel("payments", "debug"))
+	orders := logger.Named("orders")
+	payments := logger.Named("payments")
+	repository := orders.Named("repository")
+	assert.Same(t, orders, logger.Named("orders"))
+	assert.Equal(t, "orders.repository", repository.Name())
+
+	orders.Info("hidden")
+	payments.WithTraceId("trace-1").Debug("charged")
+	assert.NotContains(t, output.String(), "hidden")
+	assert.Contains(t, output.String(), `"module":"payments"`)
+	assert.Contains(t, output.String(), `"X-Trace-Id":"trace-1"`)
+
+	// The root level applies to the modules whose level was not set
+	logger.SetLevel(logrus.ErrorLevel)
+	assert.Equal(t, logrus.ErrorLevel, orders.GetLevel())
+	assert.Equal(t, logrus.DebugLevel, payments.GetLevel())
+	assert.Error(t, logger.SetModuleLevel("orders", "verbose"))
+	assert.Equal(t, map[string]string{
+		"":                  "error",
+		"orders":            "error",
+		"orders.repository": "error",
+		"payments":          "debug",
+	}, logger.Levels())
+}
+
+func TestLogger_LevelHandler(t *testing.T) {
+	logger := NewLogger(&Options{Output: &bytes.Buffer{}})
+	orders := logger.Named("orders")
+	handler := logger.LevelHandler()
+
+	request := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"module":"orders","level":"debug"}`))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var levels map[string]string
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &levels))
+	assert.Equal(t, map[string]string{"": "info", "orders": "debug"}, levels)
+	assert.Equal(t, logrus.DebugLevel, orders.GetLevel())
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/?level=trace", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, logrus.TraceLevel, logger.GetLevel())
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/?level=loud", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestLogger_Sampling(t *testing.T) {
+	var output bytes.Buffer
+	sink := &bufferSink{}
+	logger := NewLogger(&Options{
+		Output:   &output,
+		Sinks:    []Route{{Sink: sink}},
+		Sampling: &SamplingOptions{First: 2, Thereafter: 3},
+	})
+	orders := logger.Named("orders")
+	for i := 0; i < 8; i++ {
+		logger.Infof("polled")
+		orders.WithField("i", i).Info("polled")
+	}
+	logger.Warn("polled")
+
+	// The first 2 entries of each key are logged, then the 5th and the 8th
+	assert.Equal(t, 9, strings.Count(output.String(), "\n"))
+	assert.Equal(t, output.String(), sink.String())
+	assert.Equal(t, 4, strings.Count(output.String(), `"module":"orders"`))
+	assert.Contains(t, output.String(), `"i":7`)
+	assert.NotContains(t, output.String(), `"i":2`)
+	assert.Contains(t, output.String(), `"level":"warning"`)
+}
@@ -2,6 +2,7 @@ package log
 
 import (
 	"context"
+	"errors"
 	"io"
 	"os"
 
@@ -16,12 +17,25 @@ import (
 type Logger struct {
 	traceKey string         // The key used to retrieve the trace ID from the context.
 	logger   *logrus.Logger // The underlying logrus logger.
+	sinks    *sinkHook      // The sinks the entries are routed to, nil without sinks.
+	name     string         // The name of the module, empty for the root logger.
+	fields   logrus.Fields  // The fields added to every entry, e.g. the module.
+	family   *family        // The loggers sharing the output and the levels registry.
 }
 
 type Options struct {
 	TraceKey  *string
 	Formatter logrus.Formatter
 	Output    io.Writer
+	// Sinks receive the entries of the levels routed to them, e.g. the errors in their own file.
+	// Without Output, the entries are only written to the sinks.
+	Sinks []Route
+	// Level is the level of the logger and of its module loggers. Defaults to logrus.InfoLevel.
+	Level *logrus.Level
+	// Sampling samples the entries of high-volume keys. Nil logs every entry.
+	Sampling *SamplingOptions
+	// Redaction redacts the sensitive values of the entries, such as tokens or phones. Nil redacts nothing.
+	Redaction *RedactionOptions
 }
 
 // NewLogger creates a new Logger instance with configurable options.
@@ -47,21 +61,53 @@ type Options struct {
 //	  Output:    os.Stderr,
 //	}
 //	logger := log.NewLogger(loggerOptions)
+//
+// Entries can also be routed to sinks, such as rotating files:
+//
+//	errorLog, _ := log.NewRotatingFile(&log.RotatingFileOptions{Filename: "logs/error.log", MaxSize: 100 << 20, Compress: true})
+//	logger := log.NewLogger(&log.Options{
+//	  Sinks: []log.Route{
+//	    {Sink: log.NewWriterSink(os.Stdout)},
+//	    {Sink: errorLog, Levels: log.AtLeast(logrus.ErrorLevel)},
+//	  },
+//	})
+//	defer logger.Close()
+//
+// Modules log through their own logger, whose level can be changed at runtime:
+//
+//	orders := logger.Named("orders")
+//	router.Any("/debug/log-levels", gin.WrapH(logger.LevelHandler()))
+//
+// Sensitive values are redacted before they are formatted:
+//
+//	logger := log.NewLogger(&log.Options{
+//	  Redaction: &log.RedactionOptions{
+//	    Rules:     []log.RedactRule{{Fields: []string{"password", "Authorization"}}},
+//	    Detectors: true,
+//	  },
+//	})
 func NewLogger(options *Options) *Logger {
 	if options == nil {
 		options = &Options{}
 	}
 	logger := logrus.New()
-	if options.Formatter != nil {
-		logger.SetFormatter(options.Formatter)
-	} else {
-		logger.SetFormatter(&logrus.JSONFormatter{})
+	formatter := options.Formatter
+	if formatter == nil {
+		formatter = &logrus.JSONFormatter{}
 	}
+	logger.SetFormatter(formatter)
 
 	if options.Output != nil {
-		logger.SetOutput(options.Output)
+		// The module loggers write to the output as well
+		logger.SetOutput(&lockedWriter{w: options.Output})
+	} else if len(options.Sinks) > 0 {
+		logger.SetOutput(io.Discard)
+		logger.SetFormatter(discardFormatter{})
 	} else {
-		logger.SetOutput(os.Stdout)
+		logger.SetOutput(&lockedWriter{w: os.Stdout})
+	}
+	if options.Level != nil {
+		logger.SetLevel(*options.Level)
 	}
 
 	key := "X-Trace-Id"
@@ -69,16 +115,68 @@ func NewLogger(options *Options) *Logger {
 		key = *options.TraceKey
 	}
 
-	return &Logger{
+	l := &Logger{
 		traceKey: key,
 		logger:   logger,
+		family: &family{
+			explicit: make(map[string]bool),
+			pending:  make(map[string]logrus.Level),
+		},
+	}
+	l.family.loggers = map[string]*Logger{"": l}
+	if options.Sampling != nil {
+		// The sampling hook fires first, so that the sinks skip the dropped entries
+		logger.AddHook(newSamplingHook(options.Sampling))
+		logger.SetFormatter(sampledFormatter{Formatter: logger.Formatter})
 	}
+	if options.Redaction != nil {
+		// Hooks fire in order, the entries are redacted before the sinks format them
+		logger.AddHook(newRedactionHook(options.Redaction))
+	}
+	if len(options.Sinks) > 0 {
+		l.sinks = newSinkHook(options.Sinks, formatter)
+		logger.AddHook(l.sinks)
+		// Fatal exits the program, write the buffered entries first
+		logger.ExitFunc = func(code int) {
+			_ = l.Close()
+			os.Exit(code)
+		}
+	}
+	return l
+}
+
+// Flush writes the entries buffered by the sinks of the Logger.
+func (logger *Logger) Flush() error {
+	if logger.sinks == nil {
+		return nil
+	}
+	var errs []error
+	for _, sink := range logger.sinks.sinks() {
+		errs = append(errs, sink.Flush())
+	}
+	return errors.Join(errs...)
 }
 
-// withTraceKey is an internal method that returns a base logrus Entry.
+// Close flushes and closes the sinks of the Logger. It should be called before the program exits.
+func (logger *Logger) Close() error {
+	if logger.sinks == nil {
+		return nil
+	}
+	var errs []error
+	for _, sink := range logger.sinks.sinks() {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// withTraceKey is an internal method that returns a base logrus Entry, with the module of the logger.
 // Use WithContext or WithTraceId for trace-aware logging.
 func (logger *Logger) withTraceKey() *logrus.Entry {
-	return logger.logger.WithContext(context.Background())
+	entry := logger.logger.WithContext(context.Background())
+	if len(logger.fields) > 0 {
+		entry = entry.WithFields(logger.fields)
+	}
+	return entry
 }
 
 // WithContext returns a logrus Entry with the traceId extracted from the provided context.
@@ -93,10 +191,10 @@ func (logger *Logger) withTraceKey() *logrus.Entry {
 func (logger *Logger) WithContext(ctx context.Context) *logrus.Entry {
 	if logger.traceKey != "" {
 		if traceId, ok := ctx.Value(logger.traceKey).(string); ok {
-			return logger.logger.WithField(logger.traceKey, traceId)
+			return logger.withTraceKey().WithField(logger.traceKey, traceId)
 		}
 	}
-	return logger.logger.WithContext(ctx)
+	return logger.withTraceKey().WithContext(ctx)
 }
 
 // WithTraceId returns a logrus Entry with the provided traceId.
@@ -107,9 +205,9 @@ func (logger *Logger) WithContext(ctx context.Context) *logrus.Entry {
 //	logger.WithTraceId("abc-123").Info("处理请求")
 func (logger *Logger) WithTraceId(traceId string) *logrus.Entry {
 	if logger.traceKey != "" && traceId != "" {
-		return logger.logger.WithField(logger.traceKey, traceId)
+		return logger.withTraceKey().WithField(logger.traceKey, traceId)
 	}
-	return logger.logger.WithContext(context.Background())
+	return logger.withTraceKey()
 }
 
 // WithField is a method on the Logger struct.
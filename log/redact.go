@@ -0,0 +1,265 @@
+package log
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"github.com/trumanwong/go-tools/helper"
+	"github.com/trumanwong/go-tools/validate"
+)
+
+// Redacted replaces the values of the redacted fields.
+const Redacted = "******"
+
+// RedactMode selects how a RedactRule replaces a value.
+type RedactMode int
+
+const (
+	// Mask replaces the value of a field with Redacted, and the middle of a matched value with stars,
+	// e.g. 138****5678.
+	Mask RedactMode = iota
+	// Hash replaces the value with a hash, so that the entries of a value can be correlated
+	// without revealing it, see RedactionOptions.HashKey.
+	Hash
+)
+
+// RedactRule is a struct that represents what a Logger redacts, and how.
+// A rule redacts the fields named in Fields, the parts of the string values matching Pattern,
+// and the string values for which Detector returns true.
+type RedactRule struct {
+	// Fields are the names of the redacted fields, case-insensitive, e.g. "password" or "Authorization".
+	// The fields of the maps and structs logged as a value, such as an http.Header, are redacted too.
+	// Structs are matched by the names of their JSON encoding.
+	Fields   []string
+	Pattern  *regexp.Regexp
+	Detector func(string) bool
+	Mode     RedactMode
+}
+
+// RedactionOptions is a struct that represents the redaction of the entries of a Logger.
+// Values are redacted in the message, and in the strings, errors, maps, slices and structs of the fields,
+// before any formatter or sink sees the entry. Structs and pointers are logged as their redacted JSON encoding.
+type RedactionOptions struct {
+	Rules []RedactRule
+	// Detectors enables the built-in detectors of the ID card numbers, see helper.CheckIdCard,
+	// the phones, see validate.CheckPhone, and the emails, see validate.CheckEmail, within string values.
+	Detectors bool
+	// DetectorMode is how the values found by the built-in detectors are replaced.
+	DetectorMode RedactMode
+	// HashKey keys the HMAC-SHA256 of the hashed values. Without a key, short values
+	// such as phones can be recovered from their hash by brute force.
+	HashKey []byte
+}
+
+// detectorCandidates finds the values checked by the built-in detectors.
+var detectorCandidates = regexp.MustCompile(`[\w.+-]+@[\w-]+(?:\.[\w-]+)+|\b\d{17}[\dXx]\b|\b\d{11}\b`)
+
+// redactionHook redacts the entries before the sinks and the output of the logger format them.
+type redactionHook struct {
+	fields   map[string]RedactMode
+	patterns []RedactRule
+	options  RedactionOptions
+}
+
+func newRedactionHook(options *RedactionOptions) *redactionHook {
+	h := &redactionHook{fields: make(map[string]RedactMode), options: *options}
+	for _, rule := range options.Rules {
+		for _, field := range rule.Fields {
+			h.fields[strings.ToLower(field)] = rule.Mode
+		}
+		if rule.Pattern != nil || rule.Detector != nil {
+			h.patterns = append(h.patterns, rule)
+		}
+	}
+	return h
+}
+
+func (h *redactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *redactionHook) Fire(entry *logrus.Entry) error {
+	if sampledOut(entry) {
+		return nil
+	}
+	entry.Message = h.redactString(entry.Message)
+	for key, value := range entry.Data {
+		// Data is a copy of the fields for this entry
+		entry.Data[key] = h.redactField(key, value)
+	}
+	return nil
+}
+
+// redactField redacts the value of a field, or the whole value if the field is redacted.
+func (h *redactionHook) redactField(key string, value any) any {
+	if mode, ok := h.fields[strings.ToLower(key)]; ok {
+		if mode == Hash {
+			return h.hash(fmt.Sprint(value))
+		}
+		return Redacted
+	}
+	return h.redactValue(value)
+}
+
+// redactValue redacts a value, copying the maps and slices instead of modifying them.
+func (h *redactionHook) redactValue(value any) any {
+	switch v := value.(type) {
+	case string:
+		return h.redactString(v)
+	case []byte:
+		return h.redactString(string(v))
+	case error:
+		if message := h.redactString(v.Error()); message != v.Error() {
+			return errors.New(message)
+		}
+		return v
+	case http.Header:
+		return redactMap(v, func(key string, values []string) any { return h.redactStrings(key, values) })
+	case map[string][]string:
+		return redactMap(v, func(key string, values []string) any { return h.redactStrings(key, values) })
+	case map[string]string:
+		return redactMap(v, func(key, value string) any { return h.redactField(key, value) })
+	case map[string]any:
+		return redactMap(v, h.redactField)
+	case logrus.Fields:
+		return redactMap(v, h.redactField)
+	case []string:
+		redacted := make([]string, len(v))
+		for i, s := range v {
+			redacted[i] = h.redactString(s)
+		}
+		return redacted
+	case []any:
+		redacted := make([]any, len(v))
+		for i, e := range v {
+			redacted[i] = h.redactValue(e)
+		}
+		return redacted
+	case time.Time, time.Duration:
+		return value
+	}
+	return h.redactJSON(value)
+}
+
+// redactJSON redacts structs, pointers, and the maps and slices of other types through their JSON encoding,
+// so that their fields are matched by name like the keys of a map. The value is kept unless something
+// was redacted, and numbers are decoded as json.Number so that large integers keep their precision.
+func (h *redactionHook) redactJSON(value any) any {
+	if value == nil {
+		return nil
+	}
+	switch reflect.TypeOf(value).Kind() {
+	case reflect.Struct, reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Array:
+	default:
+		return value
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var decoded any
+	if err = decoder.Decode(&decoded); err != nil {
+		return value
+	}
+	redacted := h.redactValue(decoded)
+	// Compare the encodings, as decoded and redacted both have their map keys sorted
+	before, err := json.Marshal(decoded)
+	if err != nil {
+		return value
+	}
+	after, err := json.Marshal(redacted)
+	if err != nil || bytes.Equal(before, after) {
+		return value
+	}
+	return redacted
+}
+
+// redactStrings redacts the values of a header.
+func (h *redactionHook) redactStrings(key string, values []string) []string {
+	redacted := make([]string, len(values))
+	for i, value := range values {
+		if s, ok := h.redactField(key, value).(string); ok {
+			redacted[i] = s
+		}
+	}
+	return redacted
+}
+
+func redactMap[M ~map[string]V, V any](m M, redact func(string, V) any) map[string]any {
+	redacted := make(map[string]any, len(m))
+	for key, value := range m {
+		redacted[key] = redact(key, value)
+	}
+	return redacted
+}
+
+// redactString replaces the parts of s matched by the rules and the built-in detectors.
+func (h *redactionHook) redactString(s string) string {
+	for _, rule := range h.patterns {
+		if rule.Detector != nil && rule.Detector(s) {
+			return h.replace(s, rule.Mode)
+		}
+		if rule.Pattern != nil {
+			s = rule.Pattern.ReplaceAllStringFunc(s, func(match string) string { return h.replace(match, rule.Mode) })
+		}
+	}
+	if h.options.Detectors {
+		s = detectorCandidates.ReplaceAllStringFunc(s, func(candidate string) string {
+			if isSensitive(candidate) {
+				return h.replace(candidate, h.options.DetectorMode)
+			}
+			return candidate
+		})
+	}
+	return s
+}
+
+// isSensitive returns whether the candidate is an ID card number, a phone or an email.
+func isSensitive(candidate string) bool {
+	switch {
+	case strings.Contains(candidate, "@"):
+		return validate.CheckEmail(candidate)
+	case len(candidate) == 18:
+		return helper.CheckIdCard(strings.ToUpper(candidate))
+	default:
+		return validate.CheckPhone(candidate)
+	}
+}
+
+func (h *redactionHook) replace(s string, mode RedactMode) string {
+	if mode == Hash {
+		return h.hash(s)
+	}
+	return mask(s)
+}
+
+// hash returns the truncated HMAC-SHA256 of s.
+func (h *redactionHook) hash(s string) string {
+	mac := hmac.New(sha256.New, h.options.HashKey)
+	mac.Write([]byte(s))
+	return "sha256:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// mask keeps the first 3 and last 4 characters of the values long enough to stay unrecognizable.
+func mask(s string) string {
+	n := utf8.RuneCountInString(s)
+	if n < 11 {
+		return strings.Repeat("*", n)
+	}
+	runes := []rune(s)
+	return string(runes[:3]) + strings.Repeat("*", n-7) + string(runes[n-4:])
+}
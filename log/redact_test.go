@@ -0,0 +1,100 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger_Redaction(t *testing.T) {
+	var output bytes.Buffer
+	sink := &bufferSink{}
+	logger := NewLogger(&Options{
+		Output: &output,
+		Sinks:  []Route{{Sink: sink, Formatter: &logrus.TextFormatter{DisableTimestamp: true}}},
+		Redaction: &RedactionOptions{
+			Rules: []RedactRule{
+				{Fields: []string{"password", "Authorization"}},
+				{Fields: []string{"user_id"}, Mode: Hash},
+				{Pattern: regexp.MustCompile(`card=\d+`)},
+			},
+			Detectors: true,
+			HashKey:   []byte("key"),
+		},
+	})
+	header := http.Header{"Authorization": {"Bearer secret"}, "Accept": {"application/json"}}
+	body := `{"id_card":"11010519491231002X","phone":"13812345678","email":"alice@example.com","order":"20240101123"}`
+	logger.WithFields(logrus.Fields{
+		"password": "hunter2",
+		"user_id":  42,
+		"header":   header,
+		"body":     body,
+	}).WithError(errors.New("declined card=4111111111111111")).Info("paid by 13812345678")
+
+	entry := output.String()
+	for _, secret := range []string{"hunter2", "Bearer secret", "11010519491231002X", "13812345678", "alice@example.com", "4111111111111111"} {
+		assert.NotContains(t, entry, secret)
+		assert.NotContains(t, sink.String(), secret)
+	}
+	assert.Contains(t, entry, `"password":"******"`)
+	assert.Contains(t, entry, `"Authorization":["******"]`)
+	assert.Contains(t, entry, `"Accept":["application/json"]`)
+	assert.Contains(t, entry, `138****5678`)
+	assert.Contains(t, entry, `110***********002X`)
+	// Not a valid phone
+	assert.Contains(t, entry, `20240101123`)
+	assert.Regexp(t, `"user_id":"sha256:[0-9a-f]{16}"`, entry)
+	assert.Contains(t, entry, `declined car**************1111`)
+	assert.True(t, strings.HasPrefix(sink.String(), "level=info msg=\"paid by 138****5678\""))
+
+	// The logged values are not modified
+	assert.Equal(t, "Bearer secret", header.Get("Authorization"))
+}
+
+func TestLogger_RedactionStruct(t *testing.T) {
+	var output bytes.Buffer
+	logger := NewLogger(&Options{
+		Output: &output,
+		Redaction: &RedactionOptions{
+			Rules:     []RedactRule{{Fields: []string{"password"}}},
+			Detectors: true,
+		},
+	})
+	type credentials struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	type user struct {
+		ID          int64
+		Phone       string
+		Credentials *credentials `json:"credentials"`
+	}
+	type order struct {
+		ID int64
+	}
+	value := &user{ID: 1234567890123456789, Phone: "13812345678", Credentials: &credentials{Username: "alice", Password: "hunter2"}}
+	logger.WithFields(logrus.Fields{
+		"user":  value,
+		"order": order{ID: 1234567890123456789},
+		"ids":   []int64{1234567890123456789},
+	}).Info("signed up")
+
+	entry := output.String()
+	assert.NotContains(t, entry, "hunter2")
+	assert.NotContains(t, entry, "13812345678")
+	assert.Contains(t, entry, `"password":"******"`)
+	assert.Contains(t, entry, `"username":"alice"`)
+	assert.Contains(t, entry, `"Phone":"138****5678"`)
+	// Large integers keep their precision, whether something was redacted or not
+	assert.Contains(t, entry, `"user":{"ID":1234567890123456789,`)
+	assert.Contains(t, entry, `"order":{"ID":1234567890123456789}`)
+	assert.Contains(t, entry, `"ids":[1234567890123456789]`)
+	// The logged value is not modified
+	assert.Equal(t, "hunter2", value.Credentials.Password)
+}
@@ -0,0 +1,281 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// backupTimeFormat is the timestamp in the names of the rotated files.
+	backupTimeFormat = "20060102T150405.000"
+	compressSuffix   = ".gz"
+)
+
+// RotatingFileOptions is a struct that represents the options of a RotatingFile.
+// It contains the path of the file, when to rotate it, and which rotated files to keep.
+type RotatingFileOptions struct {
+	Filename string
+	// MaxSize rotates the file before it exceeds MaxSize bytes. 0 disables the rotation by size.
+	MaxSize int64
+	// Interval rotates the file at every multiple of Interval since the zero time, in UTC:
+	// 24 * time.Hour rotates it at midnight UTC. 0 disables the rotation by time.
+	Interval time.Duration
+	// MaxBackups is the number of rotated files kept. 0 keeps them all.
+	MaxBackups int
+	// MaxAge deletes the files rotated longer than MaxAge ago. 0 keeps them all.
+	MaxAge time.Duration
+	// Compress compresses the rotated files with gzip.
+	Compress bool
+}
+
+// RotatingFile is a Sink writing to a file that is rotated by size and time.
+// The rotated files are renamed with the time of the rotation, e.g. app-20060102T150405.000.log,
+// then compressed and deleted in the background.
+type RotatingFile struct {
+	options RotatingFileOptions
+
+	mu           sync.Mutex
+	file         *os.File
+	size         int64
+	nextRotation time.Time
+
+	// mill compresses and deletes the rotated files, one run at a time.
+	mill     chan struct{}
+	millDone chan struct{}
+	closed   bool
+}
+
+// NewRotatingFile opens or creates the file, with its directory, and returns a RotatingFile writing to it.
+func NewRotatingFile(options *RotatingFileOptions) (*RotatingFile, error) {
+	if options.Filename == "" {
+		return nil, errors.New("log: the filename of a rotating file is empty")
+	}
+	f := &RotatingFile{
+		options:  *options,
+		mill:     make(chan struct{}, 1),
+		millDone: make(chan struct{}),
+	}
+	if err := f.open(time.Now()); err != nil {
+		return nil, err
+	}
+	go f.runMill()
+	// Clean up the files rotated before a restart
+	f.mill <- struct{}{}
+	return f, nil
+}
+
+// open opens the file for appending. It must be called with mu held.
+func (f *RotatingFile) open(now time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(f.options.Filename), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.options.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	if f.options.Interval > 0 {
+		f.nextRotation = now.Truncate(f.options.Interval).Add(f.options.Interval)
+	}
+	return nil
+}
+
+// Write writes an entry, rotating the file first if the entry would exceed MaxSize
+// or the rotation interval has elapsed.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	now := time.Now()
+	bySize := f.options.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.options.MaxSize
+	byTime := f.options.Interval > 0 && !now.Before(f.nextRotation)
+	if bySize || byTime {
+		if err := f.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file now.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	return f.rotate(time.Now())
+}
+
+// rotate renames the file after the time of the rotation and opens a new one.
+// It must be called with mu held.
+func (f *RotatingFile) rotate(now time.Time) error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.options.Filename, f.backupName(now)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := f.open(now); err != nil {
+		return err
+	}
+	select {
+	case f.mill <- struct{}{}:
+	default:
+		// A run is already pending
+	}
+	return nil
+}
+
+// backupName returns an unused name for the file rotated at now.
+func (f *RotatingFile) backupName(now time.Time) string {
+	dir, prefix, ext := f.nameParts()
+	name := filepath.Join(dir, prefix+now.Format(backupTimeFormat)+ext)
+	for i := 1; fileExists(name) || fileExists(name+compressSuffix); i++ {
+		// Rotated twice within a millisecond
+		name = filepath.Join(dir, prefix+now.Add(time.Duration(i)*time.Millisecond).Format(backupTimeFormat)+ext)
+	}
+	return name
+}
+
+// nameParts splits the filename into its directory, the prefix of the rotated files, and its extension.
+func (f *RotatingFile) nameParts() (dir, prefix, ext string) {
+	dir = filepath.Dir(f.options.Filename)
+	base := filepath.Base(f.options.Filename)
+	ext = filepath.Ext(base)
+	return dir, strings.TrimSuffix(base, ext) + "-", ext
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// backup is a rotated file.
+type backup struct {
+	path      string
+	rotatedAt time.Time
+}
+
+// backups returns the rotated files, newest first.
+func (f *RotatingFile) backups() ([]backup, error) {
+	dir, prefix, ext := f.nameParts()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []backup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		timestamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), compressSuffix), ext)
+		rotatedAt, err := time.ParseInLocation(backupTimeFormat, timestamp, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(dir, name), rotatedAt: rotatedAt})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].rotatedAt.After(backups[j].rotatedAt) })
+	return backups, nil
+}
+
+func (f *RotatingFile) runMill() {
+	defer close(f.millDone)
+	for range f.mill {
+		_ = f.millOnce()
+	}
+}
+
+// millOnce deletes the rotated files beyond MaxBackups or MaxAge, and compresses the others.
+func (f *RotatingFile) millOnce() error {
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	cutoff := time.Now().Add(-f.options.MaxAge)
+	for i, b := range backups {
+		if (f.options.MaxBackups > 0 && i >= f.options.MaxBackups) || (f.options.MaxAge > 0 && b.rotatedAt.Before(cutoff)) {
+			errs = append(errs, os.Remove(b.path))
+			continue
+		}
+		if f.options.Compress && !strings.HasSuffix(b.path, compressSuffix) {
+			errs = append(errs, compressFile(b.path))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// compressFile replaces a file with its gzip compressed copy.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := path + compressSuffix + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+compressSuffix)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Flush commits the file to disk.
+func (f *RotatingFile) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+// Close closes the file, and waits for the rotated files to be compressed and deleted.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	err := f.file.Close()
+	close(f.mill)
+	f.mu.Unlock()
+	<-f.millDone
+	return err
+}
@@ -0,0 +1,116 @@
+package log
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSampleFirst  = 100
+	defaultSamplePeriod = time.Second
+)
+
+// SamplingOptions is a struct that represents the sampling of high-volume entries.
+// Entries are counted per key, which is their level, module and message, so that messages
+// should be constant with the variable parts in fields. In every period, the first entries
+// of a key are logged, then one in Thereafter.
+type SamplingOptions struct {
+	// Levels are the sampled levels. Defaults to debug and info.
+	Levels []logrus.Level
+	// First is the number of entries of a key logged in every period. Defaults to 100.
+	First int
+	// Thereafter logs one in Thereafter entries of a key after the first ones. 0 drops them.
+	Thereafter int
+	// Period defaults to 1 second.
+	Period time.Duration
+}
+
+// sampledKey marks the context of the entries dropped by the sampling.
+type sampledKey struct{}
+
+// samplingHook marks the entries to drop, before the sinks and the output of the logger skip them.
+type samplingHook struct {
+	levels     []logrus.Level
+	first      int
+	thereafter int
+	period     time.Duration
+
+	mu     sync.Mutex
+	start  time.Time
+	counts map[string]int
+}
+
+func newSamplingHook(options *SamplingOptions) *samplingHook {
+	h := &samplingHook{
+		levels:     options.Levels,
+		first:      options.First,
+		thereafter: options.Thereafter,
+		period:     options.Period,
+		counts:     make(map[string]int),
+	}
+	if len(h.levels) == 0 {
+		h.levels = []logrus.Level{logrus.DebugLevel, logrus.InfoLevel}
+	}
+	if h.first <= 0 {
+		h.first = defaultSampleFirst
+	}
+	if h.period <= 0 {
+		h.period = defaultSamplePeriod
+	}
+	return h
+}
+
+func (h *samplingHook) Levels() []logrus.Level {
+	return h.levels
+}
+
+func (h *samplingHook) Fire(entry *logrus.Entry) error {
+	if h.keep(entry) {
+		return nil
+	}
+	ctx := entry.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	entry.Context = context.WithValue(ctx, sampledKey{}, true)
+	return nil
+}
+
+// keep counts the entry and returns whether it is logged.
+func (h *samplingHook) keep(entry *logrus.Entry) bool {
+	module, _ := entry.Data[ModuleField].(string)
+	key := entry.Level.String() + "\x00" + module + "\x00" + entry.Message
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if now.Sub(h.start) >= h.period {
+		h.start = now
+		clear(h.counts)
+	}
+	h.counts[key]++
+	n := h.counts[key]
+	if n <= h.first {
+		return true
+	}
+	return h.thereafter > 0 && (n-h.first)%h.thereafter == 0
+}
+
+// sampledOut returns whether the sampling dropped the entry.
+func sampledOut(entry *logrus.Entry) bool {
+	return entry.Context != nil && entry.Context.Value(sampledKey{}) != nil
+}
+
+// sampledFormatter skips the entries dropped by the sampling.
+type sampledFormatter struct {
+	logrus.Formatter
+}
+
+func (f sampledFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if sampledOut(entry) {
+		return nil, nil
+	}
+	return f.Formatter.Format(entry)
+}
@@ -0,0 +1,174 @@
+package log
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sink is an interface that receives the formatted entries of a Logger.
+// Sinks must be safe for concurrent use.
+type Sink interface {
+	io.Writer
+	// Flush writes the buffered entries, if any.
+	Flush() error
+	// Close flushes and releases the sink.
+	Close() error
+}
+
+// Route sends the entries of some levels to a Sink, see Options.Sinks.
+type Route struct {
+	Sink Sink
+	// Levels are the levels routed to the Sink. Empty routes every level.
+	Levels []logrus.Level
+	// Formatter formats the entries for the Sink. Defaults to the formatter of the Logger.
+	Formatter logrus.Formatter
+}
+
+// AtLeast returns the levels at least as severe as level, e.g. AtLeast(logrus.ErrorLevel)
+// returns the error, fatal and panic levels.
+func AtLeast(level logrus.Level) []logrus.Level {
+	var levels []logrus.Level
+	for _, l := range logrus.AllLevels {
+		if l <= level {
+			levels = append(levels, l)
+		}
+	}
+	return levels
+}
+
+// writerSink is a Sink writing to an io.Writer it does not own.
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink returns a Sink writing to w, such as os.Stdout. Close does not close w.
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+// Write serializes the writes, as the hooks of logrus run concurrently.
+func (s *writerSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+func (*writerSink) Flush() error {
+	return nil
+}
+
+func (*writerSink) Close() error {
+	return nil
+}
+
+// multiSink writes every entry to several sinks.
+type multiSink struct {
+	sinks []Sink
+}
+
+// MultiSink returns a Sink writing every entry to all the sinks. An entry is written to every sink
+// even if some fail, and the errors are joined.
+func MultiSink(sinks ...Sink) Sink {
+	return &multiSink{sinks: slices.Clone(sinks)}
+}
+
+func (m *multiSink) Write(p []byte) (int, error) {
+	var errs []error
+	for _, sink := range m.sinks {
+		if _, err := sink.Write(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(p), errors.Join(errs...)
+}
+
+func (m *multiSink) Flush() error {
+	var errs []error
+	for _, sink := range m.sinks {
+		errs = append(errs, sink.Flush())
+	}
+	return errors.Join(errs...)
+}
+
+func (m *multiSink) Close() error {
+	var errs []error
+	for _, sink := range m.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// sinkHook writes the entries to the sinks they are routed to.
+// Hooks run before the entry is written to the output of the logger.
+type sinkHook struct {
+	routes []Route
+}
+
+func newSinkHook(routes []Route, formatter logrus.Formatter) *sinkHook {
+	h := &sinkHook{routes: slices.Clone(routes)}
+	for i := range h.routes {
+		if h.routes[i].Formatter == nil {
+			h.routes[i].Formatter = formatter
+		}
+	}
+	return h
+}
+
+func (h *sinkHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *sinkHook) Fire(entry *logrus.Entry) error {
+	if sampledOut(entry) {
+		return nil
+	}
+	var errs []error
+	for _, route := range h.routes {
+		if len(route.Levels) > 0 && !slices.Contains(route.Levels, entry.Level) {
+			continue
+		}
+		data, err := route.Formatter.Format(entry)
+		if err == nil {
+			_, err = route.Sink.Write(data)
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// sinks returns the distinct sinks of the routes, so that a sink routed several times is closed once.
+func (h *sinkHook) sinks() []Sink {
+	var sinks []Sink
+	for _, route := range h.routes {
+		if !containsSink(sinks, route.Sink) {
+			sinks = append(sinks, route.Sink)
+		}
+	}
+	return sinks
+}
+
+// containsSink compares the sinks whose type is comparable, which other sinks are never equal to.
+func containsSink(sinks []Sink, sink Sink) bool {
+	if !reflect.TypeOf(sink).Comparable() {
+		return false
+	}
+	for _, s := range sinks {
+		if reflect.TypeOf(s).Comparable() && s == sink {
+			return true
+		}
+	}
+	return false
+}
+
+// discardFormatter skips formatting the entries written to the discarded output of a logger with sinks.
+type discardFormatter struct{}
+
+func (discardFormatter) Format(*logrus.Entry) ([]byte, error) {
+	return nil, nil
+}
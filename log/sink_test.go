@@ -0,0 +1,191 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// bufferSink is a Sink recording the entries, which can block the writes.
+type bufferSink struct {
+	mu      sync.Mutex
+	buffer  bytes.Buffer
+	blocked chan struct{}
+	flushes int
+	closes  int
+}
+
+func (s *bufferSink) Write(p []byte) (int, error) {
+	if s.blocked != nil {
+		<-s.blocked
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buffer.Write(p)
+}
+
+func (s *bufferSink) Flush() error {
+	s.mu.Lock()
+	s.flushes++
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *bufferSink) Close() error {
+	s.mu.Lock()
+	s.closes++
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *bufferSink) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buffer.String()
+}
+
+func TestLogger_Sinks(t *testing.T) {
+	all, errorsOnly, copied := &bufferSink{}, &bufferSink{}, &bufferSink{}
+	logger := NewLogger(&Options{
+		Sinks: []Route{
+			{Sink: MultiSink(all, copied)},
+			{Sink: errorsOnly, Levels: AtLeast(logrus.ErrorLevel), Formatter: &logrus.TextFormatter{DisableTimestamp: true}},
+			{Sink: all, Levels: []logrus.Level{logrus.WarnLevel}},
+		},
+	})
+	logger.WithTraceId("trace-1").Info("hello")
+	logger.Warn("careful")
+	logger.WithError(io.EOF).Error("failed")
+
+	assert.Equal(t, 3, strings.Count(copied.String(), "\n"))
+	assert.Contains(t, copied.String(), `"X-Trace-Id":"trace-1"`)
+	// The warning is routed twice to all
+	assert.Equal(t, 2, strings.Count(all.String(), "careful"))
+	assert.Equal(t, "level=error msg=failed error=EOF\n", errorsOnly.String())
+
+	assert.NoError(t, logger.Flush())
+	assert.NoError(t, logger.Close())
+	assert.Equal(t, 1, copied.closes)
+	assert.Equal(t, 1, errorsOnly.flushes)
+	assert.Equal(t, []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel}, AtLeast(logrus.WarnLevel))
+}
+
+func TestAsyncSink(t *testing.T) {
+	for name, test := range map[string]struct {
+		policy   DropPolicy
+		expected string
+		dropped  int64
+	}{
+		"drop newest": {policy: DropNewest, expected: "0123", dropped: 2},
+		"drop oldest": {policy: DropOldest, expected: "0345", dropped: 2},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sink := &bufferSink{blocked: make(chan struct{})}
+			async := NewAsyncSink(sink, &AsyncOptions{BufferSize: 3, DropPolicy: test.policy})
+			_, _ = async.Write([]byte("0"))
+			// Wait for the writing goroutine to block on the first entry
+			time.Sleep(20 * time.Millisecond)
+			for _, p := range []string{"1", "2", "3", "4", "5"} {
+				n, err := async.Write([]byte(p))
+				assert.NoError(t, err)
+				assert.Equal(t, 1, n)
+			}
+			assert.Equal(t, test.dropped, async.Dropped())
+			close(sink.blocked)
+			assert.NoError(t, async.Flush())
+			assert.Equal(t, test.expected, sink.String())
+			assert.Equal(t, 1, sink.flushes)
+		})
+	}
+
+	sink := &bufferSink{}
+	async := NewAsyncSink(sink, nil)
+	buffer := []byte("entry\n")
+	_, _ = async.Write(buffer)
+	// The entry is copied, as the formatters reuse their buffer
+	copy(buffer, "reused")
+	assert.NoError(t, async.Close())
+	assert.Equal(t, "entry\n", sink.String())
+	assert.Equal(t, 1, sink.closes)
+	_, err := async.Write([]byte("late"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+	assert.NoError(t, async.Close())
+}
+
+func TestRotatingFile_Size(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "logs", "app.log")
+	file, err := NewRotatingFile(&RotatingFileOptions{Filename: filename, MaxSize: 10, MaxBackups: 2, Compress: true})
+	assert.NoError(t, err)
+	for _, p := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := file.Write([]byte(p))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, file.Close())
+	_, err = file.Write([]byte("closed\n"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+
+	data, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "fourth\n", string(data))
+
+	// The oldest rotated file was deleted, the others were compressed
+	backups, err := filepath.Glob(filepath.Join(dir, "logs", "app-*.log.gz"))
+	assert.NoError(t, err)
+	assert.Len(t, backups, 2)
+	var contents []string
+	for _, backup := range backups {
+		contents = append(contents, readGzip(t, backup))
+	}
+	assert.ElementsMatch(t, []string{"second\n", "third\n"}, contents)
+}
+
+func TestRotatingFile_Interval(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	file, err := NewRotatingFile(&RotatingFileOptions{Filename: filename, Interval: 50 * time.Millisecond})
+	assert.NoError(t, err)
+	_, err = file.Write([]byte("before\n"))
+	assert.NoError(t, err)
+	time.Sleep(60 * time.Millisecond)
+	_, err = file.Write([]byte("after\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, file.Flush())
+
+	data, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "after\n", string(data))
+	backups, err := filepath.Glob(filepath.Join(dir, "app-*.log"))
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+
+	// Files rotated longer than MaxAge ago are deleted
+	old := filepath.Join(dir, "app-"+time.Now().Add(-48*time.Hour).Format(backupTimeFormat)+".log")
+	assert.NoError(t, os.WriteFile(old, []byte("old\n"), 0644))
+	assert.NoError(t, file.Close())
+	file, err = NewRotatingFile(&RotatingFileOptions{Filename: filename, MaxAge: 24 * time.Hour})
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	assert.NoFileExists(t, old)
+	assert.FileExists(t, backups[0])
+}
+
+func readGzip(t *testing.T, path string) string {
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(gz)
+	assert.NoError(t, err)
+	return string(data)
+}
@@ -4,9 +4,13 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"github.com/trumanwong/go-tools/log"
+	"net/http"
 	"time"
 )
 
+// sensitiveHeaders are redacted from the logged request headers, whatever the redaction of the logger.
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
 type logger struct {
 	Logger *log.Logger
 }
@@ -20,7 +24,7 @@ func (l *logger) Handle() gin.HandlerFunc {
 		startTime := time.Now()
 		ctx.Next()
 		endTime := time.Now()
-		l.Logger.WithFields(logrus.Fields{
+		l.Logger.WithContext(ctx).WithFields(logrus.Fields{
 			// 请求方式
 			"method": ctx.Request.Method,
 			// 请求路由
@@ -28,12 +32,23 @@ func (l *logger) Handle() gin.HandlerFunc {
 			// 请求ip
 			"client_ip": ctx.ClientIP(),
 			// 请求头
-			"header": ctx.Request.Header,
+			"header": redactHeader(ctx.Request.Header),
 			// 返回code
 			"status_code": ctx.Writer.Status(),
 			// 执行时间
 			"execute_time": endTime.Sub(startTime) / time.Millisecond,
 			"created_at":   time.Now(),
-		})
+		}).Info("request")
+	}
+}
+
+// redactHeader returns a copy of the header with the values of the sensitive headers redacted.
+func redactHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range sensitiveHeaders {
+		if values := redacted.Values(name); len(values) > 0 {
+			redacted[http.CanonicalHeaderKey(name)] = []string{log.Redacted}
+		}
 	}
+	return redacted
 }
@@ -0,0 +1,97 @@
+package middlewares
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trumanwong/go-tools/cache"
+	"github.com/trumanwong/go-tools/helper"
+)
+
+// RateLimitKeyFunc is a function that returns the key a request is limited by.
+type RateLimitKeyFunc func(ctx *gin.Context) string
+
+// RateLimitByIP limits requests per client IP.
+func RateLimitByIP(ctx *gin.Context) string {
+	return "ip:" + ctx.ClientIP()
+}
+
+// RateLimitByRoute limits requests per route, shared by all clients.
+// Requests that match no route are limited per path.
+func RateLimitByRoute(ctx *gin.Context) string {
+	route := ctx.FullPath()
+	if route == "" {
+		route = ctx.Request.URL.Path
+	}
+	return "route:" + ctx.Request.Method + ":" + route
+}
+
+// RateLimitByUser limits requests per user, reading the user ID that an earlier
+// middleware stored in the gin.Context under key. It falls back to the client IP.
+func RateLimitByUser(key string) RateLimitKeyFunc {
+	return func(ctx *gin.Context) string {
+		if userId, ok := ctx.Get(key); ok && userId != nil {
+			return fmt.Sprintf("user:%v", userId)
+		}
+		return RateLimitByIP(ctx)
+	}
+}
+
+// rateLimit is a struct that represents the rate limit configuration.
+// It contains the cache holding the counters, the algorithm, the number of requests allowed per period,
+// the period, and the function that returns the key a request is limited by.
+type rateLimit struct {
+	cache     *cache.Cache
+	algorithm cache.RateLimitAlgorithm
+	limit     int64
+	period    time.Duration
+	keyFunc   RateLimitKeyFunc
+}
+
+// NewRateLimit is a function that creates a new rate limit middleware.
+// It takes the cache holding the counters, the algorithm, the number of requests allowed per period,
+// the period, and the function that returns the key a request is limited by, which defaults to RateLimitByIP.
+func NewRateLimit(c *cache.Cache, algorithm cache.RateLimitAlgorithm, limit int64, period time.Duration, keyFunc RateLimitKeyFunc) Middleware {
+	if keyFunc == nil {
+		keyFunc = RateLimitByIP
+	}
+	return &rateLimit{cache: c, algorithm: algorithm, limit: limit, period: period, keyFunc: keyFunc}
+}
+
+// Handle is a method of rateLimit that returns a gin.HandlerFunc for limiting requests.
+// The returned gin.HandlerFunc sets the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers.
+// If the limit is exceeded, it sets the Retry-After header and aborts the request with the HTTP status code 429 (Too Many Requests).
+// If Redis is unavailable, requests are let through.
+func (r *rateLimit) Handle() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		res, err := r.cache.RateLimit(ctx, &cache.RateLimitRequest{
+			Key:       "ratelimit:" + r.keyFunc(ctx),
+			Algorithm: r.algorithm,
+			Limit:     r.limit,
+			Period:    r.period,
+		})
+		if err != nil {
+			ctx.Next()
+			return
+		}
+		ctx.Header("RateLimit-Limit", strconv.FormatInt(res.Limit, 10))
+		ctx.Header("RateLimit-Remaining", strconv.FormatInt(res.Remaining, 10))
+		ctx.Header("RateLimit-Reset", formatSeconds(res.ResetAfter))
+		if !res.Allowed {
+			ctx.Header("Retry-After", formatSeconds(res.RetryAfter))
+			helper.Response(ctx, nil, http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// formatSeconds rounds a duration up to whole seconds, as the rate limit headers require.
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
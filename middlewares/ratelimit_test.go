@@ -0,0 +1,85 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/trumanwong/go-tools/cache"
+)
+
+func newTestCache(t *testing.T) *cache.Cache {
+	c, err := cache.NewCache(&redis.Options{
+		Addr:     os.Getenv("REDIS_ADDR"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+		DB:       0,
+	}, "test:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRateLimit_Handle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userId := uuid.New().String()
+	engine := gin.New()
+	engine.Use(func(ctx *gin.Context) {
+		ctx.Set("user_id", userId)
+	})
+	engine.Use(NewRateLimit(newTestCache(t), cache.FixedWindow, 2, time.Minute, RateLimitByUser("user_id")).Handle())
+	engine.GET("/orders/:id", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "ok")
+	})
+
+	for i := 1; i <= 3; i++ {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders/1", nil))
+		assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, strconv.Itoa(max(2-i, 0)), w.Header().Get("RateLimit-Remaining"))
+		reset, err := strconv.Atoi(w.Header().Get("RateLimit-Reset"))
+		assert.NoError(t, err)
+		assert.True(t, reset > 0 && reset <= 60, reset)
+		if i <= 2 {
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Empty(t, w.Header().Get("Retry-After"))
+			continue
+		}
+		// The handler is not called once the limit is exceeded
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.JSONEq(t, `{"message":"Too Many Requests","data":null}`, w.Body.String())
+		retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+		assert.NoError(t, err)
+		assert.True(t, retryAfter > 0 && retryAfter <= 60, retryAfter)
+	}
+}
+
+func TestRateLimit_KeyFunc(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var keys []string
+	engine := gin.New()
+	engine.Use(func(ctx *gin.Context) {
+		keys = append(keys, RateLimitByRoute(ctx), RateLimitByUser("user_id")(ctx))
+		ctx.Set("user_id", 42)
+		keys = append(keys, RateLimitByUser("user_id")(ctx))
+	})
+	engine.GET("/orders/:id", func(ctx *gin.Context) {})
+
+	for _, path := range []string{"/orders/1", "/missing"} {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.RemoteAddr = "192.0.2.1:1234"
+		engine.ServeHTTP(httptest.NewRecorder(), request)
+	}
+	assert.Equal(t, []string{
+		"route:GET:/orders/:id", "ip:192.0.2.1", "user:42",
+		// Requests that match no route are limited per path
+		"route:GET:/missing", "ip:192.0.2.1", "user:42",
+	}, keys)
+}
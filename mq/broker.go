@@ -0,0 +1,108 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errSettled is returned when a message is acknowledged or rejected a second time.
+var errSettled = errors.New("message already acknowledged or rejected")
+
+// Message is a broker-neutral message.
+type Message struct {
+	// ID is set by Publish if it is empty.
+	ID      string
+	Headers map[string]any
+	Body    []byte
+	// Timestamp is set by Publish if it is zero.
+	Timestamp time.Time
+	// Topic is the topic the message was received from. It is set by the Subscriber.
+	Topic string
+	// Attempt is how many times the message was delivered, starting at 1. It is set by the Subscriber.
+	Attempt int
+
+	settle func(ack, requeue bool) error
+	mu     sync.Mutex
+	// settled is true once the message was acknowledged or rejected.
+	settled bool
+}
+
+// Ack acknowledges a received message, so that it is not delivered again.
+func (m *Message) Ack() error {
+	return m.finish(true, false)
+}
+
+// Nack rejects a received message. If requeue is true the message is delivered again,
+// otherwise it is dropped, or dead-lettered if the broker supports it.
+func (m *Message) Nack(requeue bool) error {
+	return m.finish(false, requeue)
+}
+
+func (m *Message) finish(ack, requeue bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.settled {
+		return errSettled
+	}
+	m.settled = true
+	if m.settle == nil {
+		return nil
+	}
+	return m.settle(ack, requeue)
+}
+
+func (m *Message) isSettled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.settled
+}
+
+// MessageHandler processes a message received by a Subscriber.
+// The message is acknowledged if the handler returns nil and requeued if it returns an error,
+// unless the handler already called Ack or Nack.
+type MessageHandler func(ctx context.Context, msg *Message) error
+
+// Publisher publishes messages to a topic, whose meaning depends on the broker:
+// a routing key for RabbitMQ, a stream for Redis Streams.
+type Publisher interface {
+	// Publish returns once the broker took responsibility for the message.
+	Publish(ctx context.Context, topic string, msg *Message) error
+	Close() error
+}
+
+// Subscriber receives messages from a topic, whose meaning depends on the broker:
+// a queue for RabbitMQ, a stream for Redis Streams.
+type Subscriber interface {
+	// Subscribe passes the messages of the topic to the handler until ctx is done,
+	// and returns ctx.Err() or the error that stopped the subscription.
+	Subscribe(ctx context.Context, topic string, handler MessageHandler) error
+	Close() error
+}
+
+// handleMessage runs the handler, then acknowledges or requeues the message unless the handler did.
+// A panic of the handler requeues the message.
+// The trace ID of the headers is stored in the context of the handler, see Router.
+func handleMessage(ctx context.Context, handler MessageHandler, msg *Message) error {
+	traceId, _ := msg.Headers[defaultTraceKey].(string)
+	err := recoverHandler(withTraceId(ctx, defaultTraceKey, traceId), handler, msg)
+	if msg.isSettled() {
+		return nil
+	}
+	if err != nil {
+		return msg.Nack(true)
+	}
+	return msg.Ack()
+}
+
+// recoverHandler runs the handler, turning a panic into an error.
+func recoverHandler(ctx context.Context, handler MessageHandler, msg *Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, msg)
+}
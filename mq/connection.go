@@ -0,0 +1,179 @@
+package mq
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	defaultHeartbeat = 10 * time.Second
+	defaultLocale    = "en_US"
+)
+
+// ConnectionOptions is a struct that represents the options of a Connection.
+// It contains the address of the server, the number of connections, and the name of the connections.
+type ConnectionOptions struct {
+	Addr string
+	// PoolSize is the number of connections, defaults to 1.
+	// The channels of the RabbitMQ instances are spread across them.
+	PoolSize int
+	// Name is shown as the name of the connections in the management UI.
+	Name string
+}
+
+// Connection shares a pool of connections between RabbitMQ instances, see Options.Connection.
+// Every RabbitMQ opens its own channel on one of the connections, so that a channel error
+// only re-initializes the channel of that RabbitMQ. When a connection is lost, it is re-established,
+// and the RabbitMQ instances using it open a new channel and declare their queue and topology again.
+type Connection struct {
+	addr      string
+	config    amqp.Config
+	logger    *log.Logger
+	slots     []*connectionSlot
+	next      atomic.Uint64
+	done      chan bool
+	closeOnce sync.Once
+}
+
+// connectionSlot is a connection of the pool, re-established when it is lost.
+type connectionSlot struct {
+	mu   sync.Mutex
+	conn *amqp.Connection
+	// ready is closed once conn is connected, and replaced when it is lost.
+	ready chan struct{}
+	// lost is closed once the loss of conn has been handled.
+	lost chan struct{}
+}
+
+// NewConnection creates a Connection, and automatically attempts to connect to the server.
+func NewConnection(options *ConnectionOptions) *Connection {
+	size := options.PoolSize
+	if size <= 0 {
+		size = 1
+	}
+	c := &Connection{
+		addr: options.Addr,
+		config: amqp.Config{
+			Heartbeat:  defaultHeartbeat,
+			Locale:     defaultLocale,
+			Properties: amqp.NewConnectionProperties(),
+		},
+		logger: log.New(os.Stdout, "", log.LstdFlags),
+		slots:  make([]*connectionSlot, size),
+		done:   make(chan bool),
+	}
+	if options.Name != "" {
+		c.config.Properties.SetClientConnectionName(options.Name)
+	}
+	for i := range c.slots {
+		c.slots[i] = &connectionSlot{ready: make(chan struct{})}
+		go c.handleReconnect(c.slots[i])
+	}
+	return c
+}
+
+// handleReconnect keeps the connection of a slot established until the Connection is closed.
+func (c *Connection) handleReconnect(slot *connectionSlot) {
+	for {
+		conn, err := amqp.DialConfig(c.addr, c.config)
+		if err != nil {
+			c.logger.Println("Failed to connect. Retrying..., err:", err)
+			select {
+			case <-c.done:
+				return
+			case <-time.After(reconnectDelay):
+			}
+			continue
+		}
+		notifyClose := conn.NotifyClose(make(chan *amqp.Error, 1))
+		slot.mu.Lock()
+		slot.conn = conn
+		slot.lost = make(chan struct{})
+		close(slot.ready)
+		slot.mu.Unlock()
+
+		select {
+		case <-c.done:
+			_ = conn.Close()
+			return
+		case err := <-notifyClose:
+			c.logger.Println("Connection closed. Reconnecting..., err:", err)
+		}
+		slot.mu.Lock()
+		slot.conn = nil
+		slot.ready = make(chan struct{})
+		close(slot.lost)
+		slot.mu.Unlock()
+	}
+}
+
+// acquire assigns a connection of the pool to a RabbitMQ, in turn.
+func (c *Connection) acquire() *connectionSlot {
+	return c.slots[(c.next.Add(1)-1)%uint64(len(c.slots))]
+}
+
+// wait returns the connection of the slot once it is established, and a chan closed once it is lost,
+// or errShutdown if done or the Connection is closed first.
+// The RabbitMQ instances wait on the chan rather than registering their own NotifyClose,
+// since the connection blocks on every close listener while shutting down.
+func (c *Connection) wait(slot *connectionSlot, done <-chan bool) (*amqp.Connection, <-chan struct{}, error) {
+	for {
+		slot.mu.Lock()
+		conn, wait := slot.conn, slot.ready
+		if conn != nil {
+			if !conn.IsClosed() {
+				lost := slot.lost
+				slot.mu.Unlock()
+				return conn, lost, nil
+			}
+			wait = slot.lost
+		}
+		slot.mu.Unlock()
+		select {
+		case <-wait:
+		case <-done:
+			return nil, nil, errShutdown
+		case <-c.done:
+			return nil, nil, errShutdown
+		}
+	}
+}
+
+// Connected returns the number of connections of the pool that are established.
+func (c *Connection) Connected() int {
+	n := 0
+	for _, slot := range c.slots {
+		slot.mu.Lock()
+		if slot.conn != nil && !slot.conn.IsClosed() {
+			n++
+		}
+		slot.mu.Unlock()
+	}
+	return n
+}
+
+// Close closes the connections. The RabbitMQ instances using them stop reconnecting,
+// and should be closed first so that their channels are closed cleanly.
+func (c *Connection) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	var err error
+	for _, slot := range c.slots {
+		slot.mu.Lock()
+		if slot.conn != nil {
+			// The reconnect loop may have closed it already
+			if closeErr := slot.conn.Close(); closeErr != nil && !errors.Is(closeErr, amqp.ErrClosed) && err == nil {
+				err = closeErr
+			}
+		}
+		slot.mu.Unlock()
+	}
+	return err
+}
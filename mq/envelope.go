@@ -0,0 +1,274 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/trumanwong/go-tools/cache"
+)
+
+const (
+	// defaultTraceKey is the header and context key of the trace ID,
+	// the same as middlewares.NewTracing and log.Logger.WithContext.
+	defaultTraceKey = "X-Trace-Id"
+
+	typeHeader        = "x-message-type"
+	versionHeader     = "x-message-version"
+	producerHeader    = "x-producer"
+	contentTypeHeader = "content-type"
+)
+
+// ErrUnknownType is returned when no handler is registered for the type of a message.
+var ErrUnknownType = errors.New("unknown message type")
+
+// Codec is an interface that converts payloads to and from the body of a message.
+type Codec interface {
+	// ContentType identifies the codec of a message, so that consumers can decode it.
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec is a Codec that uses encoding/json.
+type JSONCodec struct {
+	cache.JSONCodec
+}
+
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+// ProtobufCodec is a Codec for protobuf messages, see cache.ProtobufCodec.
+type ProtobufCodec struct {
+	cache.ProtobufCodec
+}
+
+func (ProtobufCodec) ContentType() string {
+	return "application/x-protobuf"
+}
+
+// Envelope is the metadata of a message published by a Router.
+type Envelope struct {
+	ID   string
+	Type string
+	// Version is the version of the schema of the payload, so that handlers can read older messages.
+	Version   int
+	Timestamp time.Time
+	// Producer is the name of the service that published the message.
+	Producer    string
+	ContentType string
+	TraceId     string
+}
+
+// RouterOptions is a struct that represents the options of a Router.
+// It contains the name of the producer, the codec of the published messages,
+// additional codecs to decode received messages, and the key of the trace ID.
+type RouterOptions struct {
+	Producer string
+	// Codec encodes the published payloads. Defaults to JSONCodec.
+	Codec Codec
+	// Codecs decode the received messages by content type, in addition to JSONCodec and ProtobufCodec.
+	Codecs []Codec
+	// TraceKey is the header and context key of the trace ID. Defaults to "X-Trace-Id".
+	TraceKey *string
+}
+
+// Router wraps payloads in envelopes when publishing, and passes received messages
+// to the typed handler registered for their type, see Register.
+// The trace ID of the context is propagated through the headers to the context of the handler,
+// where log.Logger.WithContext finds it.
+type Router struct {
+	producer string
+	codec    Codec
+	codecs   map[string]Codec
+	traceKey string
+	handlers map[string]func(ctx context.Context, envelope *Envelope, body []byte) error
+}
+
+// NewRouter creates a Router without handlers.
+func NewRouter(options *RouterOptions) *Router {
+	if options == nil {
+		options = &RouterOptions{}
+	}
+	r := &Router{
+		producer: options.Producer,
+		codec:    options.Codec,
+		codecs:   make(map[string]Codec),
+		traceKey: defaultTraceKey,
+		handlers: make(map[string]func(ctx context.Context, envelope *Envelope, body []byte) error),
+	}
+	if r.codec == nil {
+		r.codec = JSONCodec{}
+	}
+	if options.TraceKey != nil {
+		r.traceKey = *options.TraceKey
+	}
+	for _, codec := range append([]Codec{JSONCodec{}, ProtobufCodec{}, r.codec}, options.Codecs...) {
+		r.codecs[codec.ContentType()] = codec
+	}
+	return r
+}
+
+// Register registers the handler of a message type. The payload is decoded into a T,
+// which must be a pointer to a message for ProtobufCodec.
+// The handler receives the envelope, so that it can read the payloads of older versions.
+func Register[T any](r *Router, msgType string, handler func(ctx context.Context, envelope *Envelope, payload T) error) {
+	r.handlers[msgType] = func(ctx context.Context, envelope *Envelope, body []byte) error {
+		codec, ok := r.codecs[envelope.ContentType]
+		if !ok {
+			return fmt.Errorf("unknown content type %q of message %s", envelope.ContentType, envelope.ID)
+		}
+		var payload T
+		if err := codec.Unmarshal(body, &payload); err != nil {
+			return err
+		}
+		return handler(ctx, envelope, payload)
+	}
+}
+
+// envelope creates the envelope of a message published with ctx.
+func (r *Router) envelope(ctx context.Context, msgType string, version int) *Envelope {
+	envelope := &Envelope{
+		ID:          uuid.New().String(),
+		Type:        msgType,
+		Version:     version,
+		Timestamp:   time.Now(),
+		Producer:    r.producer,
+		ContentType: r.codec.ContentType(),
+	}
+	envelope.TraceId, _ = ctx.Value(r.traceKey).(string)
+	return envelope
+}
+
+// Message encodes the payload in a Message for a Publisher, with the envelope in its headers.
+func (r *Router) Message(ctx context.Context, msgType string, version int, payload any) (*Message, error) {
+	body, err := r.codec.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	envelope := r.envelope(ctx, msgType, version)
+	headers := map[string]any{
+		typeHeader:        envelope.Type,
+		versionHeader:     envelope.Version,
+		producerHeader:    envelope.Producer,
+		contentTypeHeader: envelope.ContentType,
+	}
+	if envelope.TraceId != "" {
+		headers[r.traceKey] = envelope.TraceId
+	}
+	return &Message{ID: envelope.ID, Headers: headers, Body: body, Timestamp: envelope.Timestamp}, nil
+}
+
+// Publishing encodes the payload in a message for RabbitMQ, with the envelope in its properties
+// and the version and trace ID in its headers.
+func (r *Router) Publishing(ctx context.Context, msgType string, version int, payload any) (amqp.Publishing, error) {
+	body, err := r.codec.Marshal(payload)
+	if err != nil {
+		return amqp.Publishing{}, err
+	}
+	envelope := r.envelope(ctx, msgType, version)
+	headers := amqp.Table{versionHeader: int64(envelope.Version)}
+	if envelope.TraceId != "" {
+		headers[r.traceKey] = envelope.TraceId
+	}
+	return amqp.Publishing{
+		Headers:      headers,
+		ContentType:  envelope.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    envelope.ID,
+		Timestamp:    envelope.Timestamp,
+		Type:         envelope.Type,
+		AppId:        envelope.Producer,
+		Body:         body,
+	}, nil
+}
+
+// Handle passes a Message received by a Subscriber to the handler registered for its type.
+// It is a MessageHandler.
+func (r *Router) Handle(ctx context.Context, msg *Message) error {
+	envelope := &Envelope{
+		ID:          msg.ID,
+		Timestamp:   msg.Timestamp,
+		ContentType: JSONCodec{}.ContentType(),
+	}
+	envelope.Type, _ = msg.Headers[typeHeader].(string)
+	envelope.Version = headerInt(msg.Headers[versionHeader])
+	envelope.Producer, _ = msg.Headers[producerHeader].(string)
+	if contentType, ok := msg.Headers[contentTypeHeader].(string); ok {
+		envelope.ContentType = contentType
+	}
+	envelope.TraceId, _ = msg.Headers[r.traceKey].(string)
+	return r.dispatch(ctx, envelope, msg.Body)
+}
+
+// HandleDelivery passes a RabbitMQ delivery to the handler registered for its type.
+// It is a Handler for Options.Handler.
+func (r *Router) HandleDelivery(ctx context.Context, d amqp.Delivery) error {
+	envelope := &Envelope{
+		ID:          d.MessageId,
+		Type:        d.Type,
+		Version:     headerInt(d.Headers[versionHeader]),
+		Timestamp:   d.Timestamp,
+		Producer:    d.AppId,
+		ContentType: d.ContentType,
+	}
+	envelope.TraceId, _ = d.Headers[r.traceKey].(string)
+	return r.dispatch(ctx, envelope, d.Body)
+}
+
+func (r *Router) dispatch(ctx context.Context, envelope *Envelope, body []byte) error {
+	handler, ok := r.handlers[envelope.Type]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownType, envelope.Type)
+	}
+	return handler(withTraceId(ctx, r.traceKey, envelope.TraceId), envelope, body)
+}
+
+// withTraceId stores the trace ID in the context under the key log.Logger.WithContext reads,
+// which is a string like the keys of gin.Context.
+func withTraceId(ctx context.Context, key, traceId string) context.Context {
+	if traceId == "" {
+		return ctx
+	}
+	//nolint:staticcheck // log.Logger.WithContext looks the trace ID up by its string key
+	return context.WithValue(ctx, key, traceId)
+}
+
+// traceHeaders returns a copy of the headers with the trace ID of the context, if the headers have none.
+func traceHeaders(ctx context.Context, key string, headers map[string]any) map[string]any {
+	headers = maps.Clone(headers)
+	if _, ok := headers[key]; ok {
+		return headers
+	}
+	if traceId, ok := ctx.Value(key).(string); ok && traceId != "" {
+		if headers == nil {
+			headers = make(map[string]any, 1)
+		}
+		headers[key] = traceId
+	}
+	return headers
+}
+
+// headerInt reads an integer header, which is a float64 after a round trip through JSON.
+func headerInt(value any) int {
+	switch value := value.(type) {
+	case int:
+		return value
+	case int32:
+		return int(value)
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	case string:
+		i, _ := strconv.Atoi(value)
+		return i
+	}
+	return 0
+}
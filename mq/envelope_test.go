@@ -0,0 +1,89 @@
+package mq
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/trumanwong/go-tools/log"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type orderCreated struct {
+	OrderId int    `json:"order_id"`
+	Status  string `json:"status"`
+}
+
+func TestRouter_Handle(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.NewLogger(&log.Options{Output: &buf, Formatter: &logrus.JSONFormatter{}})
+	broker := NewMemoryBroker()
+	router := NewRouter(&RouterOptions{Producer: "orders"})
+	var received []*Envelope
+	Register(router, "order.created", func(ctx context.Context, envelope *Envelope, payload orderCreated) error {
+		received = append(received, envelope)
+		assert.Equal(t, orderCreated{OrderId: 1, Status: "paid"}, payload)
+		logger.WithContext(ctx).Info("order created")
+		return nil
+	})
+
+	ctx := context.WithValue(context.Background(), defaultTraceKey, "trace-1")
+	msg, err := router.Message(ctx, "order.created", 2, orderCreated{OrderId: 1, Status: "paid"})
+	assert.NoError(t, err)
+	assert.NoError(t, broker.Publish(ctx, "orders", msg))
+	msg, err = router.Message(context.Background(), "order.deleted", 1, orderCreated{OrderId: 1})
+	assert.NoError(t, err)
+	assert.NoError(t, broker.Publish(ctx, "orders", msg))
+
+	assert.NoError(t, broker.Drain(context.Background(), "orders", func(ctx context.Context, msg *Message) error {
+		err := router.Handle(ctx, msg)
+		if errors.Is(err, ErrUnknownType) {
+			return msg.Nack(false)
+		}
+		return err
+	}))
+	assert.Len(t, received, 1)
+	assert.Equal(t, "order.created", received[0].Type)
+	assert.Equal(t, 2, received[0].Version)
+	assert.Equal(t, "orders", received[0].Producer)
+	assert.Equal(t, "application/json", received[0].ContentType)
+	assert.Equal(t, "trace-1", received[0].TraceId)
+	assert.Contains(t, buf.String(), `"X-Trace-Id":"trace-1"`)
+	// The trace ID of the publishing context is propagated even without a Router
+	assert.Len(t, broker.DeadLetters("orders"), 1)
+	assert.Equal(t, "trace-1", broker.DeadLetters("orders")[0].Headers[defaultTraceKey])
+}
+
+func TestRouter_HandleDelivery(t *testing.T) {
+	traceKey := "Trace"
+	router := NewRouter(&RouterOptions{Producer: "orders", Codec: ProtobufCodec{}, TraceKey: &traceKey})
+	var traceId any
+	Register(router, "order.paid", func(ctx context.Context, envelope *Envelope, payload *wrapperspb.Int64Value) error {
+		traceId = ctx.Value(traceKey)
+		assert.Equal(t, int64(42), payload.GetValue())
+		return nil
+	})
+
+	ctx := context.WithValue(context.Background(), traceKey, "trace-2")
+	publishing, err := router.Publishing(ctx, "order.paid", 1, wrapperspb.Int64(42))
+	assert.NoError(t, err)
+	assert.Equal(t, "application/x-protobuf", publishing.ContentType)
+	assert.Equal(t, "order.paid", publishing.Type)
+	assert.Equal(t, "orders", publishing.AppId)
+
+	assert.NoError(t, router.HandleDelivery(context.Background(), amqp.Delivery{
+		Headers:     publishing.Headers,
+		ContentType: publishing.ContentType,
+		MessageId:   publishing.MessageId,
+		Timestamp:   publishing.Timestamp,
+		Type:        publishing.Type,
+		AppId:       publishing.AppId,
+		Body:        publishing.Body,
+	}))
+	assert.Equal(t, "trace-2", traceId)
+	assert.ErrorIs(t, router.HandleDelivery(context.Background(), amqp.Delivery{Type: "unknown"}), ErrUnknownType)
+}
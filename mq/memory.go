@@ -0,0 +1,179 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var errBrokerClosed = errors.New("broker is closed")
+
+// memoryMessage is a message queued by a MemoryBroker.
+type memoryMessage struct {
+	id        string
+	headers   map[string]any
+	body      []byte
+	timestamp time.Time
+	attempt   int
+}
+
+// MemoryBroker is an in-memory Publisher and Subscriber for tests.
+// Delivery is deterministic: the messages of a topic are delivered one at a time in the order
+// they were published, IDs are sequential numbers, and a requeued message is delivered again
+// before the next ones. Messages rejected without requeue are kept, see DeadLetters.
+type MemoryBroker struct {
+	mu          sync.Mutex
+	topics      map[string][]*memoryMessage
+	deadLetters map[string][]*Message
+	nextID      int
+	// changed is closed and replaced every time a message is queued.
+	changed chan struct{}
+	closed  bool
+}
+
+// NewMemoryBroker creates an empty MemoryBroker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		topics:      make(map[string][]*memoryMessage),
+		deadLetters: make(map[string][]*Message),
+		changed:     make(chan struct{}),
+	}
+}
+
+// Publish queues a copy of msg on the topic, adding the trace ID of the context to the headers.
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return errBrokerClosed
+	}
+	b.nextID++
+	queued := &memoryMessage{
+		id:        msg.ID,
+		headers:   traceHeaders(ctx, defaultTraceKey, msg.Headers),
+		body:      append([]byte(nil), msg.Body...),
+		timestamp: msg.Timestamp,
+	}
+	if queued.id == "" {
+		queued.id = strconv.Itoa(b.nextID)
+	}
+	if queued.timestamp.IsZero() {
+		queued.timestamp = time.Now()
+	}
+	b.topics[topic] = append(b.topics[topic], queued)
+	b.notify()
+	return nil
+}
+
+// Subscribe passes the messages of the topic to the handler until ctx is done or the broker is closed.
+func (b *MemoryBroker) Subscribe(ctx context.Context, topic string, handler MessageHandler) error {
+	return b.deliver(ctx, topic, handler, true)
+}
+
+// Drain passes the messages of the topic to the handler until there is none left,
+// including the requeued ones, and returns without waiting for new messages.
+func (b *MemoryBroker) Drain(ctx context.Context, topic string, handler MessageHandler) error {
+	return b.deliver(ctx, topic, handler, false)
+}
+
+func (b *MemoryBroker) deliver(ctx context.Context, topic string, handler MessageHandler, wait bool) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		msg, changed, err := b.next(topic)
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			if !wait {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-changed:
+			}
+			continue
+		}
+		if err := handleMessage(ctx, handler, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// next dequeues the next message of the topic, or returns a chan closed when a message is queued.
+func (b *MemoryBroker) next(topic string) (*Message, <-chan struct{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, nil, errBrokerClosed
+	}
+	queue := b.topics[topic]
+	if len(queue) == 0 {
+		return nil, b.changed, nil
+	}
+	queued := queue[0]
+	b.topics[topic] = queue[1:]
+	queued.attempt++
+	msg := &Message{
+		ID:        queued.id,
+		Headers:   maps.Clone(queued.headers),
+		Body:      queued.body,
+		Timestamp: queued.timestamp,
+		Topic:     topic,
+		Attempt:   queued.attempt,
+	}
+	msg.settle = func(ack, requeue bool) error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		switch {
+		case ack:
+		case requeue:
+			b.topics[topic] = append([]*memoryMessage{queued}, b.topics[topic]...)
+			b.notify()
+		default:
+			b.deadLetters[topic] = append(b.deadLetters[topic], msg)
+		}
+		return nil
+	}
+	return msg, nil, nil
+}
+
+// notify wakes up the subscriptions waiting for a message. It must be called with mu held.
+func (b *MemoryBroker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// Len returns the number of messages queued on the topic, not counting the messages being handled.
+func (b *MemoryBroker) Len(topic string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.topics[topic])
+}
+
+// DeadLetters returns the messages of the topic rejected without requeue.
+func (b *MemoryBroker) DeadLetters(topic string) []*Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*Message(nil), b.deadLetters[topic]...)
+}
+
+// Close stops the subscriptions and rejects new messages.
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return errBrokerClosed
+	}
+	b.closed = true
+	b.notify()
+	return nil
+}
@@ -0,0 +1,80 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ Publisher  = (*MemoryBroker)(nil)
+	_ Subscriber = (*MemoryBroker)(nil)
+	_ Publisher  = (*RabbitMQBroker)(nil)
+	_ Subscriber = (*RabbitMQBroker)(nil)
+	_ Publisher  = (*RedisStreams)(nil)
+	_ Subscriber = (*RedisStreams)(nil)
+)
+
+func TestMemoryBroker_Drain(t *testing.T) {
+	broker := NewMemoryBroker()
+	ctx := context.Background()
+	for _, body := range []string{"a", "b", "c"} {
+		assert.NoError(t, broker.Publish(ctx, "orders", &Message{Body: []byte(body), Headers: map[string]any{"key": body}}))
+	}
+	assert.Equal(t, 3, broker.Len("orders"))
+
+	var received []string
+	err := broker.Drain(ctx, "orders", func(ctx context.Context, msg *Message) error {
+		received = append(received, msg.ID+":"+string(msg.Body))
+		switch {
+		case string(msg.Body) == "b" && msg.Attempt == 1:
+			// Requeued messages are delivered again before the next ones
+			return errors.New("failed")
+		case string(msg.Body) == "c":
+			return msg.Nack(false)
+		}
+		assert.Equal(t, string(msg.Body), msg.Headers["key"])
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1:a", "2:b", "2:b", "3:c"}, received)
+	assert.Equal(t, 0, broker.Len("orders"))
+
+	deadLetters := broker.DeadLetters("orders")
+	assert.Len(t, deadLetters, 1)
+	assert.Equal(t, "3", deadLetters[0].ID)
+	assert.ErrorIs(t, deadLetters[0].Ack(), errSettled)
+}
+
+func TestMemoryBroker_Subscribe(t *testing.T) {
+	broker := NewMemoryBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := make(chan *Message, 1)
+	done := make(chan error)
+	go func() {
+		done <- broker.Subscribe(ctx, "orders", func(ctx context.Context, msg *Message) error {
+			if msg.Attempt == 1 {
+				panic("boom")
+			}
+			received <- msg
+			return nil
+		})
+	}()
+
+	assert.NoError(t, broker.Publish(ctx, "orders", &Message{Body: []byte("a")}))
+	select {
+	case msg := <-received:
+		assert.Equal(t, 2, msg.Attempt)
+		assert.Equal(t, "orders", msg.Topic)
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+
+	assert.NoError(t, broker.Close())
+	assert.ErrorIs(t, <-done, errBrokerClosed)
+	assert.ErrorIs(t, broker.Publish(ctx, "orders", &Message{}), errBrokerClosed)
+}
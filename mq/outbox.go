@@ -0,0 +1,465 @@
+package mq
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxDialect selects the SQL syntax of an Outbox.
+type OutboxDialect int
+
+const (
+	// OutboxMySQL requires MySQL 8.0 or later for FOR UPDATE SKIP LOCKED.
+	OutboxMySQL OutboxDialect = iota
+	// OutboxPostgres requires PostgreSQL 9.5 or later for FOR UPDATE SKIP LOCKED.
+	OutboxPostgres
+)
+
+const (
+	defaultOutboxTable = "outbox"
+
+	defaultRelayBatchSize       = 100
+	defaultRelayInterval        = time.Second
+	defaultRelayLease           = 30 * time.Second
+	defaultRelayRetention       = 7 * 24 * time.Hour
+	defaultRelayCleanupInterval = time.Hour
+)
+
+// ErrOutboxClaimLost is returned when a relay marks a row whose lease expired and that another relay claimed.
+// The message may have been published by both relays.
+var ErrOutboxClaimLost = errors.New("outbox: the claim of the row was lost")
+
+// Execer is implemented by *sql.DB, *sql.Tx and *sql.Conn.
+// Outbox.Add takes the transaction that updates the data, so that the event is written atomically with it.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// OutboxOptions is a struct that represents the options of an Outbox.
+// It contains the database, the name of the table, and the SQL dialect.
+type OutboxOptions struct {
+	DB *sql.DB
+	// Table defaults to "outbox".
+	Table   string
+	Dialect OutboxDialect
+}
+
+// Outbox stores the messages to publish in a table of the database of the application,
+// so that they are written in the same transaction as the data they describe.
+// An OutboxRelay then publishes them.
+type Outbox struct {
+	db      *sql.DB
+	table   string
+	dialect OutboxDialect
+}
+
+// outboxRecord is a row of the outbox claimed by a relay.
+type outboxRecord struct {
+	id          int64
+	topic       string
+	messageId   string
+	headers     map[string]any
+	body        []byte
+	attempts    int
+	createdAt   time.Time
+	lockedUntil time.Time
+}
+
+// NewOutbox creates an Outbox. The table must exist, see Schema.
+func NewOutbox(options *OutboxOptions) *Outbox {
+	table := options.Table
+	if table == "" {
+		table = defaultOutboxTable
+	}
+	return &Outbox{db: options.DB, table: table, dialect: options.Dialect}
+}
+
+// Schema returns the statements creating the table of the outbox and its index.
+func (o *Outbox) Schema() []string {
+	if o.dialect == OutboxPostgres {
+		return []string{
+			`CREATE TABLE IF NOT EXISTS ` + o.table + ` (
+	id BIGSERIAL PRIMARY KEY,
+	topic VARCHAR(255) NOT NULL,
+	message_id VARCHAR(64) NOT NULL,
+	headers TEXT,
+	body BYTEA NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	last_error TEXT,
+	created_at TIMESTAMPTZ NOT NULL,
+	available_at TIMESTAMPTZ NOT NULL,
+	locked_by VARCHAR(255),
+	locked_until TIMESTAMPTZ,
+	sent_at TIMESTAMPTZ
+)`,
+			`CREATE INDEX IF NOT EXISTS idx_` + o.table + `_pending ON ` + o.table + ` (sent_at, available_at)`,
+		}
+	}
+	return []string{
+		`CREATE TABLE IF NOT EXISTS ` + o.table + ` (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	topic VARCHAR(255) NOT NULL,
+	message_id VARCHAR(64) NOT NULL,
+	headers TEXT,
+	body LONGBLOB NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	last_error TEXT,
+	created_at DATETIME(6) NOT NULL,
+	available_at DATETIME(6) NOT NULL,
+	locked_by VARCHAR(255),
+	locked_until DATETIME(6),
+	sent_at DATETIME(6),
+	INDEX idx_` + o.table + `_pending (sent_at, available_at)
+)`,
+	}
+}
+
+// now returns the SQL expression of the current time of the database, in UTC for MySQL like the stored times.
+// Leases are compared with the time of the database rather than of the relays, whose clocks may be skewed.
+func (o *Outbox) now() string {
+	if o.dialect == OutboxPostgres {
+		return "NOW()"
+	}
+	return "UTC_TIMESTAMP(6)"
+}
+
+// after returns the SQL expression of the current time of the database plus a bound number of microseconds.
+func (o *Outbox) after() string {
+	if o.dialect == OutboxPostgres {
+		return "NOW() + ? * INTERVAL '1 microsecond'"
+	}
+	return "UTC_TIMESTAMP(6) + INTERVAL ? MICROSECOND"
+}
+
+// bind replaces the ? placeholders of a query with the placeholders of the dialect.
+func (o *Outbox) bind(query string) string {
+	if o.dialect != OutboxPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// Add writes a message to publish to the topic with tx, which should be the transaction
+// that updates the data the message describes. The message is published once tx is committed.
+// Its ID defaults to a random UUID and is kept when it is published, so that consumers can deduplicate it.
+// The trace ID of the context is added to the headers.
+func (o *Outbox) Add(ctx context.Context, tx Execer, topic string, msg *Message) error {
+	id := msg.ID
+	if id == "" {
+		id = uuid.New().String()
+	}
+	var headers any
+	if h := traceHeaders(ctx, defaultTraceKey, msg.Headers); len(h) > 0 {
+		data, err := json.Marshal(h)
+		if err != nil {
+			return err
+		}
+		headers = string(data)
+	}
+	_, err := tx.ExecContext(ctx, o.bind(`INSERT INTO `+o.table+
+		` (topic, message_id, headers, body, attempts, created_at, available_at) VALUES (?, ?, ?, ?, 0, ?, `+o.now()+`)`),
+		topic, id, headers, msg.Body, time.Now().UTC())
+	return err
+}
+
+// claim locks up to limit pending rows for the owner until the lease expires.
+// Rows locked by other relays are skipped, so that every row is published by one relay at a time.
+// The lease is set and checked with the time of the database, and the lockedUntil of the records
+// is measured with the clock of the relay from before the claim, so that it ends before the lease.
+func (o *Outbox) claim(ctx context.Context, owner string, limit, maxAttempts int, lease time.Duration) ([]outboxRecord, error) {
+	start := time.Now()
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, o.bind(`SELECT id, topic, message_id, headers, body, attempts, created_at FROM `+o.table+
+		` WHERE sent_at IS NULL AND attempts < ? AND available_at <= `+o.now()+
+		` AND (locked_until IS NULL OR locked_until < `+o.now()+`)`+
+		` ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED`),
+		maxAttempts, limit)
+	if err != nil {
+		return nil, err
+	}
+	var records []outboxRecord
+	for rows.Next() {
+		var record outboxRecord
+		var headers sql.NullString
+		if err := rows.Scan(&record.id, &record.topic, &record.messageId, &headers, &record.body, &record.attempts, &record.createdAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if headers.Valid {
+			if err := json.Unmarshal([]byte(headers.String), &record.headers); err != nil {
+				rows.Close()
+				return nil, err
+			}
+		}
+		records = append(records, record)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(records) == 0 {
+		return nil, err
+	}
+
+	lockedUntil := start.Add(lease)
+	args := []any{owner, lease.Microseconds()}
+	placeholders := make([]string, len(records))
+	for i := range records {
+		records[i].lockedUntil = lockedUntil
+		placeholders[i] = "?"
+		args = append(args, records[i].id)
+	}
+	_, err = tx.ExecContext(ctx, o.bind(`UPDATE `+o.table+` SET locked_by = ?, locked_until = `+o.after()+` WHERE id IN (`+
+		strings.Join(placeholders, ", ")+`)`), args...)
+	if err != nil {
+		return nil, err
+	}
+	return records, tx.Commit()
+}
+
+// markSent marks a row claimed by the owner as published.
+// It returns ErrOutboxClaimLost if another relay claimed the row since.
+func (o *Outbox) markSent(ctx context.Context, id int64, owner string) error {
+	result, err := o.db.ExecContext(ctx, o.bind(`UPDATE `+o.table+
+		` SET sent_at = `+o.now()+`, locked_by = NULL, locked_until = NULL WHERE id = ? AND locked_by = ?`),
+		id, owner)
+	return claimed(result, err)
+}
+
+// markFailed records a failed attempt of a row claimed by the owner, and releases it for the retry delay.
+// It returns ErrOutboxClaimLost if another relay claimed the row since.
+func (o *Outbox) markFailed(ctx context.Context, id int64, owner string, cause error, delay time.Duration) error {
+	result, err := o.db.ExecContext(ctx, o.bind(`UPDATE `+o.table+
+		` SET attempts = attempts + 1, last_error = ?, available_at = `+o.after()+`, locked_by = NULL, locked_until = NULL`+
+		` WHERE id = ? AND locked_by = ?`),
+		cause.Error(), delay.Microseconds(), id, owner)
+	return claimed(result, err)
+}
+
+// claimed returns ErrOutboxClaimLost if the update of a claimed row matched no row.
+func claimed(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrOutboxClaimLost
+	}
+	return nil
+}
+
+// cleanup deletes the rows published before a time.
+func (o *Outbox) cleanup(ctx context.Context, before time.Time) (int64, error) {
+	result, err := o.db.ExecContext(ctx, o.bind(`DELETE FROM `+o.table+` WHERE sent_at IS NOT NULL AND sent_at < ?`), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// String returns the name of the table, for logging.
+func (o *Outbox) String() string {
+	return fmt.Sprintf("outbox(%s)", o.table)
+}
+
+// outboxStore is the part of an Outbox used by an OutboxRelay.
+type outboxStore interface {
+	claim(ctx context.Context, owner string, limit, maxAttempts int, lease time.Duration) ([]outboxRecord, error)
+	markSent(ctx context.Context, id int64, owner string) error
+	markFailed(ctx context.Context, id int64, owner string, cause error, delay time.Duration) error
+	cleanup(ctx context.Context, before time.Time) (int64, error)
+}
+
+// OutboxRelayOptions is a struct that represents the options of an OutboxRelay.
+// It contains the outbox, the publisher, the name of the relay, the size of the batches,
+// the polling interval, the lease of the claimed rows, the retry policy and the retention of the sent rows.
+type OutboxRelayOptions struct {
+	Outbox *Outbox
+	// Publisher must return once the message is confirmed, like RabbitMQBroker.Publish.
+	Publisher Publisher
+	// Owner identifies the relay in the locked_by column. Defaults to the hostname, the PID and a random suffix.
+	Owner string
+	// BatchSize is the number of rows claimed at a time, defaults to 100.
+	BatchSize int
+	// Interval is the delay between two polls of an empty outbox, defaults to 1 second.
+	Interval time.Duration
+	// Lease is how long the claimed rows are locked for the relay, defaults to 30 seconds.
+	// A publish is cancelled when the lease of its row expires, and the rows not published
+	// before their lease expires are left to the next claim. It should be well above the publish latency.
+	Lease time.Duration
+	// Retry sets the delay before publishing a failed row again. A row that failed MaxAttempts times
+	// is no longer published, and stays in the table with its last error.
+	Retry *RetryOptions
+	// Retention is how long the sent rows are kept, defaults to 7 days.
+	Retention time.Duration
+	// CleanupInterval is the delay between two deletions of the old rows, defaults to 1 hour.
+	CleanupInterval time.Duration
+}
+
+// OutboxRelay publishes the rows of an Outbox, and marks them sent once the publisher returns.
+// Several relays can run on the same table: each row is claimed by one relay at a time,
+// with FOR UPDATE SKIP LOCKED and a lease. Delivery is at least once: a relay crashing after publishing
+// a row but before marking it sent, or a publish outlasting the lease of its row, makes it published again.
+// Consumers deduplicate the messages by ID.
+// Rows are claimed in ID order, but a failed row is retried after the rows that follow it,
+// so the messages are not guaranteed to be published in order.
+type OutboxRelay struct {
+	store           outboxStore
+	publisher       Publisher
+	owner           string
+	batchSize       int
+	interval        time.Duration
+	lease           time.Duration
+	retry           RetryOptions
+	retention       time.Duration
+	cleanupInterval time.Duration
+	logger          *log.Logger
+}
+
+// NewOutboxRelay creates an OutboxRelay, see Run.
+func NewOutboxRelay(options *OutboxRelayOptions) *OutboxRelay {
+	r := &OutboxRelay{
+		store:           options.Outbox,
+		publisher:       options.Publisher,
+		owner:           options.Owner,
+		batchSize:       options.BatchSize,
+		interval:        options.Interval,
+		lease:           options.Lease,
+		retry:           options.Retry.withDefaults(),
+		retention:       options.Retention,
+		cleanupInterval: options.CleanupInterval,
+		logger:          log.New(os.Stdout, "", log.LstdFlags),
+	}
+	if r.owner == "" {
+		hostname, _ := os.Hostname()
+		r.owner = fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.New().String()[:8])
+	}
+	if r.batchSize <= 0 {
+		r.batchSize = defaultRelayBatchSize
+	}
+	if r.interval <= 0 {
+		r.interval = defaultRelayInterval
+	}
+	if r.lease <= 0 {
+		r.lease = defaultRelayLease
+	}
+	if r.retention <= 0 {
+		r.retention = defaultRelayRetention
+	}
+	if r.cleanupInterval <= 0 {
+		r.cleanupInterval = defaultRelayCleanupInterval
+	}
+	return r
+}
+
+// Run relays the outbox until ctx is done, and deletes the old sent rows every CleanupInterval.
+// Errors are logged and the relay keeps going. It returns ctx.Err().
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+	for {
+		if time.Since(lastCleanup) >= r.cleanupInterval {
+			if _, err := r.Cleanup(ctx); err != nil && ctx.Err() == nil {
+				r.logger.Println("Failed to clean up the outbox, err:", err)
+			}
+			lastCleanup = time.Now()
+		}
+		// Relay full batches without waiting, until the outbox is drained
+		for {
+			n, err := r.RelayOnce(ctx)
+			if err != nil && ctx.Err() == nil {
+				r.logger.Println("Failed to relay the outbox, err:", err)
+			}
+			if err != nil || n < r.batchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce claims a batch of rows, publishes them and marks them sent.
+// It returns the number of claimed rows. A failed row is released until its retry delay expires,
+// and the next rows of the batch are still published. ErrOutboxClaimLost is returned if the lease
+// of a row expired and another relay claimed it before it was marked.
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	records, err := r.store.claim(ctx, r.owner, r.batchSize, r.retry.MaxAttempts, r.lease)
+	if err != nil {
+		return 0, err
+	}
+	for _, record := range records {
+		if time.Now().After(record.lockedUntil) {
+			// Another relay may claim the row now
+			break
+		}
+		if err := r.publish(ctx, record); err != nil {
+			if ctx.Err() != nil {
+				return len(records), ctx.Err()
+			}
+			attempts := record.attempts + 1
+			if attempts >= r.retry.MaxAttempts {
+				r.logger.Printf("Outbox message %s failed %d times and is no longer published, err: %v", record.messageId, attempts, err)
+			}
+			if err := r.store.markFailed(ctx, record.id, r.owner, err, r.retry.delay(attempts)); err != nil {
+				return len(records), err
+			}
+			continue
+		}
+		if err := r.store.markSent(ctx, record.id, r.owner); err != nil {
+			return len(records), err
+		}
+	}
+	return len(records), nil
+}
+
+// publish publishes a row, cancelling the publish when its lease expires.
+func (r *OutboxRelay) publish(ctx context.Context, record outboxRecord) error {
+	ctx, cancel := context.WithDeadline(ctx, record.lockedUntil)
+	defer cancel()
+	return r.publisher.Publish(ctx, record.topic, record.message())
+}
+
+// Cleanup deletes the rows sent before the retention, and returns their number.
+func (r *OutboxRelay) Cleanup(ctx context.Context) (int64, error) {
+	return r.store.cleanup(ctx, time.Now().Add(-r.retention))
+}
+
+// message converts a row to the Message to publish, keeping its ID.
+func (record *outboxRecord) message() *Message {
+	return &Message{
+		ID:        record.messageId,
+		Headers:   record.headers,
+		Body:      record.body,
+		Timestamp: record.createdAt,
+	}
+}
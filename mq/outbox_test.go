@@ -0,0 +1,365 @@
+package mq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryOutbox is an outboxStore emulating the locking of the SQL outbox.
+type memoryOutbox struct {
+	mu     sync.Mutex
+	rows   []*memoryOutboxRow
+	claims int
+}
+
+type memoryOutboxRow struct {
+	record      outboxRecord
+	availableAt time.Time
+	lockedBy    string
+	sentAt      time.Time
+	lastError   string
+	deleted     bool
+}
+
+func (o *memoryOutbox) add(topic, id string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.rows = append(o.rows, &memoryOutboxRow{record: outboxRecord{
+		id:        int64(len(o.rows) + 1),
+		topic:     topic,
+		messageId: id,
+		body:      []byte(id),
+		createdAt: time.Now(),
+	}})
+}
+
+func (o *memoryOutbox) claim(ctx context.Context, owner string, limit, maxAttempts int, lease time.Duration) ([]outboxRecord, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.claims++
+	now := time.Now()
+	var records []outboxRecord
+	for _, row := range o.rows {
+		if len(records) == limit {
+			break
+		}
+		if row.deleted || !row.sentAt.IsZero() || row.record.attempts >= maxAttempts || row.availableAt.After(now) ||
+			(row.lockedBy != "" && row.record.lockedUntil.After(now)) {
+			continue
+		}
+		row.lockedBy = owner
+		row.record.lockedUntil = now.Add(lease)
+		records = append(records, row.record)
+	}
+	return records, nil
+}
+
+func (o *memoryOutbox) row(id int64, owner string) *memoryOutboxRow {
+	row := o.rows[id-1]
+	if row.lockedBy != owner {
+		return nil
+	}
+	row.lockedBy = ""
+	return row
+}
+
+func (o *memoryOutbox) markSent(ctx context.Context, id int64, owner string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	row := o.row(id, owner)
+	if row == nil {
+		return ErrOutboxClaimLost
+	}
+	row.sentAt = time.Now()
+	return nil
+}
+
+func (o *memoryOutbox) markFailed(ctx context.Context, id int64, owner string, cause error, delay time.Duration) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	row := o.row(id, owner)
+	if row == nil {
+		return ErrOutboxClaimLost
+	}
+	row.record.attempts++
+	row.lastError = cause.Error()
+	row.availableAt = time.Now().Add(delay)
+	return nil
+}
+
+func (o *memoryOutbox) cleanup(ctx context.Context, before time.Time) (int64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var n int64
+	for _, row := range o.rows {
+		if !row.deleted && !row.sentAt.IsZero() && row.sentAt.Before(before) {
+			row.deleted = true
+			n++
+		}
+	}
+	return n, nil
+}
+
+// recordingDB is a database/sql driver recording the statements of an Outbox.
+// Queries return rows, and statements affect affected rows.
+type recordingDB struct {
+	mu         sync.Mutex
+	statements []string
+	args       [][]driver.NamedValue
+	rows       [][]driver.Value
+	affected   int64
+}
+
+func (db *recordingDB) Connect(ctx context.Context) (driver.Conn, error) { return db, nil }
+func (db *recordingDB) Driver() driver.Driver                            { return nil }
+func (db *recordingDB) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (db *recordingDB) Close() error              { return nil }
+func (db *recordingDB) Begin() (driver.Tx, error) { return db, nil }
+func (db *recordingDB) Commit() error             { db.record("COMMIT", nil); return nil }
+func (db *recordingDB) Rollback() error           { return nil }
+
+func (db *recordingDB) record(query string, args []driver.NamedValue) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.statements = append(db.statements, query)
+	db.args = append(db.args, args)
+}
+
+func (db *recordingDB) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	db.record(query, args)
+	return driver.RowsAffected(db.affected), nil
+}
+
+func (db *recordingDB) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	db.record(query, args)
+	return &recordingRows{rows: db.rows}, nil
+}
+
+type recordingRows struct {
+	rows [][]driver.Value
+}
+
+func (r *recordingRows) Columns() []string {
+	return []string{"id", "topic", "message_id", "headers", "body", "attempts", "created_at"}
+}
+func (r *recordingRows) Close() error { return nil }
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// failingPublisher fails the first publishes of every message.
+type failingPublisher struct {
+	Publisher
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+func (p *failingPublisher) Publish(ctx context.Context, topic string, msg *Message) error {
+	p.mu.Lock()
+	if p.failures[msg.ID] > 0 {
+		p.failures[msg.ID]--
+		p.mu.Unlock()
+		return errors.New("broker unavailable")
+	}
+	p.mu.Unlock()
+	return p.Publisher.Publish(ctx, topic, msg)
+}
+
+// slowPublisher lets another relay claim the rows while it publishes.
+type slowPublisher struct {
+	Publisher
+	store    *memoryOutbox
+	deadline bool
+}
+
+func (p *slowPublisher) Publish(ctx context.Context, topic string, msg *Message) error {
+	_, p.deadline = ctx.Deadline()
+	time.Sleep(20 * time.Millisecond)
+	_, _ = p.store.claim(ctx, "other", 10, 1, time.Minute)
+	return p.Publisher.Publish(ctx, topic, msg)
+}
+
+func newTestRelay(store outboxStore, publisher Publisher, options *OutboxRelayOptions) *OutboxRelay {
+	r := NewOutboxRelay(options)
+	r.store = store
+	r.publisher = publisher
+	return r
+}
+
+func TestOutbox_Bind(t *testing.T) {
+	query := "UPDATE outbox SET sent_at = ? WHERE id = ? AND locked_by = ?"
+	assert.Equal(t, query, NewOutbox(&OutboxOptions{}).bind(query))
+	assert.Equal(t, "UPDATE outbox SET sent_at = $1 WHERE id = $2 AND locked_by = $3",
+		NewOutbox(&OutboxOptions{Dialect: OutboxPostgres}).bind(query))
+}
+
+func TestOutbox_Schema(t *testing.T) {
+	schema := NewOutbox(&OutboxOptions{Table: "events", Dialect: OutboxPostgres}).Schema()
+	assert.Len(t, schema, 2)
+	assert.Contains(t, schema[0], "CREATE TABLE IF NOT EXISTS events")
+	assert.Contains(t, schema[1], "ON events (sent_at, available_at)")
+	assert.Len(t, NewOutbox(&OutboxOptions{}).Schema(), 1)
+}
+
+func TestOutbox_SQL(t *testing.T) {
+	db := &recordingDB{affected: 1}
+	createdAt := time.Now().UTC().Truncate(time.Millisecond)
+	db.rows = [][]driver.Value{{int64(1), "orders", "a", `{"key":"value"}`, []byte("a"), int64(0), createdAt}}
+	outbox := NewOutbox(&OutboxOptions{DB: sql.OpenDB(db)})
+	ctx := context.Background()
+
+	start := time.Now()
+	records, err := outbox.claim(ctx, "relay-1", 10, 3, time.Minute)
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "a", records[0].messageId)
+		assert.Equal(t, map[string]any{"key": "value"}, records[0].headers)
+		assert.True(t, createdAt.Equal(records[0].createdAt))
+		assert.WithinDuration(t, start.Add(time.Minute), records[0].lockedUntil, time.Second)
+	}
+	assert.Len(t, db.statements, 3)
+	// The leases are compared with the time of the database, not of the relay
+	assert.Contains(t, db.statements[0], "available_at <= UTC_TIMESTAMP(6) AND (locked_until IS NULL OR locked_until < UTC_TIMESTAMP(6))")
+	assert.Contains(t, db.statements[0], "FOR UPDATE SKIP LOCKED")
+	assert.Equal(t, "UPDATE outbox SET locked_by = ?, locked_until = UTC_TIMESTAMP(6) + INTERVAL ? MICROSECOND WHERE id IN (?)", db.statements[1])
+	assert.Equal(t, []any{"relay-1", time.Minute.Microseconds(), int64(1)}, namedValues(db.args[1]))
+	assert.Equal(t, "COMMIT", db.statements[2])
+
+	assert.NoError(t, outbox.markSent(ctx, 1, "relay-1"))
+	assert.Contains(t, db.statements[3], "SET sent_at = UTC_TIMESTAMP(6), locked_by = NULL")
+	assert.NoError(t, outbox.markFailed(ctx, 1, "relay-1", errors.New("failed"), time.Second))
+	assert.Contains(t, db.statements[4], "available_at = UTC_TIMESTAMP(6) + INTERVAL ? MICROSECOND")
+	assert.Equal(t, []any{"failed", time.Second.Microseconds(), int64(1), "relay-1"}, namedValues(db.args[4]))
+
+	// No row matched: another relay claimed it
+	db.affected = 0
+	assert.ErrorIs(t, outbox.markSent(ctx, 1, "relay-1"), ErrOutboxClaimLost)
+	assert.ErrorIs(t, outbox.markFailed(ctx, 1, "relay-1", errors.New("failed"), time.Second), ErrOutboxClaimLost)
+
+	db = &recordingDB{}
+	outbox = NewOutbox(&OutboxOptions{DB: sql.OpenDB(db), Dialect: OutboxPostgres})
+	records, err = outbox.claim(ctx, "relay-1", 10, 3, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+	assert.Contains(t, db.statements[0], "available_at <= NOW() AND (locked_until IS NULL OR locked_until < NOW())")
+	assert.Contains(t, db.statements[0], "attempts < $1")
+}
+
+func namedValues(args []driver.NamedValue) []any {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+func TestOutboxRelay_RelayOnce(t *testing.T) {
+	store := &memoryOutbox{}
+	for _, id := range []string{"a", "b", "c"} {
+		store.add("orders", id)
+	}
+	broker := NewMemoryBroker()
+	publisher := &failingPublisher{Publisher: broker, failures: map[string]int{"b": 1, "c": 2}}
+	relay := newTestRelay(store, publisher, &OutboxRelayOptions{
+		Retry: &RetryOptions{MaxAttempts: 2, InitialDelay: time.Millisecond},
+	})
+
+	ctx := context.Background()
+	n, err := relay.RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 1, broker.Len("orders"))
+	assert.Equal(t, "broker unavailable", store.rows[1].lastError)
+
+	// The failed rows are not claimed before their retry delay expires
+	n, err = relay.RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	time.Sleep(5 * time.Millisecond)
+	n, err = relay.RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2, broker.Len("orders"))
+
+	// c failed MaxAttempts times and is no longer published
+	time.Sleep(5 * time.Millisecond)
+	n, err = relay.RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 2, store.rows[2].record.attempts)
+
+	var ids []string
+	assert.NoError(t, broker.Drain(ctx, "orders", func(ctx context.Context, msg *Message) error {
+		ids = append(ids, msg.ID)
+		return nil
+	}))
+	assert.Equal(t, []string{"a", "b"}, ids)
+
+	deleted, err := relay.Cleanup(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), deleted)
+	relay.retention = -time.Minute
+	deleted, err = relay.Cleanup(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+}
+
+func TestOutboxRelay_ClaimLost(t *testing.T) {
+	store := &memoryOutbox{}
+	store.add("orders", "a")
+	publisher := &slowPublisher{Publisher: NewMemoryBroker(), store: store}
+	relay := newTestRelay(store, publisher, &OutboxRelayOptions{Lease: 10 * time.Millisecond})
+
+	n, err := relay.RelayOnce(context.Background())
+	assert.ErrorIs(t, err, ErrOutboxClaimLost)
+	assert.Equal(t, 1, n)
+	assert.True(t, publisher.deadline)
+	assert.True(t, store.rows[0].sentAt.IsZero())
+	assert.Equal(t, "other", store.rows[0].lockedBy)
+}
+
+func TestOutboxRelay_Run(t *testing.T) {
+	store := &memoryOutbox{}
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		store.add("orders", id)
+	}
+	broker := NewMemoryBroker()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// Relays sharing the outbox publish every row once
+	var wg sync.WaitGroup
+	for _, owner := range []string{"relay-1", "relay-2", "relay-3"} {
+		relay := newTestRelay(store, broker, &OutboxRelayOptions{Owner: owner, BatchSize: 2, Interval: 10 * time.Millisecond})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.ErrorIs(t, relay.Run(ctx), context.DeadlineExceeded)
+		}()
+	}
+	wg.Wait()
+
+	var ids []string
+	assert.NoError(t, broker.Drain(context.Background(), "orders", func(ctx context.Context, msg *Message) error {
+		ids = append(ids, msg.ID)
+		return nil
+	}))
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d", "e", "f", "g"}, ids)
+	assert.Greater(t, store.claims, 3)
+}
@@ -0,0 +1,192 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// defaultShutdownTimeout is how long Options.Context cancellation waits for in-flight messages.
+const defaultShutdownTimeout = 30 * time.Second
+
+// PoolStats is a struct that represents the utilisation of the workers of a managed consumer.
+type PoolStats struct {
+	// Workers is the number of workers.
+	Workers int
+	// Busy is the number of workers currently running the handler.
+	Busy int
+	// Utilisation is Busy divided by Workers, between 0 and 1.
+	Utilisation float64
+	// Processed is the number of messages handled since the RabbitMQ was created.
+	Processed uint64
+}
+
+// pool runs the handler of a managed consumer on several workers, and tracks the in-flight messages.
+type pool struct {
+	workers   int
+	busy      atomic.Int64
+	processed atomic.Uint64
+	// ctx is passed to the handler, and cancelled when the shutdown deadline is exceeded.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// mu guards stopping, so that no message starts once Shutdown waits for inFlight.
+	mu       sync.Mutex
+	stopping bool
+	inFlight sync.WaitGroup
+}
+
+func newPool(workers int) *pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &pool{workers: workers, ctx: ctx, cancel: cancel}
+}
+
+// start registers an in-flight message, unless the pool is stopping.
+func (p *pool) start() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopping {
+		return false
+	}
+	p.inFlight.Add(1)
+	p.busy.Add(1)
+	return true
+}
+
+func (p *pool) finish() {
+	p.busy.Add(-1)
+	p.processed.Add(1)
+	p.inFlight.Done()
+}
+
+// stop prevents new messages from starting.
+func (p *pool) stop() {
+	p.mu.Lock()
+	p.stopping = true
+	p.mu.Unlock()
+}
+
+func (p *pool) isStopping() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stopping
+}
+
+// drain waits for the in-flight messages, or cancels their context when ctx is done.
+func (p *pool) drain(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		p.inFlight.Wait()
+		close(drained)
+	}()
+	defer p.cancel()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// consumeManaged processes the deliveries on the workers of the pool.
+// Deliveries received once the pool is stopping are requeued.
+func (rabbitMQ *RabbitMQ) consumeManaged(msgs <-chan amqp.Delivery) {
+	for i := 0; i < rabbitMQ.pool.workers; i++ {
+		go func() {
+			for d := range msgs {
+				if !rabbitMQ.pool.start() {
+					_ = d.Nack(false, true)
+					continue
+				}
+				rabbitMQ.process(rabbitMQ.pool.ctx, d)
+				rabbitMQ.pool.finish()
+			}
+		}()
+	}
+}
+
+// streamManaged consumes the queue with the consumer tag of the managed consumer,
+// so that Shutdown can cancel it.
+func (rabbitMQ *RabbitMQ) streamManaged() (<-chan amqp.Delivery, error) {
+	return rabbitMQ.consumeQueue(rabbitMQ.name, rabbitMQ.consumerTag, rabbitMQ.arguments)
+}
+
+// consumeQueue consumes a queue with a consumer tag, so that the consumer can be cancelled.
+func (rabbitMQ *RabbitMQ) consumeQueue(queue, tag string, arguments amqp.Table) (<-chan amqp.Delivery, error) {
+	ch, err := rabbitMQ.readyChannel()
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := ch.Consume(
+		queue,
+		tag,       // Consumer
+		false,     // Auto-Ack
+		false,     // Exclusive
+		false,     // No-local
+		false,     // No-Wait
+		arguments, // Args
+	)
+	if err != nil {
+		return nil, err
+	}
+	return rabbitMQ.status.consume(msgs), nil
+}
+
+// cancel cancels a consumer, if the channel is ready.
+func (rabbitMQ *RabbitMQ) cancel(tag string) {
+	if ch, err := rabbitMQ.readyChannel(); err == nil {
+		_ = ch.Cancel(tag, false)
+	}
+}
+
+// PoolStats returns the utilisation of the workers of the managed consumer.
+// Workers is 0 when Options.Handler is not set.
+func (rabbitMQ *RabbitMQ) PoolStats() PoolStats {
+	if rabbitMQ.pool == nil {
+		return PoolStats{}
+	}
+	stats := PoolStats{
+		Workers:   rabbitMQ.pool.workers,
+		Busy:      int(rabbitMQ.pool.busy.Load()),
+		Processed: rabbitMQ.pool.processed.Load(),
+	}
+	if stats.Workers > 0 {
+		stats.Utilisation = float64(stats.Busy) / float64(stats.Workers)
+	}
+	return stats
+}
+
+// Shutdown gracefully stops the RabbitMQ: it stops consuming, waits for the in-flight messages
+// of the managed consumer, then closes the channel and connection.
+// If ctx is done before the messages are processed, the context passed to the handler is cancelled,
+// the channel and connection are closed anyway, and the unacknowledged messages are redelivered later.
+// It returns ctx.Err() in that case.
+func (rabbitMQ *RabbitMQ) Shutdown(ctx context.Context) error {
+	var err error
+	if rabbitMQ.pool != nil {
+		rabbitMQ.pool.stop()
+		rabbitMQ.cancel(rabbitMQ.consumerTag)
+		err = rabbitMQ.pool.drain(ctx)
+	}
+	if closeErr := rabbitMQ.Close(); closeErr != nil && !errors.Is(closeErr, errAlreadyClosed) && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// shutdownOnCancel shuts down the RabbitMQ when ctx is done, waiting up to timeout for the in-flight messages.
+func (rabbitMQ *RabbitMQ) shutdownOnCancel(ctx context.Context, timeout time.Duration) {
+	select {
+	case <-rabbitMQ.done:
+		return
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := rabbitMQ.Shutdown(shutdownCtx); err != nil {
+		rabbitMQ.logger.Println("Failed to shutdown gracefully, err:", err)
+	}
+}
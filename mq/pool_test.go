@@ -0,0 +1,98 @@
+package mq
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// acknowledger records the acknowledgements of deliveries.
+type acknowledger struct {
+	mu    sync.Mutex
+	acks  []uint64
+	nacks []uint64
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acks = append(a.acks, tag)
+	return nil
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.nacks = append(a.nacks, tag)
+	return nil
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func TestRabbitMQ_Shutdown(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	rabbitMQ := &RabbitMQ{
+		done: make(chan bool),
+		handler: func(ctx context.Context, delivery amqp.Delivery) error {
+			started <- struct{}{}
+			<-release
+			return nil
+		},
+		pool: newPool(2),
+	}
+	ack := &acknowledger{}
+	msgs := make(chan amqp.Delivery, 3)
+	for tag := uint64(1); tag <= 2; tag++ {
+		msgs <- amqp.Delivery{Acknowledger: ack, DeliveryTag: tag}
+	}
+	rabbitMQ.consumeManaged(msgs)
+	<-started
+	<-started
+	stats := rabbitMQ.PoolStats()
+	assert.Equal(t, 2, stats.Workers)
+	assert.Equal(t, 2, stats.Busy)
+	assert.Equal(t, 1.0, stats.Utilisation)
+
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- rabbitMQ.Shutdown(context.Background())
+	}()
+	time.Sleep(100 * time.Millisecond)
+	// Deliveries received while stopping are requeued
+	msgs <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 3}
+	close(release)
+	assert.NoError(t, <-shutdown)
+	close(msgs)
+
+	ack.mu.Lock()
+	defer ack.mu.Unlock()
+	assert.ElementsMatch(t, []uint64{1, 2}, ack.acks)
+	assert.Eventually(t, func() bool { return rabbitMQ.PoolStats().Processed == 2 }, time.Second, 10*time.Millisecond)
+	assert.NotPanics(t, func() { _ = rabbitMQ.Shutdown(context.Background()) })
+}
+
+func TestRabbitMQ_ShutdownDeadline(t *testing.T) {
+	rabbitMQ := &RabbitMQ{
+		done: make(chan bool),
+		handler: func(ctx context.Context, delivery amqp.Delivery) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		pool: newPool(1),
+	}
+	rabbitMQ.pool.start()
+	go func() {
+		<-rabbitMQ.pool.ctx.Done()
+		rabbitMQ.pool.finish()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, rabbitMQ.Shutdown(ctx), context.DeadlineExceeded)
+}
@@ -0,0 +1,420 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// publishIDHeader correlates a mandatory message with its basic.return.
+	publishIDHeader = "x-publish-id"
+
+	defaultPublishBuffer = 10000
+	// confirmBuffer is the capacity of the chan receiving the confirms of a channel.
+	confirmBuffer = 256
+)
+
+var (
+	// ErrNacked is returned when the server refused to take responsibility for a message.
+	ErrNacked = errors.New("message nacked by the server")
+	// ErrBufferFull is returned when a message is published while disconnected
+	// and Options.PublishBuffer messages are already waiting for a channel.
+	ErrBufferFull = errors.New("publish buffer is full")
+)
+
+// ReturnError is returned when a mandatory message could not be routed to any queue.
+type ReturnError struct {
+	Return amqp.Return
+}
+
+func (e *ReturnError) Error() string {
+	return fmt.Sprintf("message returned: %d %s", e.Return.ReplyCode, e.Return.ReplyText)
+}
+
+// PublishRequest is a struct that represents a message to publish asynchronously.
+// It contains an optional context, the exchange and routing key, whether the message must be routed to a queue,
+// the message, and an optional callback.
+type PublishRequest struct {
+	// Context adds its trace ID to the X-Trace-Id header, unless the message has one.
+	// It does not cancel the publish, see Future.Wait.
+	Context    context.Context
+	Exchange   string
+	RoutingKey string
+	// Mandatory makes the Future fail with a *ReturnError if the message cannot be routed to any queue.
+	Mandatory bool
+	Msg       amqp.Publishing
+	// Callback is called once with the result of the Future. It runs on the goroutine receiving
+	// the confirms and must not block.
+	Callback func(err error)
+}
+
+// Future is the result of a message published with PublishAsync.
+// It is resolved when the server confirms the message, or when it nacks or returns it.
+// Messages published while disconnected, and messages not confirmed when the channel is lost,
+// are kept and published again once the channel is re-initialized.
+type Future struct {
+	request *PublishRequest
+	// id correlates a mandatory message with its basic.return.
+	id   string
+	done chan struct{}
+	err  error
+}
+
+// Done returns a chan closed when the Future is resolved.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err returns the error of a resolved Future, or nil while it is not resolved.
+func (f *Future) Err() error {
+	select {
+	case <-f.done:
+		return f.err
+	default:
+		return nil
+	}
+}
+
+// Wait waits for the Future to be resolved and returns its error, or ctx.Err() if ctx is done first.
+func (f *Future) Wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *Future) resolve(err error) {
+	f.err = err
+	close(f.done)
+	if f.request.Callback != nil {
+		f.request.Callback(err)
+	}
+}
+
+// publisher publishes messages on the channel of a RabbitMQ, and correlates the confirms
+// with the messages by delivery tag.
+type publisher struct {
+	// sendMu serializes the publishes, so that the delivery tags follow the publish order.
+	sendMu  sync.Mutex
+	channel *amqp.Channel
+	// buffer holds the messages waiting for a channel.
+	buffer    []*Future
+	maxBuffer int
+	closed    bool
+
+	// pendingMu guards the messages waiting for a confirm. It is never held while publishing,
+	// so that receiving the confirms cannot block on a publish.
+	pendingMu sync.Mutex
+	pending   map[uint64]*Future
+	returned  map[string]*ReturnError
+	// generation changes with the channel, so that the confirms of a lost channel are ignored.
+	generation uint64
+	nextID     atomic.Uint64
+	// published counts the confirmed messages and the messages published without confirm, see Status.
+	published *rateCounter
+}
+
+func newPublisher(maxBuffer int) *publisher {
+	if maxBuffer <= 0 {
+		maxBuffer = defaultPublishBuffer
+	}
+	return &publisher{
+		maxBuffer: maxBuffer,
+		pending:   make(map[uint64]*Future),
+		returned:  make(map[string]*ReturnError),
+	}
+}
+
+// attach publishes on a new channel, starting with the buffered messages.
+func (p *publisher) attach(ch *amqp.Channel) {
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, confirmBuffer))
+	returns := ch.NotifyReturn(make(chan amqp.Return))
+
+	p.sendMu.Lock()
+	p.pendingMu.Lock()
+	p.requeuePending()
+	generation := p.generation
+	p.pendingMu.Unlock()
+	if p.closed {
+		p.sendMu.Unlock()
+		return
+	}
+	p.channel = ch
+	go p.listen(generation, confirms, returns)
+
+	buffer := p.buffer
+	p.buffer = nil
+	var failed []*Future
+	var errs []error
+	for _, f := range buffer {
+		if err := p.send(f); err != nil {
+			failed = append(failed, f)
+			errs = append(errs, err)
+		}
+	}
+	p.sendMu.Unlock()
+	for i, f := range failed {
+		f.resolve(errs[i])
+	}
+}
+
+// requeuePending moves the messages waiting for a confirm to the front of the buffer,
+// and ignores the confirms of the current channel from now on.
+// It must be called with sendMu and pendingMu held.
+func (p *publisher) requeuePending() {
+	tags := make([]uint64, 0, len(p.pending))
+	for tag := range p.pending {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	requeued := make([]*Future, 0, len(tags)+len(p.buffer))
+	for _, tag := range tags {
+		requeued = append(requeued, p.pending[tag])
+	}
+	p.buffer = append(requeued, p.buffer...)
+	p.pending = make(map[uint64]*Future)
+	p.returned = make(map[string]*ReturnError)
+	p.generation++
+}
+
+// listen resolves the messages of a channel as their confirms arrive,
+// until the channel is closed.
+func (p *publisher) listen(generation uint64, confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			id, _ := r.Headers[publishIDHeader].(string)
+			p.pendingMu.Lock()
+			if generation == p.generation && id != "" {
+				p.returned[id] = &ReturnError{Return: r}
+			}
+			p.pendingMu.Unlock()
+		case confirm, ok := <-confirms:
+			if !ok {
+				p.detach(generation)
+				return
+			}
+			p.pendingMu.Lock()
+			if generation != p.generation {
+				p.pendingMu.Unlock()
+				continue
+			}
+			f := p.pending[confirm.DeliveryTag]
+			if f == nil {
+				// Published by UnsafePublish
+				p.pendingMu.Unlock()
+				continue
+			}
+			delete(p.pending, confirm.DeliveryTag)
+			var err error
+			if returnErr, ok := p.returned[f.id]; ok {
+				delete(p.returned, f.id)
+				err = returnErr
+			} else if !confirm.Ack {
+				err = ErrNacked
+			}
+			p.pendingMu.Unlock()
+			if err == nil {
+				p.published.add()
+			}
+			f.resolve(err)
+		}
+	}
+}
+
+// detach buffers the messages of a lost channel until the next channel is attached.
+func (p *publisher) detach(generation uint64) {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	if generation != p.generation {
+		return
+	}
+	p.requeuePending()
+	p.channel = nil
+}
+
+// publish sends a message, or buffers it while there is no channel.
+func (p *publisher) publish(f *Future) {
+	p.sendMu.Lock()
+	var err error
+	switch {
+	case p.closed:
+		err = errShutdown
+	case p.channel == nil && len(p.buffer) >= p.maxBuffer:
+		err = ErrBufferFull
+	case p.channel == nil:
+		p.buffer = append(p.buffer, f)
+	default:
+		err = p.send(f)
+	}
+	p.sendMu.Unlock()
+	if err != nil {
+		f.resolve(err)
+	}
+}
+
+// send publishes a message on the channel and waits for its confirm.
+// If the channel is closed, the message is buffered until the next channel is attached,
+// any other error is returned for the caller to resolve the Future with.
+// It must be called with sendMu held.
+func (p *publisher) send(f *Future) error {
+	tag := p.channel.GetNextPublishSeqNo()
+	p.pendingMu.Lock()
+	p.pending[tag] = f
+	p.pendingMu.Unlock()
+
+	err := p.channel.PublishWithContext(
+		context.Background(),
+		f.request.Exchange,   // Exchange
+		f.request.RoutingKey, // Routing key
+		f.request.Mandatory,  // Mandatory
+		false,                // Immediate
+		f.request.Msg,
+	)
+	if err != nil {
+		p.pendingMu.Lock()
+		delete(p.pending, tag)
+		p.pendingMu.Unlock()
+		if errors.Is(err, amqp.ErrClosed) {
+			// The channel is lost: detach requeues the buffer for the next channel.
+			p.buffer = append(p.buffer, f)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// unsafePublish publishes a message without tracking its confirm.
+func (p *publisher) unsafePublish(exchange, routingKey string, msg amqp.Publishing) error {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	return p.unsafeSend(p.channel, exchange, routingKey, msg)
+}
+
+// unsafePublishOn publishes a message without tracking its confirm, if ch is still the current channel.
+func (p *publisher) unsafePublishOn(ch *amqp.Channel, exchange, routingKey string, msg amqp.Publishing) error {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	if ch != p.channel {
+		return errNotConnected
+	}
+	return p.unsafeSend(ch, exchange, routingKey, msg)
+}
+
+// unsafeSend must be called with sendMu held.
+func (p *publisher) unsafeSend(ch *amqp.Channel, exchange, routingKey string, msg amqp.Publishing) error {
+	if ch == nil {
+		return errNotConnected
+	}
+	err := ch.PublishWithContext(
+		context.Background(),
+		exchange,   // Exchange
+		routingKey, // Routing key
+		false,      // Mandatory
+		false,      // Immediate
+		msg,
+	)
+	if err == nil {
+		p.published.add()
+	}
+	return err
+}
+
+// close fails the buffered messages and the messages waiting for a confirm.
+func (p *publisher) close() {
+	p.sendMu.Lock()
+	p.pendingMu.Lock()
+	p.requeuePending()
+	futures := p.buffer
+	p.buffer = nil
+	p.channel = nil
+	p.closed = true
+	p.pendingMu.Unlock()
+	p.sendMu.Unlock()
+	for _, f := range futures {
+		f.resolve(errShutdown)
+	}
+}
+
+// PublishAsync publishes a message without waiting for its confirm, and returns its Future.
+// Confirms are correlated with the messages by delivery tag, so that PublishAsync can be called
+// concurrently. While disconnected, the message is buffered and published once the channel
+// is re-initialized, unless Options.PublishBuffer messages are already buffered.
+func (rabbitMQ *RabbitMQ) PublishAsync(request *PublishRequest) *Future {
+	f := &Future{request: request, done: make(chan struct{})}
+	if request.Mandatory || request.Context != nil {
+		msg := request.Msg
+		if request.Context != nil {
+			msg.Headers = amqp.Table(traceHeaders(request.Context, defaultTraceKey, request.Msg.Headers))
+		}
+		if request.Mandatory {
+			f.id = strconv.FormatUint(rabbitMQ.publisher.nextID.Add(1), 10)
+			headers := make(amqp.Table, len(msg.Headers)+1)
+			for k, v := range msg.Headers {
+				headers[k] = v
+			}
+			headers[publishIDHeader] = f.id
+			msg.Headers = headers
+		}
+		f.request = &PublishRequest{
+			Context:    request.Context,
+			Exchange:   request.Exchange,
+			RoutingKey: request.RoutingKey,
+			Mandatory:  request.Mandatory,
+			Msg:        msg,
+			Callback:   request.Callback,
+		}
+	}
+	rabbitMQ.publisher.publish(f)
+	return f
+}
+
+// PublishBatch publishes messages with at most window messages waiting for a confirm at a time,
+// and returns the error of every message, nil for the confirmed ones.
+// A window of 0 publishes every message before waiting for the confirms.
+// If ctx is done, the messages not confirmed yet fail with ctx.Err().
+// The trace ID of ctx is added to the requests without a Context.
+func (rabbitMQ *RabbitMQ) PublishBatch(ctx context.Context, requests []*PublishRequest, window int) []error {
+	if window <= 0 {
+		window = len(requests)
+	}
+	futures := make([]*Future, len(requests))
+	errs := make([]error, len(requests))
+	for i, request := range requests {
+		if i >= window {
+			errs[i-window] = futures[i-window].Wait(ctx)
+		}
+		if err := ctx.Err(); err != nil {
+			for j := max(i-window+1, 0); j < len(requests); j++ {
+				errs[j] = err
+			}
+			return errs
+		}
+		if request.Context == nil {
+			traced := *request
+			traced.Context = ctx
+			request = &traced
+		}
+		futures[i] = rabbitMQ.PublishAsync(request)
+	}
+	for i := max(len(requests)-window, 0); i < len(requests); i++ {
+		errs[i] = futures[i].Wait(ctx)
+	}
+	return errs
+}
@@ -3,21 +3,26 @@ package mq
 import (
 	"context"
 	"errors"
+	"fmt"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"log"
 	"os"
+	"sync"
 	"time"
 )
 
 type RabbitMQ struct {
-	name            string
-	logger          *log.Logger
+	name   string
+	logger *log.Logger
+	// mu guards connection, channel, isReady and queue.
+	mu              sync.RWMutex
 	connection      *amqp.Connection
 	channel         *amqp.Channel
 	done            chan bool
 	notifyConnClose chan *amqp.Error
+	// connLost is closed when the shared connection is lost, see Options.Connection.
+	connLost        <-chan struct{}
 	notifyChanClose chan *amqp.Error
-	notifyConfirm   chan amqp.Confirmation
 	isReady         bool
 	// 每次队列只消费一个消息 这个消息没处理完服务器不会发送第二个消息过来
 	prefetchCount int
@@ -28,6 +33,23 @@ type RabbitMQ struct {
 	consume   func(<-chan amqp.Delivery)
 	arguments amqp.Table
 	queue     *amqp.Queue
+	// 交换机与绑定, 每次重新初始化channel时重新声明
+	topology topology
+	handler  Handler
+	retry    RetryOptions
+	// 托管消费者的worker池, 未设置Handler时为nil
+	pool        *pool
+	consumerTag string
+	closeOnce   sync.Once
+	publisher   *publisher
+	// channelListeners are notified of every new channel, see onChannel.
+	listenersMu      sync.Mutex
+	channelListeners []func(ch *amqp.Channel)
+	current          *amqp.Channel
+	status           *status
+	// shared is the Connection the channel is opened on, nil if the RabbitMQ dials its own connection.
+	shared *Connection
+	slot   *connectionSlot
 }
 
 const (
@@ -53,8 +75,36 @@ type Options struct {
 	PrefetchCount int
 	PrefetchSize  int
 	Global        bool
-	Consume       func(<-chan amqp.Delivery)
-	Arguments     amqp.Table
+	// Consume receives the raw deliveries. Unlike Handler, it does not put the trace ID of the
+	// X-Trace-Id header in a context, see Router.HandleDelivery.
+	Consume   func(<-chan amqp.Delivery)
+	Arguments amqp.Table
+	// Exchanges are declared before the queue is bound to them.
+	Exchanges []Exchange
+	// Bindings bind the queue to exchanges.
+	Bindings []Binding
+	// ExchangeBindings bind exchanges to other exchanges.
+	ExchangeBindings []ExchangeBinding
+	// Handler enables a managed consumer, which acknowledges the messages the Handler processed,
+	// retries the failed ones with a backoff, and parks them in a dead-letter queue after too many attempts.
+	// Consume is ignored when Handler is set.
+	Handler Handler
+	// Retry configures the retries of the managed consumer, nil uses the defaults of RetryOptions.
+	Retry *RetryOptions
+	// Workers is the number of goroutines running the Handler.
+	// Defaults to PrefetchCount, or 1 without PrefetchCount. More workers than PrefetchCount stay idle.
+	Workers int
+	// Context shuts down the RabbitMQ when it is done, see Shutdown.
+	Context context.Context
+	// ShutdownTimeout is how long the shutdown triggered by Context waits for in-flight messages,
+	// defaults to 30 seconds.
+	ShutdownTimeout time.Duration
+	// PublishBuffer is how many messages PublishAsync keeps while disconnected, defaults to 10000.
+	PublishBuffer int
+	// Connection shares its connections with other RabbitMQ instances instead of dialing Addr.
+	// The RabbitMQ opens its own channel on one of them. With a Connection, an empty Name
+	// declares no queue, for a RabbitMQ that only publishes.
+	Connection *Connection
 }
 
 // NewRabbitMQ creates a new consumer state instance, and automatically
@@ -69,8 +119,37 @@ func NewRabbitMQ(option *Options) *RabbitMQ {
 		prefetchSize:  option.PrefetchSize,
 		global:        option.Global,
 		arguments:     option.Arguments,
+		topology: topology{
+			exchanges:        option.Exchanges,
+			bindings:         option.Bindings,
+			exchangeBindings: option.ExchangeBindings,
+		},
+		handler:     option.Handler,
+		retry:       option.Retry.withDefaults(),
+		consumerTag: fmt.Sprintf("%s-%d-%d", option.Name, os.Getpid(), time.Now().UnixNano()),
+		publisher:   newPublisher(option.PublishBuffer),
+		status:      newStatus(),
+	}
+	rabbitMQ.publisher.published = &rabbitMQ.status.published
+	if option.Connection != nil {
+		rabbitMQ.shared = option.Connection
+		rabbitMQ.slot = option.Connection.acquire()
+	}
+	if option.Handler != nil {
+		workers := option.Workers
+		if workers <= 0 {
+			workers = max(option.PrefetchCount, 1)
+		}
+		rabbitMQ.pool = newPool(workers)
 	}
 	go rabbitMQ.handleReconnect(option.Addr)
+	if option.Context != nil {
+		timeout := option.ShutdownTimeout
+		if timeout <= 0 {
+			timeout = defaultShutdownTimeout
+		}
+		go rabbitMQ.shutdownOnCancel(option.Context, timeout)
+	}
 	return &rabbitMQ
 }
 
@@ -78,13 +157,14 @@ func NewRabbitMQ(option *Options) *RabbitMQ {
 // notifyConnClose, and then continuously attempt to reconnect.
 func (rabbitMQ *RabbitMQ) handleReconnect(addr string) {
 	for {
-		rabbitMQ.isReady = false
+		rabbitMQ.setReady(false)
 		log.Println("Attempting to connect")
 
 		conn, err := rabbitMQ.connect(addr)
 
 		if err != nil {
 			log.Println("Failed to connect. Retrying..., err:", err)
+			rabbitMQ.status.fail(err)
 
 			select {
 			case <-rabbitMQ.done:
@@ -102,13 +182,21 @@ func (rabbitMQ *RabbitMQ) handleReconnect(addr string) {
 
 // connect will create a new AMQP connection
 func (rabbitMQ *RabbitMQ) connect(addr string) (*amqp.Connection, error) {
-	conn, err := amqp.Dial(addr)
+	var conn *amqp.Connection
+	var lost <-chan struct{}
+	var err error
+	if rabbitMQ.shared != nil {
+		conn, lost, err = rabbitMQ.shared.wait(rabbitMQ.slot, rabbitMQ.done)
+	} else {
+		conn, err = amqp.Dial(addr)
+	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	rabbitMQ.changeConnection(conn)
+	rabbitMQ.changeConnection(conn, lost)
+	rabbitMQ.status.transition(StateConnected, nil)
 	log.Println("Connected!")
 	return conn, nil
 }
@@ -117,12 +205,13 @@ func (rabbitMQ *RabbitMQ) connect(addr string) (*amqp.Connection, error) {
 // and then continuously attempt to re-initialize both channels
 func (rabbitMQ *RabbitMQ) handleReInit(conn *amqp.Connection) bool {
 	for {
-		rabbitMQ.isReady = false
+		rabbitMQ.setReady(false)
 
 		err := rabbitMQ.init(conn)
 
 		if err != nil {
 			log.Println("Failed to initialize channel. Retrying..., err:", err)
+			rabbitMQ.status.fail(err)
 
 			select {
 			case <-rabbitMQ.done:
@@ -135,36 +224,56 @@ func (rabbitMQ *RabbitMQ) handleReInit(conn *amqp.Connection) bool {
 		select {
 		case <-rabbitMQ.done:
 			return true
-		case <-rabbitMQ.notifyConnClose:
+		case err := <-rabbitMQ.notifyConnClose:
 			log.Println("Connection closed. Reconnecting...")
+			var cause error
+			if err != nil {
+				cause = err
+			}
+			rabbitMQ.status.transition(StateReconnecting, cause)
 			return false
-		case <-rabbitMQ.notifyChanClose:
+		case <-rabbitMQ.connLost:
+			log.Println("Shared connection closed. Reconnecting...")
+			rabbitMQ.status.transition(StateReconnecting, nil)
+			return false
+		case err := <-rabbitMQ.notifyChanClose:
 			log.Println("Channel closed. Re-running init...")
+			rabbitMQ.status.channelError(err)
 		}
 	}
 }
 
-// init will initialize channel & declare queue
-func (rabbitMQ *RabbitMQ) init(conn *amqp.Connection) error {
+// init will initialize channel, declare queue, exchanges & bindings
+func (rabbitMQ *RabbitMQ) init(conn *amqp.Connection) (err error) {
 	ch, err := conn.Channel()
 
 	if err != nil {
 		return err
 	}
+	// Close the channel if it cannot be initialized, so that retries do not leak channels on a shared connection
+	defer func() {
+		if err != nil {
+			_ = ch.Close()
+		}
+	}()
 
 	err = ch.Confirm(false)
 
 	if err != nil {
 		return err
 	}
-	queue, err := ch.QueueDeclare(
-		rabbitMQ.name,
-		true,               // Durable
-		false,              // Delete when unused
-		false,              // Exclusive
-		false,              // No-wait
-		rabbitMQ.arguments, // Arguments
-	)
+	var queue amqp.Queue
+	// A RabbitMQ without a name on a shared connection only publishes
+	if rabbitMQ.shared == nil || rabbitMQ.name != "" {
+		queue, err = ch.QueueDeclare(
+			rabbitMQ.name,
+			true,               // Durable
+			false,              // Delete when unused
+			false,              // Exclusive
+			false,              // No-wait
+			rabbitMQ.arguments, // Arguments
+		)
+	}
 
 	if rabbitMQ.prefetchCount > 0 {
 		ch.Qos(
@@ -178,11 +287,39 @@ func (rabbitMQ *RabbitMQ) init(conn *amqp.Connection) error {
 		return err
 	}
 
+	err = rabbitMQ.topology.declare(ch, rabbitMQ.name)
+
+	if err != nil {
+		return err
+	}
+
+	if rabbitMQ.handler != nil {
+		err = rabbitMQ.declareRetry(ch)
+		if err != nil {
+			return err
+		}
+	}
+
 	rabbitMQ.changeChannel(ch)
+	rabbitMQ.publisher.attach(ch)
+	rabbitMQ.mu.Lock()
 	rabbitMQ.isReady = true
 	rabbitMQ.queue = &queue
+	rabbitMQ.mu.Unlock()
+	rabbitMQ.status.transition(StateReady, nil)
+	rabbitMQ.notifyChannel(ch)
 
-	if rabbitMQ.consume != nil {
+	if rabbitMQ.handler != nil {
+		if rabbitMQ.pool.isStopping() {
+			return nil
+		}
+		go func() {
+			msgs, err := rabbitMQ.streamManaged()
+			if err == nil {
+				rabbitMQ.consumeManaged(msgs)
+			}
+		}()
+	} else if rabbitMQ.consume != nil {
 		go func() {
 			msgs, err := rabbitMQ.Stream()
 			if err == nil {
@@ -194,57 +331,82 @@ func (rabbitMQ *RabbitMQ) init(conn *amqp.Connection) error {
 	return nil
 }
 
+// onChannel calls listener with the current channel, if any, and with every new channel.
+func (rabbitMQ *RabbitMQ) onChannel(listener func(ch *amqp.Channel)) {
+	rabbitMQ.listenersMu.Lock()
+	defer rabbitMQ.listenersMu.Unlock()
+	rabbitMQ.channelListeners = append(rabbitMQ.channelListeners, listener)
+	if rabbitMQ.current != nil {
+		listener(rabbitMQ.current)
+	}
+}
+
+// notifyChannel calls the listeners registered by onChannel with a new channel.
+func (rabbitMQ *RabbitMQ) notifyChannel(ch *amqp.Channel) {
+	rabbitMQ.listenersMu.Lock()
+	defer rabbitMQ.listenersMu.Unlock()
+	rabbitMQ.current = ch
+	for _, listener := range rabbitMQ.channelListeners {
+		listener(ch)
+	}
+}
+
 // changeConnection takes a new connection to the queue,
 // and updates the close listener to reflect this.
-func (rabbitMQ *RabbitMQ) changeConnection(connection *amqp.Connection) {
+// A shared connection is watched through lost, closed by its Connection once it is lost.
+func (rabbitMQ *RabbitMQ) changeConnection(connection *amqp.Connection, lost <-chan struct{}) {
+	rabbitMQ.mu.Lock()
 	rabbitMQ.connection = connection
-	rabbitMQ.notifyConnClose = make(chan *amqp.Error)
-	rabbitMQ.connection.NotifyClose(rabbitMQ.notifyConnClose)
+	rabbitMQ.mu.Unlock()
+	if lost != nil {
+		rabbitMQ.notifyConnClose = nil
+		rabbitMQ.connLost = lost
+		return
+	}
+	// Buffered, so that closing the connection never blocks on a RabbitMQ that stopped listening
+	rabbitMQ.notifyConnClose = make(chan *amqp.Error, 1)
+	rabbitMQ.connLost = nil
+	connection.NotifyClose(rabbitMQ.notifyConnClose)
 }
 
 // changeChannel takes a new channel to the queue,
 // and updates the channel listeners to reflect this.
 func (rabbitMQ *RabbitMQ) changeChannel(channel *amqp.Channel) {
+	rabbitMQ.mu.Lock()
 	rabbitMQ.channel = channel
-	rabbitMQ.notifyChanClose = make(chan *amqp.Error)
-	rabbitMQ.notifyConfirm = make(chan amqp.Confirmation, 1)
-	rabbitMQ.channel.NotifyClose(rabbitMQ.notifyChanClose)
-	rabbitMQ.channel.NotifyPublish(rabbitMQ.notifyConfirm)
+	rabbitMQ.mu.Unlock()
+	rabbitMQ.notifyChanClose = make(chan *amqp.Error, 1)
+	channel.NotifyClose(rabbitMQ.notifyChanClose)
 }
 
-// Push will push data onto the queue, and wait for a confirm.
-// If no confirms are received until within the resendTimeout,
-// it continuously re-sends messages until a confirm is received.
-// This will block until the server sends a confirm. Errors are
-// only returned if the push action itself fails, see UnsafePush.
-func (rabbitMQ *RabbitMQ) Push(data []byte) error {
+// setReady marks whether the channel can be used.
+func (rabbitMQ *RabbitMQ) setReady(ready bool) {
+	rabbitMQ.mu.Lock()
+	rabbitMQ.isReady = ready
+	rabbitMQ.mu.Unlock()
+}
+
+// readyChannel returns the channel, or errNotConnected if it is not ready.
+func (rabbitMQ *RabbitMQ) readyChannel() (*amqp.Channel, error) {
+	rabbitMQ.mu.RLock()
+	defer rabbitMQ.mu.RUnlock()
 	if !rabbitMQ.isReady {
-		return errors.New("failed to push push: not connected")
-	}
-	for {
-		err := rabbitMQ.UnsafePush(amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        data,
-		})
-		if err != nil {
-			rabbitMQ.logger.Println("Push failed. Retrying...")
-			select {
-			case <-rabbitMQ.done:
-				return errShutdown
-			case <-time.After(resendDelay):
-			}
-			continue
-		}
-		select {
-		case confirm := <-rabbitMQ.notifyConfirm:
-			if confirm.Ack {
-				//rabbitMQ.logger.Println("Push confirmed!")
-				return nil
-			}
-		case <-time.After(resendDelay):
-		}
-		rabbitMQ.logger.Println("Push didn't confirm. Retrying...")
+		return nil, errNotConnected
 	}
+	return rabbitMQ.channel, nil
+}
+
+// Push will push data onto the queue, and wait for a confirm, see Publish.
+func (rabbitMQ *RabbitMQ) Push(data []byte) error {
+	return rabbitMQ.PushContext(context.Background(), data)
+}
+
+// PushContext is like Push, with the trace ID of ctx in the headers, see PublishContext.
+func (rabbitMQ *RabbitMQ) PushContext(ctx context.Context, data []byte) error {
+	return rabbitMQ.PublishContext(ctx, "", rabbitMQ.name, amqp.Publishing{
+		ContentType: "text/plain",
+		Body:        data,
+	})
 }
 
 // UnsafePush will push to the queue without checking for
@@ -252,43 +414,76 @@ func (rabbitMQ *RabbitMQ) Push(data []byte) error {
 // No guarantees are provided for whether the server will
 // recieve the message.
 func (rabbitMQ *RabbitMQ) UnsafePush(msg amqp.Publishing) error {
-	if !rabbitMQ.isReady {
+	return rabbitMQ.UnsafePublish("", rabbitMQ.name, msg)
+}
+
+// PushV2 will push msg onto the queue, and wait for a confirm, see Publish.
+// It does not add a trace ID to the headers, see PublishContext.
+func (rabbitMQ *RabbitMQ) PushV2(msg amqp.Publishing) error {
+	return rabbitMQ.Publish("", rabbitMQ.name, msg)
+}
+
+// UnsafePublish will publish msg to the exchange with the routing key
+// without checking for confirmation. The empty exchange is the default
+// exchange, which routes to the queue named by the routing key.
+// It returns an error if it fails to connect.
+func (rabbitMQ *RabbitMQ) UnsafePublish(exchange, routingKey string, msg amqp.Publishing) error {
+	if !rabbitMQ.GetIsReady() {
 		return errNotConnected
 	}
-	return rabbitMQ.channel.PublishWithContext(
-		context.Background(),
-		"",            // Exchange
-		rabbitMQ.name, // Routing key
-		false,         // Mandatory
-		false,         // Immediate
-		msg,
-	)
+	return rabbitMQ.publisher.unsafePublish(exchange, routingKey, msg)
 }
 
-func (rabbitMQ *RabbitMQ) PushV2(msg amqp.Publishing) error {
-	if !rabbitMQ.isReady {
+// Publish will publish msg to the exchange with the routing key, and wait for a confirm.
+// If the server nacks the message, it re-sends it after resendDelay until it is confirmed.
+// Messages not confirmed when the connection is lost are re-sent once it is re-established.
+// This will block until the server sends a confirm. Errors are only returned
+// if it is not connected when called or shutting down, see PublishAsync.
+// It does not add a trace ID to the headers, see PublishContext.
+func (rabbitMQ *RabbitMQ) Publish(exchange, routingKey string, msg amqp.Publishing) error {
+	return rabbitMQ.PublishContext(context.Background(), exchange, routingKey, msg)
+}
+
+// PublishContext is like Publish, but adds the trace ID of ctx to the X-Trace-Id header
+// unless msg has one, and stops waiting for the confirm with ctx.Err() when ctx is done.
+func (rabbitMQ *RabbitMQ) PublishContext(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	if !rabbitMQ.GetIsReady() {
 		return errors.New("failed to push push: not connected")
 	}
+	// Stop waiting when the RabbitMQ is closed, even if the message was not resolved
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-rabbitMQ.done:
+			cancel()
+		case <-waitCtx.Done():
+		}
+	}()
 	for {
-		err := rabbitMQ.UnsafePush(msg)
-		if err != nil {
-			rabbitMQ.logger.Println("Push failed. Retrying...")
-			select {
-			case <-rabbitMQ.done:
-				return errShutdown
-			case <-time.After(resendDelay):
+		err := rabbitMQ.PublishAsync(&PublishRequest{
+			Context:    ctx,
+			Exchange:   exchange,
+			RoutingKey: routingKey,
+			Msg:        msg,
+		}).Wait(waitCtx)
+		if err != nil && waitCtx.Err() != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
 			}
-			continue
+			return errShutdown
 		}
+		if !errors.Is(err, ErrNacked) {
+			return err
+		}
+		rabbitMQ.logger.Println("Push didn't confirm. Retrying...")
 		select {
-		case confirm := <-rabbitMQ.notifyConfirm:
-			if confirm.Ack {
-				//rabbitMQ.logger.Println("Push confirmed!")
-				return nil
-			}
+		case <-rabbitMQ.done:
+			return errShutdown
+		case <-ctx.Done():
+			return ctx.Err()
 		case <-time.After(resendDelay):
 		}
-		rabbitMQ.logger.Println("Push didn't confirm. Retrying...")
 	}
 }
 
@@ -297,10 +492,11 @@ func (rabbitMQ *RabbitMQ) PushV2(msg amqp.Publishing) error {
 // successfully processed, or delivery.Nack when it fails.
 // Ignoring this will cause data to build up on the server.
 func (rabbitMQ *RabbitMQ) Stream() (<-chan amqp.Delivery, error) {
-	if !rabbitMQ.isReady {
-		return nil, errNotConnected
+	ch, err := rabbitMQ.readyChannel()
+	if err != nil {
+		return nil, err
 	}
-	return rabbitMQ.channel.Consume(
+	msgs, err := ch.Consume(
 		rabbitMQ.name,
 		"",                 // Consumer
 		false,              // Auto-Ack
@@ -309,35 +505,59 @@ func (rabbitMQ *RabbitMQ) Stream() (<-chan amqp.Delivery, error) {
 		false,              // No-Wait
 		rabbitMQ.arguments, // Args
 	)
+	if err != nil {
+		return nil, err
+	}
+	return rabbitMQ.status.consume(msgs), nil
 }
 
 // Close will cleanly shutdown the channel and connection.
+// It does not wait for in-flight messages, see Shutdown.
+// It always stops reconnecting and fails the buffered messages, even when it returns an error.
 func (rabbitMQ *RabbitMQ) Close() error {
-	if !rabbitMQ.isReady {
+	rabbitMQ.mu.Lock()
+	ready := rabbitMQ.isReady
+	rabbitMQ.isReady = false
+	channel, connection := rabbitMQ.channel, rabbitMQ.connection
+	rabbitMQ.mu.Unlock()
+	rabbitMQ.status.transition(StateClosed, nil)
+	defer rabbitMQ.stop()
+	if !ready {
 		return errAlreadyClosed
 	}
-	err := rabbitMQ.channel.Close()
-	if err != nil {
-		return err
+	err := channel.Close()
+	// A shared connection is closed by its Connection
+	if rabbitMQ.shared == nil {
+		if closeErr := connection.Close(); err == nil {
+			err = closeErr
+		}
 	}
-	err = rabbitMQ.connection.Close()
-	if err != nil {
-		return err
+	return err
+}
+
+// stop stops reconnecting and fails the buffered messages and the messages waiting for a confirm.
+func (rabbitMQ *RabbitMQ) stop() {
+	rabbitMQ.closeOnce.Do(func() {
+		close(rabbitMQ.done)
+	})
+	if rabbitMQ.publisher != nil {
+		rabbitMQ.publisher.close()
 	}
-	close(rabbitMQ.done)
-	rabbitMQ.isReady = false
-	return nil
 }
 
 // GetIsReady returns whether the queue is ready to be used.
 func (rabbitMQ *RabbitMQ) GetIsReady() bool {
+	rabbitMQ.mu.RLock()
+	defer rabbitMQ.mu.RUnlock()
 	return rabbitMQ.isReady
 }
 
 // GetQueueMessages is a method on the RabbitMQ struct.
-// It returns the number of messages in the queue.
-// If the queue is not initialized (nil), the method returns 0.
+// It returns the number of messages in the queue when the channel was last initialized.
+// If the queue is not initialized (nil), the method returns 0. See QueueStats for the live number.
 func (rabbitMQ *RabbitMQ) GetQueueMessages() int {
+	rabbitMQ.mu.RLock()
+	defer rabbitMQ.mu.RUnlock()
 	if rabbitMQ.queue == nil {
 		return 0
 	}
@@ -345,9 +565,11 @@ func (rabbitMQ *RabbitMQ) GetQueueMessages() int {
 }
 
 // GetQueueConsumers is a method on the RabbitMQ struct.
-// It returns the number of consumers in the queue.
-// If the queue is not initialized (nil), the method returns 0.
+// It returns the number of consumers of the queue when the channel was last initialized.
+// If the queue is not initialized (nil), the method returns 0. See QueueStats for the live number.
 func (rabbitMQ *RabbitMQ) GetQueueConsumers() int {
+	rabbitMQ.mu.RLock()
+	defer rabbitMQ.mu.RUnlock()
 	if rabbitMQ.queue == nil {
 		return 0
 	}
@@ -0,0 +1,114 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RabbitMQBroker adapts a RabbitMQ to the Publisher and Subscriber interfaces.
+// Topics are routing keys on the exchange of the broker when publishing, and queue names when subscribing.
+type RabbitMQBroker struct {
+	rabbitMQ *RabbitMQ
+	exchange string
+}
+
+// NewRabbitMQBroker creates a RabbitMQBroker publishing to the exchange,
+// or to the default exchange, which routes to the queue named by the topic, if exchange is empty.
+func NewRabbitMQBroker(rabbitMQ *RabbitMQ, exchange string) *RabbitMQBroker {
+	return &RabbitMQBroker{rabbitMQ: rabbitMQ, exchange: exchange}
+}
+
+// Publish publishes a persistent message and waits for its confirm, see RabbitMQ.PublishAsync.
+// The trace ID of the context is added to the headers.
+func (b *RabbitMQBroker) Publish(ctx context.Context, topic string, msg *Message) error {
+	id := msg.ID
+	if id == "" {
+		id = uuid.New().String()
+	}
+	timestamp := msg.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	return b.rabbitMQ.PublishAsync(&PublishRequest{
+		Exchange:   b.exchange,
+		RoutingKey: topic,
+		Msg: amqp.Publishing{
+			Headers:      amqp.Table(traceHeaders(ctx, defaultTraceKey, msg.Headers)),
+			DeliveryMode: amqp.Persistent,
+			MessageId:    id,
+			Timestamp:    timestamp,
+			Body:         msg.Body,
+		},
+	}).Wait(ctx)
+}
+
+// Subscribe consumes the queue named by the topic until ctx is done, consuming it again
+// every time the channel is re-initialized. Nack without requeue drops the message,
+// or dead-letters it if the queue has a dead-letter exchange.
+func (b *RabbitMQBroker) Subscribe(ctx context.Context, topic string, handler MessageHandler) error {
+	tag := fmt.Sprintf("%s-%d-%d", topic, os.Getpid(), time.Now().UnixNano())
+	for {
+		msgs, err := b.rabbitMQ.consumeQueue(topic, tag, nil)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(reInitDelay):
+			}
+			continue
+		}
+		if err := b.deliver(ctx, topic, tag, msgs, handler); err != nil {
+			return err
+		}
+	}
+}
+
+// deliver passes the deliveries to the handler until ctx is done, or until the channel is closed.
+func (b *RabbitMQBroker) deliver(ctx context.Context, topic, tag string, msgs <-chan amqp.Delivery, handler MessageHandler) error {
+	for {
+		select {
+		case <-ctx.Done():
+			b.rabbitMQ.cancel(tag)
+			// Requeue the deliveries received before the consumer was cancelled
+			for d := range msgs {
+				_ = d.Nack(false, true)
+			}
+			return ctx.Err()
+		case d, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			// An acknowledgement failing because the channel was closed is redelivered anyway
+			_ = handleMessage(ctx, handler, deliveryToMessage(d, topic))
+		}
+	}
+}
+
+// Close closes the RabbitMQ.
+func (b *RabbitMQBroker) Close() error {
+	return b.rabbitMQ.Close()
+}
+
+// deliveryToMessage converts a delivery to a Message settled by acknowledging the delivery.
+func deliveryToMessage(d amqp.Delivery, topic string) *Message {
+	return &Message{
+		ID:        d.MessageId,
+		Headers:   maps.Clone(d.Headers),
+		Body:      d.Body,
+		Timestamp: d.Timestamp,
+		Topic:     topic,
+		Attempt:   Attempts(d) + 1,
+		settle: func(ack, requeue bool) error {
+			if ack {
+				return d.Ack(false)
+			}
+			return d.Nack(false, requeue)
+		},
+	}
+}
@@ -0,0 +1,164 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trumanwong/go-tools/cache"
+)
+
+var (
+	// errRequeue makes cache.StreamQueue.Consume leave a message pending, so that it is delivered again.
+	errRequeue = errors.New("message requeued")
+	// errDeadLettered makes cache.StreamQueue.Consume skip the Ack of a message moved to the dead-letter stream.
+	errDeadLettered = errors.New("message dead-lettered")
+)
+
+// RedisStreamsOptions is a struct that represents the options of RedisStreams.
+// They are passed to the cache.StreamQueue of every topic, see cache.StreamQueueOptions.
+type RedisStreamsOptions struct {
+	Group string
+	// Consumer defaults to the hostname followed by a random suffix.
+	Consumer      string
+	MaxLen        int64
+	MaxDeliveries int64
+	// Block is how long a subscription waits for new messages at a time. Defaults to 5 seconds.
+	Block time.Duration
+	// MinIdle is how long a requeued message waits before it is delivered again. Defaults to one minute.
+	MinIdle time.Duration
+	Prefix  *string
+}
+
+// RedisStreams adapts Redis Streams to the Publisher and Subscriber interfaces through cache.StreamQueue.
+// Topics are stream keys, and subscriptions read them through the consumer group of the options.
+// The group is created from the start of the stream when a topic is first published or subscribed to,
+// so that the messages published before the first subscription are delivered too.
+type RedisStreams struct {
+	cache   *cache.Cache
+	options RedisStreamsOptions
+	// groups holds the topics whose consumer group was created.
+	groups sync.Map
+}
+
+// NewRedisStreams creates a RedisStreams on top of a Cache.
+func NewRedisStreams(c *cache.Cache, options *RedisStreamsOptions) *RedisStreams {
+	return &RedisStreams{cache: c, options: *options}
+}
+
+func (s *RedisStreams) queue(topic string) *cache.StreamQueue {
+	return cache.NewStreamQueue(s.cache, &cache.StreamQueueOptions{
+		Stream:        topic,
+		Group:         s.options.Group,
+		Consumer:      s.options.Consumer,
+		MaxLen:        s.options.MaxLen,
+		MaxDeliveries: s.options.MaxDeliveries,
+		Block:         s.options.Block,
+		MinIdle:       s.options.MinIdle,
+		StartID:       "0",
+		Prefix:        s.options.Prefix,
+	})
+}
+
+// createGroup creates the consumer group of a topic once.
+func (s *RedisStreams) createGroup(ctx context.Context, topic string, queue *cache.StreamQueue) error {
+	if _, ok := s.groups.Load(topic); ok {
+		return nil
+	}
+	if err := queue.CreateGroup(ctx); err != nil {
+		return err
+	}
+	s.groups.Store(topic, struct{}{})
+	return nil
+}
+
+// Publish appends the message to the stream named by the topic.
+// The headers, with the trace ID of the context, are encoded as JSON, so that numbers are decoded as float64.
+func (s *RedisStreams) Publish(ctx context.Context, topic string, msg *Message) error {
+	id := msg.ID
+	if id == "" {
+		id = uuid.New().String()
+	}
+	timestamp := msg.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	values := map[string]any{
+		"id":        id,
+		"body":      msg.Body,
+		"timestamp": timestamp.UnixMilli(),
+	}
+	if headers := traceHeaders(ctx, defaultTraceKey, msg.Headers); len(headers) > 0 {
+		headers, err := json.Marshal(headers)
+		if err != nil {
+			return err
+		}
+		values["headers"] = headers
+	}
+	queue := s.queue(topic)
+	if err := s.createGroup(ctx, topic, queue); err != nil {
+		return err
+	}
+	_, err := queue.Add(ctx, values)
+	return err
+}
+
+// Subscribe reads the stream named by the topic until ctx is done, see cache.StreamQueue.Consume.
+// A requeued message is delivered again after MinIdle, and moved to the dead-letter stream
+// after MaxDeliveries. Nack without requeue moves the message to the dead-letter stream at once.
+func (s *RedisStreams) Subscribe(ctx context.Context, topic string, handler MessageHandler) error {
+	queue := s.queue(topic)
+	if err := s.createGroup(ctx, topic, queue); err != nil {
+		return err
+	}
+	return queue.Consume(ctx, func(ctx context.Context, message cache.StreamMessage) error {
+		var result error
+		msg := streamToMessage(message, topic)
+		msg.settle = func(ack, requeue bool) error {
+			switch {
+			case ack:
+			case requeue:
+				result = errRequeue
+			default:
+				result = errDeadLettered
+				return queue.DeadLetter(ctx, message)
+			}
+			return nil
+		}
+		_ = handleMessage(ctx, handler, msg)
+		return result
+	})
+}
+
+// Close does nothing, the Cache belongs to the caller.
+func (s *RedisStreams) Close() error {
+	return nil
+}
+
+// streamToMessage converts a message read from a stream to a Message.
+func streamToMessage(message cache.StreamMessage, topic string) *Message {
+	msg := &Message{
+		ID:      message.ID,
+		Topic:   topic,
+		Attempt: int(message.Deliveries),
+	}
+	if id, ok := message.Values["id"].(string); ok {
+		msg.ID = id
+	}
+	if body, ok := message.Values["body"].(string); ok {
+		msg.Body = []byte(body)
+	}
+	if timestamp, ok := message.Values["timestamp"].(string); ok {
+		if milli, err := strconv.ParseInt(timestamp, 10, 64); err == nil {
+			msg.Timestamp = time.UnixMilli(milli)
+		}
+	}
+	if headers, ok := message.Values["headers"].(string); ok {
+		_ = json.Unmarshal([]byte(headers), &msg.Headers)
+	}
+	return msg
+}
@@ -0,0 +1,79 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/trumanwong/go-tools/cache"
+)
+
+func TestRedisStreams(t *testing.T) {
+	c, err := cache.NewCache(&redis.Options{
+		Addr:     os.Getenv("REDIS_ADDR"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+		DB:       0,
+	}, "test:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	empty := ""
+	deadLetter := "{test:mq:orders}:dead"
+	_, _ = c.Delete(ctx, &cache.DeleteRequest{Key: "mq:orders"})
+	_, _ = c.Delete(ctx, &cache.DeleteRequest{Key: deadLetter, Prefix: &empty})
+
+	streams := NewRedisStreams(c, &RedisStreamsOptions{Group: "workers", Block: 100 * time.Millisecond, MinIdle: 100 * time.Millisecond})
+	// Messages published before the first subscription are delivered too
+	timestamp := time.UnixMilli(time.Now().UnixMilli())
+	assert.NoError(t, streams.Publish(ctx, "mq:orders", &Message{
+		ID:        "order-1",
+		Headers:   map[string]any{"type": "order.created"},
+		Body:      []byte("order 1"),
+		Timestamp: timestamp,
+	}))
+	assert.NoError(t, streams.Publish(ctx, "mq:orders", &Message{ID: "order-2", Body: []byte("order 2")}))
+
+	received := make(chan *Message, 2)
+	done := make(chan error)
+	go func() {
+		done <- streams.Subscribe(ctx, "mq:orders", func(ctx context.Context, msg *Message) error {
+			if msg.ID == "order-2" {
+				return msg.Nack(false)
+			}
+			received <- msg
+			if msg.Attempt == 1 {
+				return errors.New("failed")
+			}
+			return nil
+		})
+	}()
+	for attempt := 1; attempt <= 2; attempt++ {
+		select {
+		case msg := <-received:
+			assert.Equal(t, "order-1", msg.ID)
+			assert.Equal(t, "order.created", msg.Headers["type"])
+			assert.Equal(t, []byte("order 1"), msg.Body)
+			assert.True(t, timestamp.Equal(msg.Timestamp))
+			assert.Equal(t, attempt, msg.Attempt)
+		case <-ctx.Done():
+			t.Fatal("message not received")
+		}
+	}
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// Nack without requeue moved the message to the dead-letter stream
+	dead := cache.NewStreamQueue(c, &cache.StreamQueueOptions{Stream: deadLetter, Group: "inspect", StartID: "0", Prefix: &empty})
+	assert.NoError(t, dead.CreateGroup(context.Background()))
+	messages, err := dead.Read(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "order-2", messages[0].Values["id"])
+	}
+}
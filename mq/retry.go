@@ -0,0 +1,243 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// attemptsHeader counts how many times the handler failed to process a message.
+	attemptsHeader = "x-attempts"
+	// lastErrorHeader holds the last error returned by the handler.
+	lastErrorHeader = "x-last-error"
+
+	defaultMaxAttempts  = 5
+	defaultInitialDelay = time.Second
+	defaultMaxDelay     = 10 * time.Minute
+	defaultMultiplier   = 2
+)
+
+// Handler processes a delivery of a managed consumer, see Options.Handler.
+// The delivery is acknowledged if it returns nil, and retried later otherwise.
+type Handler func(ctx context.Context, delivery amqp.Delivery) error
+
+// RetryOptions configures how a managed consumer retries the messages its Handler failed to process.
+// A failed message is published to a delay queue, whose TTL dead-letters it back to the queue
+// once the delay expired. After MaxAttempts failures, the message is parked in the dead-letter queue,
+// named after the queue with the ".dead" suffix, see ReplayDeadLetters.
+type RetryOptions struct {
+	// MaxAttempts defaults to 5.
+	MaxAttempts int
+	// InitialDelay is the delay before the first retry, defaults to 1 second.
+	InitialDelay time.Duration
+	// MaxDelay caps the delay between two attempts, defaults to 10 minutes.
+	MaxDelay time.Duration
+	// Multiplier multiplies the delay after every failure, defaults to 2.
+	Multiplier float64
+}
+
+// withDefaults returns a copy of the options with the zero fields set to their defaults.
+func (o *RetryOptions) withDefaults() RetryOptions {
+	var options RetryOptions
+	if o != nil {
+		options = *o
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = defaultMaxAttempts
+	}
+	if options.InitialDelay <= 0 {
+		options.InitialDelay = defaultInitialDelay
+	}
+	if options.MaxDelay <= 0 {
+		options.MaxDelay = defaultMaxDelay
+	}
+	if options.Multiplier < 1 {
+		options.Multiplier = defaultMultiplier
+	}
+	return options
+}
+
+// delay returns the delay before retrying a message that failed the given number of times.
+func (o RetryOptions) delay(attempts int) time.Duration {
+	delay := float64(o.InitialDelay) * math.Pow(o.Multiplier, float64(attempts-1))
+	if delay > float64(o.MaxDelay) {
+		return o.MaxDelay
+	}
+	return time.Duration(delay)
+}
+
+// Attempts returns how many times a managed consumer failed to process the delivery before.
+func Attempts(delivery amqp.Delivery) int {
+	switch attempts := delivery.Headers[attemptsHeader].(type) {
+	case int:
+		return attempts
+	case int8:
+		return int(attempts)
+	case int16:
+		return int(attempts)
+	case int32:
+		return int(attempts)
+	case int64:
+		return int(attempts)
+	}
+	return 0
+}
+
+// delayQueue returns the name of the queue holding the messages waiting for the given delay.
+func (rabbitMQ *RabbitMQ) delayQueue(delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%d", rabbitMQ.name, delay.Milliseconds())
+}
+
+// deadLetterQueue returns the name of the queue holding the messages that failed too many times.
+func (rabbitMQ *RabbitMQ) deadLetterQueue() string {
+	return rabbitMQ.name + ".dead"
+}
+
+// declareRetry declares the delay queues and the dead-letter queue of a managed consumer.
+func (rabbitMQ *RabbitMQ) declareRetry(ch *amqp.Channel) error {
+	declared := make(map[string]bool)
+	for attempts := 1; attempts < rabbitMQ.retry.MaxAttempts; attempts++ {
+		delay := rabbitMQ.retry.delay(attempts)
+		name := rabbitMQ.delayQueue(delay)
+		if declared[name] {
+			continue
+		}
+		declared[name] = true
+		_, err := ch.QueueDeclare(
+			name,
+			true,  // Durable
+			false, // Delete when unused
+			false, // Exclusive
+			false, // No-wait
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": rabbitMQ.name,
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := ch.QueueDeclare(
+		rabbitMQ.deadLetterQueue(),
+		true,  // Durable
+		false, // Delete when unused
+		false, // Exclusive
+		false, // No-wait
+		nil,   // Arguments
+	)
+	return err
+}
+
+// process runs the handler on a delivery, then acknowledges it,
+// or publishes it to a delay queue or to the dead-letter queue.
+// The trace ID of the headers is stored in the context of the handler, see Router.
+func (rabbitMQ *RabbitMQ) process(ctx context.Context, d amqp.Delivery) {
+	traceId, _ := d.Headers[defaultTraceKey].(string)
+	err := rabbitMQ.handle(withTraceId(ctx, defaultTraceKey, traceId), d)
+	if err == nil {
+		_ = d.Ack(false)
+		return
+	}
+
+	attempts := Attempts(d) + 1
+	msg := deliveryToPublishing(d)
+	msg.Headers[attemptsHeader] = int64(attempts)
+	msg.Headers[lastErrorHeader] = err.Error()
+	queue := rabbitMQ.deadLetterQueue()
+	if attempts < rabbitMQ.retry.MaxAttempts {
+		queue = rabbitMQ.delayQueue(rabbitMQ.retry.delay(attempts))
+	} else {
+		rabbitMQ.logger.Printf("Message failed %d times, moving it to %s, err: %s", attempts, queue, err)
+	}
+	if err := rabbitMQ.Publish("", queue, msg); err != nil {
+		_ = d.Nack(false, true)
+		return
+	}
+	_ = d.Ack(false)
+}
+
+// handle runs the handler, turning a panic into an error.
+func (rabbitMQ *RabbitMQ) handle(ctx context.Context, d amqp.Delivery) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return rabbitMQ.handler(ctx, d)
+}
+
+// ReplayDeadLetters moves up to limit messages from the dead-letter queue back to the queue,
+// resetting their attempts, and returns the number of messages moved.
+// A limit of 0 moves every message the dead-letter queue held when the replay started.
+func (rabbitMQ *RabbitMQ) ReplayDeadLetters(limit int) (int, error) {
+	ch, err := rabbitMQ.readyChannel()
+	if err != nil {
+		return 0, err
+	}
+	queue, err := ch.QueueDeclarePassive(
+		rabbitMQ.deadLetterQueue(),
+		true,  // Durable
+		false, // Delete when unused
+		false, // Exclusive
+		false, // No-wait
+		nil,   // Arguments
+	)
+	if err != nil {
+		return 0, err
+	}
+	if limit <= 0 || limit > queue.Messages {
+		limit = queue.Messages
+	}
+	replayed := 0
+	for replayed < limit {
+		d, ok, err := ch.Get(rabbitMQ.deadLetterQueue(), false)
+		if err != nil {
+			return replayed, err
+		}
+		if !ok {
+			break
+		}
+		msg := deliveryToPublishing(d)
+		delete(msg.Headers, attemptsHeader)
+		delete(msg.Headers, lastErrorHeader)
+		if err := rabbitMQ.Publish("", rabbitMQ.name, msg); err != nil {
+			_ = d.Nack(false, true)
+			return replayed, err
+		}
+		if err := d.Ack(false); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+// deliveryToPublishing copies a delivery into a message to publish again.
+func deliveryToPublishing(d amqp.Delivery) amqp.Publishing {
+	headers := make(amqp.Table, len(d.Headers)+2)
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		Expiration:      d.Expiration,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		UserId:          d.UserId,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+}
@@ -0,0 +1,314 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// directReplyTo is the pseudo queue of RabbitMQ that delivers replies to the channel that published the request.
+	directReplyTo = "amq.rabbitmq.reply-to"
+	// rpcErrorHeader holds the error returned by the handler of a request.
+	rpcErrorHeader = "x-rpc-error"
+
+	defaultRPCTimeout = 30 * time.Second
+)
+
+// ErrConnectionLost is returned by RPCClient.Call when the channel is lost before the reply arrived.
+// The request may or may not have been handled.
+var ErrConnectionLost = errors.New("connection lost before the reply was received")
+
+// RPCError is returned by RPCClient.Call when the handler of the server returned an error.
+type RPCError struct {
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	return "rpc: " + e.Message
+}
+
+// RPCRequest is a struct that represents a request sent by RPCClient.Call.
+// It contains the exchange and routing key of the queue of the server, the method, and the message.
+// The ReplyTo and CorrelationId of the message are set by Call.
+type RPCRequest struct {
+	Exchange   string
+	RoutingKey string
+	// Method selects the handler of the server, see RPCServer.Handle. It is sent as the type of the message.
+	Method string
+	Msg    amqp.Publishing
+}
+
+// rpcResult is the reply of a call, or the error that ended it.
+type rpcResult struct {
+	reply amqp.Delivery
+	err   error
+}
+
+// RPCClient sends requests to RPC servers and waits for their replies, received through direct reply-to.
+// Calls may run concurrently. When the channel is lost, the pending calls fail with ErrConnectionLost,
+// and the client receives the replies of the next channel.
+type RPCClient struct {
+	rabbitMQ *RabbitMQ
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	channel *amqp.Channel
+	tag     string
+	pending map[string]chan rpcResult
+	// generation changes with the channel, so that the end of a lost channel is ignored.
+	generation uint64
+	closed     bool
+}
+
+// NewRPCClient creates an RPCClient on a RabbitMQ.
+// Calls without a deadline time out after timeout, which defaults to 30 seconds.
+func NewRPCClient(rabbitMQ *RabbitMQ, timeout time.Duration) *RPCClient {
+	if timeout <= 0 {
+		timeout = defaultRPCTimeout
+	}
+	c := &RPCClient{
+		rabbitMQ: rabbitMQ,
+		timeout:  timeout,
+		tag:      fmt.Sprintf("rpc-%d-%d", os.Getpid(), time.Now().UnixNano()),
+		pending:  make(map[string]chan rpcResult),
+	}
+	rabbitMQ.onChannel(c.attach)
+	return c
+}
+
+// attach fails the pending calls and consumes the replies of a new channel.
+func (c *RPCClient) attach(ch *amqp.Channel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.failPending(ErrConnectionLost)
+	c.channel = nil
+	replies, err := ch.Consume(
+		directReplyTo,
+		c.tag, // Consumer
+		true,  // Auto-Ack, required by direct reply-to
+		false, // Exclusive
+		false, // No-local
+		false, // No-Wait
+		nil,   // Args
+	)
+	if err != nil {
+		c.rabbitMQ.logger.Println("Failed to consume RPC replies, err:", err)
+		return
+	}
+	c.channel = ch
+	go c.receive(c.generation, replies)
+}
+
+// receive passes the replies to their calls until the channel is closed.
+func (c *RPCClient) receive(generation uint64, replies <-chan amqp.Delivery) {
+	for reply := range replies {
+		c.mu.Lock()
+		result := c.pending[reply.CorrelationId]
+		if generation != c.generation {
+			result = nil
+		}
+		delete(c.pending, reply.CorrelationId)
+		c.mu.Unlock()
+		if result != nil {
+			result <- rpcResult{reply: reply}
+		}
+	}
+	c.mu.Lock()
+	if generation == c.generation {
+		c.failPending(ErrConnectionLost)
+		c.channel = nil
+	}
+	c.mu.Unlock()
+}
+
+// failPending ends the pending calls with err. It must be called with mu held.
+func (c *RPCClient) failPending(err error) {
+	for id, result := range c.pending {
+		result <- rpcResult{err: err}
+		delete(c.pending, id)
+	}
+	c.generation++
+}
+
+// Call sends a request and waits for its reply until ctx is done, or until the timeout of the client
+// if ctx has no deadline. It returns an *RPCError if the handler of the server returned an error.
+func (c *RPCClient) Call(ctx context.Context, request *RPCRequest) (amqp.Delivery, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	id := uuid.New().String()
+	result := make(chan rpcResult, 1)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return amqp.Delivery{}, errShutdown
+	}
+	ch := c.channel
+	if ch == nil {
+		c.mu.Unlock()
+		return amqp.Delivery{}, errNotConnected
+	}
+	c.pending[id] = result
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	msg := request.Msg
+	msg.ReplyTo = directReplyTo
+	msg.CorrelationId = id
+	msg.Type = request.Method
+	msg.Headers = amqp.Table(traceHeaders(ctx, defaultTraceKey, msg.Headers))
+	// The request must be published on the channel consuming the replies
+	if err := c.rabbitMQ.publisher.unsafePublishOn(ch, request.Exchange, request.RoutingKey, msg); err != nil {
+		return amqp.Delivery{}, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return amqp.Delivery{}, ctx.Err()
+	case r := <-result:
+		if r.err != nil {
+			return amqp.Delivery{}, r.err
+		}
+		if message, ok := r.reply.Headers[rpcErrorHeader].(string); ok {
+			return r.reply, &RPCError{Message: message}
+		}
+		return r.reply, nil
+	}
+}
+
+// Close stops receiving replies and fails the pending calls.
+func (c *RPCClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errAlreadyClosed
+	}
+	c.closed = true
+	c.failPending(errShutdown)
+	if c.channel != nil {
+		_ = c.channel.Cancel(c.tag, false)
+		c.channel = nil
+	}
+	return nil
+}
+
+// RPCHandler handles a request received by an RPCServer and returns the reply.
+// The ReplyTo and CorrelationId of the reply are set by the server.
+type RPCHandler func(ctx context.Context, request amqp.Delivery) (amqp.Publishing, error)
+
+// RPCServer handles the requests of a queue with the handler registered for their method,
+// and publishes the replies to the ReplyTo queue of the requests.
+type RPCServer struct {
+	rabbitMQ *RabbitMQ
+	mu       sync.RWMutex
+	handlers map[string]RPCHandler
+}
+
+// NewRPCServer creates an RPCServer without handlers on a RabbitMQ.
+func NewRPCServer(rabbitMQ *RabbitMQ) *RPCServer {
+	return &RPCServer{rabbitMQ: rabbitMQ, handlers: make(map[string]RPCHandler)}
+}
+
+// Handle registers the handler of a method.
+func (s *RPCServer) Handle(method string, handler RPCHandler) {
+	s.mu.Lock()
+	s.handlers[method] = handler
+	s.mu.Unlock()
+}
+
+// Serve handles the requests of the queue concurrently until ctx is done, consuming it again
+// every time the channel is re-initialized. The number of concurrent requests is bounded
+// by Options.PrefetchCount. When ctx is done, Serve waits for the requests being handled.
+func (s *RPCServer) Serve(ctx context.Context, queue string) error {
+	tag := fmt.Sprintf("%s-%d-%d", queue, os.Getpid(), time.Now().UnixNano())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		requests, err := s.rabbitMQ.consumeQueue(queue, tag, nil)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(reInitDelay):
+			}
+			continue
+		}
+		if err := s.serve(ctx, tag, requests, &wg); err != nil {
+			return err
+		}
+	}
+}
+
+// serve handles the requests until ctx is done, or until the channel is closed.
+func (s *RPCServer) serve(ctx context.Context, tag string, requests <-chan amqp.Delivery, wg *sync.WaitGroup) error {
+	for {
+		select {
+		case <-ctx.Done():
+			s.rabbitMQ.cancel(tag)
+			for d := range requests {
+				_ = d.Nack(false, true)
+			}
+			return ctx.Err()
+		case d, ok := <-requests:
+			if !ok {
+				return nil
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// Requests being handled when ctx is done are finished
+				s.reply(context.WithoutCancel(ctx), d)
+			}()
+		}
+	}
+}
+
+// reply runs the handler of a request, publishes its reply, and acknowledges the request.
+func (s *RPCServer) reply(ctx context.Context, d amqp.Delivery) {
+	traceId, _ := d.Headers[defaultTraceKey].(string)
+	reply, err := s.handle(withTraceId(ctx, defaultTraceKey, traceId), d)
+	if err != nil {
+		reply = amqp.Publishing{Headers: amqp.Table{rpcErrorHeader: err.Error()}}
+	}
+	reply.CorrelationId = d.CorrelationId
+	if d.ReplyTo != "" {
+		if err := s.rabbitMQ.UnsafePublish("", d.ReplyTo, reply); err != nil {
+			_ = d.Nack(false, true)
+			return
+		}
+	}
+	_ = d.Ack(false)
+}
+
+// handle runs the handler of the method of a request, turning a panic into an error.
+func (s *RPCServer) handle(ctx context.Context, d amqp.Delivery) (reply amqp.Publishing, err error) {
+	s.mu.RLock()
+	handler, ok := s.handlers[d.Type]
+	s.mu.RUnlock()
+	if !ok {
+		return reply, fmt.Errorf("%w: %q", ErrUnknownType, d.Type)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, d)
+}
@@ -0,0 +1,383 @@
+package mq
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// maxTransitions is the number of state transitions kept by Status.
+	maxTransitions = 20
+	// rateWindow is the number of seconds over which the rates are averaged.
+	rateWindow = 60
+)
+
+// ConnectionState is the state of the connection of a RabbitMQ.
+type ConnectionState int
+
+const (
+	// StateConnecting is the state until the first connection is established.
+	StateConnecting ConnectionState = iota
+	// StateConnected is the state while the channel is initialized on a new connection.
+	StateConnected
+	// StateReady is the state while the channel can publish and consume.
+	StateReady
+	// StateReconnecting is the state after the connection or the channel was lost.
+	StateReconnecting
+	// StateClosed is the state after Close or Shutdown.
+	StateClosed
+)
+
+var stateNames = [...]string{"connecting", "connected", "ready", "reconnecting", "closed"}
+
+func (s ConnectionState) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return "unknown"
+	}
+	return stateNames[s]
+}
+
+// MarshalText encodes the state as its name.
+func (s ConnectionState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// StateTransition is a change of the state of a RabbitMQ.
+type StateTransition struct {
+	From ConnectionState `json:"from"`
+	To   ConnectionState `json:"to"`
+	At   time.Time       `json:"at"`
+	// Error is the error that caused the transition, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// Status is a snapshot of the state and activity of a RabbitMQ, see RabbitMQ.Status.
+type Status struct {
+	Name  string          `json:"name"`
+	State ConnectionState `json:"state"`
+	// Since is when the RabbitMQ entered its state.
+	Since time.Time `json:"since"`
+	// Transitions are the latest state transitions, oldest first.
+	Transitions []StateTransition `json:"transitions"`
+	// Reconnects is the number of connections established after the first one.
+	Reconnects int64 `json:"reconnects"`
+	// ChannelErrors is the number of times the channel was closed by an error.
+	ChannelErrors int64     `json:"channel_errors"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorAt   time.Time `json:"last_error_at,omitempty"`
+	// Published is the number of confirmed messages, and of the messages published without confirm.
+	Published int64 `json:"published"`
+	// Consumed is the number of messages delivered to the consumers.
+	Consumed int64 `json:"consumed"`
+	// PublishRate and ConsumeRate are the messages per second over the last minute.
+	PublishRate float64 `json:"publish_rate"`
+	ConsumeRate float64 `json:"consume_rate"`
+}
+
+// QueueStats is the live depth of a queue, see RabbitMQ.QueueStats.
+type QueueStats struct {
+	Name      string `json:"name"`
+	Messages  int    `json:"messages"`
+	Consumers int    `json:"consumers"`
+}
+
+// rateCounter counts events, and their rate over the last rateWindow seconds in per-second buckets.
+type rateCounter struct {
+	total   atomic.Int64
+	mu      sync.Mutex
+	buckets [rateWindow]int64
+	seconds [rateWindow]int64
+}
+
+// add counts an event. It does nothing on a nil counter.
+func (c *rateCounter) add() {
+	if c == nil {
+		return
+	}
+	c.total.Add(1)
+	now := time.Now().Unix()
+	i := now % rateWindow
+	c.mu.Lock()
+	if c.seconds[i] != now {
+		c.seconds[i] = now
+		c.buckets[i] = 0
+	}
+	c.buckets[i]++
+	c.mu.Unlock()
+}
+
+// rate returns the events per second over the last rateWindow seconds.
+func (c *rateCounter) rate() float64 {
+	now := time.Now().Unix()
+	var n int64
+	c.mu.Lock()
+	for i, second := range c.seconds {
+		if second > now-rateWindow {
+			n += c.buckets[i]
+		}
+	}
+	c.mu.Unlock()
+	return float64(n) / rateWindow
+}
+
+// status tracks the state and activity of a RabbitMQ.
+type status struct {
+	mu            sync.Mutex
+	state         ConnectionState
+	since         time.Time
+	transitions   []StateTransition
+	connections   int64
+	channelErrors int64
+	lastError     string
+	lastErrorAt   time.Time
+	published     rateCounter
+	consumed      rateCounter
+}
+
+func newStatus() *status {
+	return &status{since: time.Now()}
+}
+
+// transition changes the state, recording err as its cause. The closed state is final.
+func (s *status) transition(to ConnectionState, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == StateClosed || s.state == to {
+		return
+	}
+	now := time.Now()
+	t := StateTransition{From: s.state, To: to, At: now}
+	if err != nil {
+		t.Error = err.Error()
+		s.lastError, s.lastErrorAt = t.Error, now
+	}
+	if to == StateConnected {
+		s.connections++
+	}
+	s.transitions = append(s.transitions, t)
+	if len(s.transitions) > maxTransitions {
+		s.transitions = s.transitions[len(s.transitions)-maxTransitions:]
+	}
+	s.state, s.since = to, now
+}
+
+// fail records an error that did not change the state.
+func (s *status) fail(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.lastError, s.lastErrorAt = err.Error(), time.Now()
+	s.mu.Unlock()
+}
+
+// channelError records the loss of the channel. A nil err is a graceful close, not counted as an error.
+func (s *status) channelError(err *amqp.Error) {
+	if s == nil {
+		return
+	}
+	// A nil *amqp.Error must not become a non-nil error
+	var cause error
+	if err != nil {
+		cause = err
+		s.mu.Lock()
+		s.channelErrors++
+		s.mu.Unlock()
+	}
+	s.transition(StateReconnecting, cause)
+}
+
+// consume counts the deliveries passing from msgs to the returned chan.
+func (s *status) consume(msgs <-chan amqp.Delivery) <-chan amqp.Delivery {
+	if s == nil {
+		return msgs
+	}
+	counted := make(chan amqp.Delivery)
+	go func() {
+		defer close(counted)
+		for d := range msgs {
+			s.consumed.add()
+			counted <- d
+		}
+	}()
+	return counted
+}
+
+// Status returns a snapshot of the state of the connection, its recent transitions and errors,
+// and the publish and consume rates.
+func (rabbitMQ *RabbitMQ) Status() Status {
+	s := rabbitMQ.status
+	if s == nil {
+		return Status{Name: rabbitMQ.name}
+	}
+	s.mu.Lock()
+	status := Status{
+		Name:          rabbitMQ.name,
+		State:         s.state,
+		Since:         s.since,
+		Transitions:   append([]StateTransition(nil), s.transitions...),
+		Reconnects:    max(s.connections-1, 0),
+		ChannelErrors: s.channelErrors,
+		LastError:     s.lastError,
+		LastErrorAt:   s.lastErrorAt,
+	}
+	s.mu.Unlock()
+	status.Published = s.published.total.Load()
+	status.Consumed = s.consumed.total.Load()
+	status.PublishRate = s.published.rate()
+	status.ConsumeRate = s.consumed.rate()
+	return status
+}
+
+// QueueStats returns the live number of messages and consumers of a queue, with a passive declare
+// on a temporary channel, so that a missing queue does not close the channel of the RabbitMQ.
+// The queue defaults to the queue of the RabbitMQ.
+func (rabbitMQ *RabbitMQ) QueueStats(queue string) (QueueStats, error) {
+	if queue == "" {
+		queue = rabbitMQ.name
+	}
+	rabbitMQ.mu.RLock()
+	conn, ready := rabbitMQ.connection, rabbitMQ.isReady
+	rabbitMQ.mu.RUnlock()
+	if !ready || conn == nil {
+		return QueueStats{}, errNotConnected
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return QueueStats{}, err
+	}
+	defer ch.Close()
+	q, err := ch.QueueDeclarePassive(
+		queue,
+		true,  // Durable
+		false, // Delete when unused
+		false, // Exclusive
+		false, // No-wait
+		nil,   // Arguments
+	)
+	if err != nil {
+		return QueueStats{}, err
+	}
+	return QueueStats{Name: q.Name, Messages: q.Messages, Consumers: q.Consumers}, nil
+}
+
+// HealthHandler returns a handler responding with the Status in JSON, with 200 OK when the RabbitMQ
+// is ready and 503 Service Unavailable otherwise. With gin, use gin.WrapH.
+func (rabbitMQ *RabbitMQ) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := rabbitMQ.Status()
+		code := http.StatusOK
+		if status.State != StateReady {
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(status)
+	})
+}
+
+// MetricsOptions is a struct that represents the options of RabbitMQ.RegisterMetrics.
+// It contains where the metrics are registered and the queues whose depth is reported.
+type MetricsOptions struct {
+	// Registerer registers the metrics. Defaults to prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+	// Queues are the queues whose depth is reported, with a passive declare on every scrape.
+	// Defaults to the queue of the RabbitMQ.
+	Queues []string
+}
+
+// collector reports the Status of a RabbitMQ when Prometheus scrapes it.
+type collector struct {
+	rabbitMQ      *RabbitMQ
+	queues        []string
+	up            *prometheus.Desc
+	reconnects    *prometheus.Desc
+	channelErrors *prometheus.Desc
+	published     *prometheus.Desc
+	consumed      *prometheus.Desc
+	messages      *prometheus.Desc
+	consumers     *prometheus.Desc
+}
+
+// RegisterMetrics registers Prometheus metrics reporting the Status of the RabbitMQ and the depth of queues.
+// It takes a pointer to a MetricsOptions struct, which may be nil, and returns an error
+// if the metrics cannot be registered.
+//
+// The following metrics are registered, labelled with the name of the RabbitMQ:
+//   - mq_up: 1 when the RabbitMQ is ready, 0 otherwise.
+//   - mq_reconnects_total and mq_channel_errors_total: see Status.
+//   - mq_published_total and mq_consumed_total: see Status.
+//   - mq_queue_messages and mq_queue_consumers: the depth of the queues, by queue.
+func (rabbitMQ *RabbitMQ) RegisterMetrics(options *MetricsOptions) error {
+	if options == nil {
+		options = &MetricsOptions{}
+	}
+	registerer := options.Registerer
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	queues := options.Queues
+	if queues == nil {
+		queues = []string{rabbitMQ.name}
+	}
+	labels := prometheus.Labels{"name": rabbitMQ.name}
+	return registerer.Register(&collector{
+		rabbitMQ: rabbitMQ,
+		queues:   queues,
+		up: prometheus.NewDesc("mq_up",
+			"Whether the RabbitMQ is ready.", nil, labels),
+		reconnects: prometheus.NewDesc("mq_reconnects_total",
+			"Tracks the number of reconnections.", nil, labels),
+		channelErrors: prometheus.NewDesc("mq_channel_errors_total",
+			"Tracks the number of channel errors.", nil, labels),
+		published: prometheus.NewDesc("mq_published_total",
+			"Tracks the number of published messages.", nil, labels),
+		consumed: prometheus.NewDesc("mq_consumed_total",
+			"Tracks the number of consumed messages.", nil, labels),
+		messages: prometheus.NewDesc("mq_queue_messages",
+			"The number of messages ready in the queue.", []string{"queue"}, labels),
+		consumers: prometheus.NewDesc("mq_queue_consumers",
+			"The number of consumers of the queue.", []string{"queue"}, labels),
+	})
+}
+
+// Describe implements prometheus.Collector.
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{c.up, c.reconnects, c.channelErrors, c.published, c.consumed, c.messages, c.consumers} {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector. The depth of the queues is omitted while disconnected.
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	status := c.rabbitMQ.Status()
+	up := 0.0
+	if status.State == StateReady {
+		up = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up)
+	ch <- prometheus.MustNewConstMetric(c.reconnects, prometheus.CounterValue, float64(status.Reconnects))
+	ch <- prometheus.MustNewConstMetric(c.channelErrors, prometheus.CounterValue, float64(status.ChannelErrors))
+	ch <- prometheus.MustNewConstMetric(c.published, prometheus.CounterValue, float64(status.Published))
+	ch <- prometheus.MustNewConstMetric(c.consumed, prometheus.CounterValue, float64(status.Consumed))
+	if up == 0 {
+		return
+	}
+	for _, queue := range c.queues {
+		stats, err := c.rabbitMQ.QueueStats(queue)
+		if err != nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.messages, prometheus.GaugeValue, float64(stats.Messages), queue)
+		ch <- prometheus.MustNewConstMetric(c.consumers, prometheus.GaugeValue, float64(stats.Consumers), queue)
+	}
+}
@@ -0,0 +1,128 @@
+package mq
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRabbitMQ_Status(t *testing.T) {
+	rabbitMQ := &RabbitMQ{name: "orders", status: newStatus(), publisher: newPublisher(0)}
+	rabbitMQ.publisher.published = &rabbitMQ.status.published
+	s := rabbitMQ.status
+	s.transition(StateConnected, nil)
+	s.transition(StateReady, nil)
+	s.channelError(&amqp.Error{Code: amqp.PreconditionFailed, Reason: "PRECONDITION_FAILED"})
+	s.transition(StateReady, nil)
+	s.transition(StateReconnecting, errors.New("connection reset"))
+	s.fail(errors.New("dial failed"))
+	s.transition(StateConnected, nil)
+	s.transition(StateReady, nil)
+	// A graceful close is not a channel error
+	s.channelError(nil)
+	s.transition(StateReady, nil)
+	rabbitMQ.publisher.published.add()
+	s.consumed.add()
+	s.consumed.add()
+
+	status := rabbitMQ.Status()
+	assert.Equal(t, "orders", status.Name)
+	assert.Equal(t, StateReady, status.State)
+	assert.Equal(t, int64(1), status.Reconnects)
+	assert.Equal(t, int64(1), status.ChannelErrors)
+	assert.Equal(t, "dial failed", status.LastError)
+	assert.Len(t, status.Transitions, 9)
+	assert.Equal(t, StateReady, status.Transitions[2].From)
+	assert.Contains(t, status.Transitions[2].Error, "PRECONDITION_FAILED")
+	assert.Empty(t, status.Transitions[7].Error)
+	assert.Equal(t, int64(1), status.Published)
+	assert.Equal(t, int64(2), status.Consumed)
+	assert.InDelta(t, 2.0/rateWindow, status.ConsumeRate, 1e-9)
+
+	// The closed state is final
+	s.transition(StateClosed, nil)
+	s.transition(StateReconnecting, errors.New("closed"))
+	assert.Equal(t, StateClosed, rabbitMQ.Status().State)
+	assert.NotPanics(t, func() { (&RabbitMQ{}).Status() })
+}
+
+func TestRabbitMQ_StatusRace(t *testing.T) {
+	rabbitMQ := &RabbitMQ{status: newStatus()}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				rabbitMQ.setReady(j%2 == 0)
+				rabbitMQ.status.transition(ConnectionState(j%4), nil)
+				rabbitMQ.status.consumed.add()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = rabbitMQ.GetIsReady()
+				_ = rabbitMQ.Status()
+				_, _ = rabbitMQ.readyChannel()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(400), rabbitMQ.Status().Consumed)
+}
+
+func TestRabbitMQ_HealthHandler(t *testing.T) {
+	rabbitMQ := &RabbitMQ{name: "orders", status: newStatus()}
+	recorder := httptest.NewRecorder()
+	rabbitMQ.HealthHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	rabbitMQ.status.transition(StateConnected, nil)
+	rabbitMQ.status.transition(StateReady, nil)
+	recorder = httptest.NewRecorder()
+	rabbitMQ.HealthHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var body map[string]any
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	assert.Equal(t, "ready", body["state"])
+	assert.Equal(t, "orders", body["name"])
+}
+
+func TestRabbitMQ_RegisterMetrics(t *testing.T) {
+	rabbitMQ := &RabbitMQ{name: "orders", status: newStatus()}
+	rabbitMQ.status.transition(StateConnected, nil)
+	rabbitMQ.status.channelError(&amqp.Error{Reason: "CHANNEL_ERROR"})
+	rabbitMQ.status.published.add()
+	registry := prometheus.NewRegistry()
+	assert.NoError(t, rabbitMQ.RegisterMetrics(&MetricsOptions{Registerer: registry}))
+
+	values := map[string]float64{}
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			assert.Equal(t, "orders", metric.GetLabel()[0].GetValue())
+			if metric.GetCounter() != nil {
+				values[family.GetName()] = metric.GetCounter().GetValue()
+			} else {
+				values[family.GetName()] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	assert.Equal(t, float64(0), values["mq_up"])
+	assert.Equal(t, float64(1), values["mq_channel_errors_total"])
+	assert.Equal(t, float64(1), values["mq_published_total"])
+	// The depth of the queues is omitted while disconnected
+	assert.NotContains(t, values, "mq_queue_messages")
+
+	assert.Error(t, rabbitMQ.RegisterMetrics(&MetricsOptions{Registerer: registry}))
+	assert.NoError(t, (&RabbitMQ{name: "payments"}).RegisterMetrics(&MetricsOptions{Registerer: registry}))
+}
@@ -0,0 +1,155 @@
+package mq
+
+import (
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Exchange describes an exchange declared by RabbitMQ.
+// Kind is one of amqp.ExchangeDirect, amqp.ExchangeTopic, amqp.ExchangeFanout or amqp.ExchangeHeaders,
+// and defaults to amqp.ExchangeDirect.
+type Exchange struct {
+	Name       string
+	Kind       string
+	Durable    bool
+	AutoDelete bool
+	// Internal exchanges only receive messages from other exchanges, through exchange bindings.
+	Internal  bool
+	Arguments amqp.Table
+}
+
+// Binding binds the queue of a RabbitMQ to an exchange.
+// For a headers exchange, the Arguments hold the headers to match and "x-match".
+type Binding struct {
+	Exchange   string
+	RoutingKey string
+	Arguments  amqp.Table
+}
+
+// ExchangeBinding routes the messages of the Source exchange that match the RoutingKey
+// to the Destination exchange.
+type ExchangeBinding struct {
+	Destination string
+	Source      string
+	RoutingKey  string
+	Arguments   amqp.Table
+}
+
+// topology holds the exchanges and bindings of a RabbitMQ,
+// which are declared again every time the channel is re-initialized.
+type topology struct {
+	mu               sync.Mutex
+	exchanges        []Exchange
+	bindings         []Binding
+	exchangeBindings []ExchangeBinding
+}
+
+// declare declares the exchanges, then binds the queue and the exchanges.
+func (t *topology) declare(ch *amqp.Channel, queue string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, exchange := range t.exchanges {
+		if err := declareExchange(ch, exchange); err != nil {
+			return err
+		}
+	}
+	for _, binding := range t.bindings {
+		if err := bindQueue(ch, queue, binding); err != nil {
+			return err
+		}
+	}
+	for _, binding := range t.exchangeBindings {
+		if err := bindExchange(ch, binding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func declareExchange(ch *amqp.Channel, exchange Exchange) error {
+	kind := exchange.Kind
+	if kind == "" {
+		kind = amqp.ExchangeDirect
+	}
+	return ch.ExchangeDeclare(
+		exchange.Name,
+		kind,
+		exchange.Durable,
+		exchange.AutoDelete,
+		exchange.Internal,
+		false, // No-wait
+		exchange.Arguments,
+	)
+}
+
+func bindQueue(ch *amqp.Channel, queue string, binding Binding) error {
+	return ch.QueueBind(
+		queue,
+		binding.RoutingKey,
+		binding.Exchange,
+		false, // No-wait
+		binding.Arguments,
+	)
+}
+
+func bindExchange(ch *amqp.Channel, binding ExchangeBinding) error {
+	return ch.ExchangeBind(
+		binding.Destination,
+		binding.RoutingKey,
+		binding.Source,
+		false, // No-wait
+		binding.Arguments,
+	)
+}
+
+// DeclareExchange declares an exchange now and every time the channel is re-initialized.
+// It returns an error if the RabbitMQ is not connected or the server refuses the exchange,
+// in which case the exchange is not declared again.
+func (rabbitMQ *RabbitMQ) DeclareExchange(exchange Exchange) error {
+	ch, err := rabbitMQ.readyChannel()
+	if err != nil {
+		return err
+	}
+	if err := declareExchange(ch, exchange); err != nil {
+		return err
+	}
+	rabbitMQ.topology.mu.Lock()
+	rabbitMQ.topology.exchanges = append(rabbitMQ.topology.exchanges, exchange)
+	rabbitMQ.topology.mu.Unlock()
+	return nil
+}
+
+// BindQueue binds the queue to an exchange now and every time the channel is re-initialized.
+// It returns an error if the RabbitMQ is not connected or the server refuses the binding,
+// in which case the binding is not declared again.
+func (rabbitMQ *RabbitMQ) BindQueue(binding Binding) error {
+	ch, err := rabbitMQ.readyChannel()
+	if err != nil {
+		return err
+	}
+	if err := bindQueue(ch, rabbitMQ.name, binding); err != nil {
+		return err
+	}
+	rabbitMQ.topology.mu.Lock()
+	rabbitMQ.topology.bindings = append(rabbitMQ.topology.bindings, binding)
+	rabbitMQ.topology.mu.Unlock()
+	return nil
+}
+
+// BindExchange binds an exchange to another exchange now and every time the channel is re-initialized.
+// It returns an error if the RabbitMQ is not connected or the server refuses the binding,
+// in which case the binding is not declared again.
+func (rabbitMQ *RabbitMQ) BindExchange(binding ExchangeBinding) error {
+	ch, err := rabbitMQ.readyChannel()
+	if err != nil {
+		return err
+	}
+	if err := bindExchange(ch, binding); err != nil {
+		return err
+	}
+	rabbitMQ.topology.mu.Lock()
+	rabbitMQ.topology.exchangeBindings = append(rabbitMQ.topology.exchangeBindings, binding)
+	rabbitMQ.topology.mu.Unlock()
+	return nil
+}